@@ -0,0 +1,540 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// AlertExpr is a node of a parsed alert expression: a *NumberLit, a
+// *MetricRef, a *CallExpr, a *UnaryExpr or a *BinaryExpr. Its String is the
+// canonical form of the expression.
+type AlertExpr interface {
+	String() string
+	// boolean reports whether the node is a condition rather than a number.
+	boolean() bool
+}
+
+// NumberLit is a number.
+type NumberLit struct {
+	Value float64
+}
+
+// MetricRef refers to a metric, or to a column of a metric as
+// "metric.column". Metric names may hold dots, so which it is depends on
+// the metrics of the bucket.
+type MetricRef struct {
+	Name string
+}
+
+// CallExpr applies an aggregator, such as mean, to the values of a metric.
+type CallExpr struct {
+	Func Aggregator
+	Arg  *MetricRef
+}
+
+// UnaryExpr is "-X" or "not X".
+type UnaryExpr struct {
+	Op string
+	X  AlertExpr
+}
+
+// BinaryExpr is "X Op Y", Op being an arithmetic operator (+ - * / %), a
+// comparison (> >= < <= == !=) or a logical operator (and, or).
+type BinaryExpr struct {
+	Op   string
+	X, Y AlertExpr
+}
+
+// precedence of the operators, from loosest to tightest.
+var precedence = map[string]int{
+	"or": 1, "and": 2, "not": 3,
+	">": 4, ">=": 4, "<": 4, "<=": 4, "==": 4, "!=": 4,
+	"+": 5, "-": 5,
+	"*": 6, "/": 6, "%": 6,
+}
+
+// unaryPrecedence is the precedence of "-X".
+const unaryPrecedence = 7
+
+func (lit *NumberLit) String() string {
+	return strconv.FormatFloat(lit.Value, 'f', -1, 64)
+}
+
+func (ref *MetricRef) String() string {
+	return ref.Name
+}
+
+func (call *CallExpr) String() string {
+	return string(call.Func) + "(" + call.Arg.String() + ")"
+}
+
+func (unary *UnaryExpr) String() string {
+	if unary.Op == "not" {
+		return "not " + wrap(unary.X, precedence["not"], false)
+	}
+	return unary.Op + wrap(unary.X, unaryPrecedence, false)
+}
+
+func (binary *BinaryExpr) String() string {
+	prec := precedence[binary.Op]
+	return wrap(binary.X, prec, false) + " " + binary.Op + " " +
+		wrap(binary.Y, prec, true)
+}
+
+// wrap formats an operand, in parentheses if it binds looser than its
+// operator, or as tightly on the right, since operators are left
+// associative.
+func wrap(expr AlertExpr, prec int, right bool) string {
+	inner := prec + 1
+	switch node := expr.(type) {
+	case *BinaryExpr:
+		inner = precedence[node.Op]
+	case *UnaryExpr:
+		inner = unaryPrecedence
+		if node.Op == "not" {
+			inner = precedence["not"]
+		}
+	}
+	if inner < prec || (right && inner == prec) {
+		return "(" + expr.String() + ")"
+	}
+	return expr.String()
+}
+
+func (lit *NumberLit) boolean() bool   { return false }
+func (ref *MetricRef) boolean() bool   { return false }
+func (call *CallExpr) boolean() bool   { return false }
+func (unary *UnaryExpr) boolean() bool { return unary.Op == "not" }
+func (binary *BinaryExpr) boolean() bool {
+	return precedence[binary.Op] <= precedence[">"]
+}
+
+// MetricRefs returns the metrics expr refers to, in order of appearance,
+// without duplicates.
+func MetricRefs(expr AlertExpr) []string {
+	var refs []string
+	var walk func(expr AlertExpr)
+	walk = func(expr AlertExpr) {
+		switch node := expr.(type) {
+		case *MetricRef:
+			for _, ref := range refs {
+				if ref == node.Name {
+					return
+				}
+			}
+			refs = append(refs, node.Name)
+		case *CallExpr:
+			walk(node.Arg)
+		case *UnaryExpr:
+			walk(node.X)
+		case *BinaryExpr:
+			walk(node.X)
+			walk(node.Y)
+		}
+	}
+	walk(expr)
+	return refs
+}
+
+// ParseAlertExpression parses an alert expression such as
+// "cpu.value > 20 and mean(mem.used) >= 0.9 * 1024". Expressions combine
+// numbers, metric references, aggregator calls, arithmetic, comparisons,
+// "and", "or" and "not", and must be conditions. "&&", "||", "!" and "="
+// are accepted for "and", "or", "not" and "==". Errors are
+// *ValidationError for the alert_expression field, giving the offset of
+// the mistake.
+func ParseAlertExpression(expr string) (AlertExpr, error) {
+	parser := &exprParser{src: expr}
+	if err := parser.tokenize(); err != nil {
+		return nil, err
+	}
+	if len(parser.tokens) == 1 {
+		return nil, parser.fail(parser.tokens[0], "empty expression")
+	}
+	root, err := parser.binary(1)
+	if err != nil {
+		return nil, err
+	}
+	if token := parser.peek(); token.kind != tokenEOF {
+		return nil, parser.fail(token,
+			fmt.Sprintf("unexpected %q", token.text))
+	}
+	if !root.boolean() {
+		return nil, parser.fail(parser.tokens[0],
+			"expression is a number, not a condition")
+	}
+	return root, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenName
+	tokenOp
+)
+
+type exprToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type exprParser struct {
+	src    string
+	tokens []exprToken
+	next   int
+}
+
+// operatorAliases maps the accepted spellings to the canonical operators.
+var operatorAliases = map[string]string{
+	"&&": "and", "||": "or", "!": "not", "=": "==", "<>": "!=",
+	"and": "and", "or": "or", "not": "not",
+}
+
+var numberPattern = regexp.MustCompile(`^[0-9]*\.?[0-9]+([eE][-+]?[0-9]+)?`)
+
+func (parser *exprParser) fail(token exprToken, reason string) error {
+	return &ValidationError{Field: "alert_expression",
+		Reason: fmt.Sprintf("at offset %d: %s", token.pos, reason)}
+}
+
+func isNameRune(r byte, first bool) bool {
+	return r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' ||
+		(!first && (r == '.' || '0' <= r && r <= '9'))
+}
+
+func (parser *exprParser) tokenize() error {
+	src := parser.src
+	for i := 0; i < len(src); {
+		c := src[i]
+		token := exprToken{pos: i}
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case c >= '0' && c <= '9' || c == '.':
+			end := i
+			for end < len(src) && (isNameRune(src[end], false) ||
+				((src[end] == '-' || src[end] == '+') &&
+					(src[end-1] == 'e' || src[end-1] == 'E'))) {
+				end++
+			}
+			token.kind, token.text = tokenNumber, src[i:end]
+			if numberPattern.FindString(token.text) != token.text {
+				return parser.fail(token,
+					fmt.Sprintf("invalid number %q", token.text))
+			}
+			i = end
+		case isNameRune(c, true):
+			end := i
+			for end < len(src) && isNameRune(src[end], false) {
+				end++
+			}
+			token.kind, token.text = tokenName, src[i:end]
+			if strings.HasSuffix(token.text, ".") ||
+				strings.Contains(token.text, "..") {
+				return parser.fail(token,
+					fmt.Sprintf("invalid metric %q", token.text))
+			}
+			if op, ok := operatorAliases[strings.ToLower(token.text)]; ok {
+				token.kind, token.text = tokenOp, op
+			}
+			i = end
+		default:
+			token.kind = tokenOp
+			for _, op := range []string{">=", "<=", "==", "!=", "<>", "&&", "||",
+				">", "<", "=", "!", "+", "-", "*", "/", "%", "(", ")"} {
+				if strings.HasPrefix(src[i:], op) {
+					token.text = op
+					break
+				}
+			}
+			if token.text == "" {
+				return parser.fail(token, fmt.Sprintf("unexpected %q", c))
+			}
+			i += len(token.text)
+			if alias, ok := operatorAliases[token.text]; ok {
+				token.text = alias
+			}
+		}
+		parser.tokens = append(parser.tokens, token)
+	}
+	parser.tokens = append(parser.tokens,
+		exprToken{kind: tokenEOF, pos: len(src)})
+	return nil
+}
+
+func (parser *exprParser) peek() exprToken {
+	return parser.tokens[parser.next]
+}
+
+func (parser *exprParser) take() exprToken {
+	token := parser.tokens[parser.next]
+	if token.kind != tokenEOF {
+		parser.next++
+	}
+	return token
+}
+
+// binary parses the operations binding at least as tightly as prec.
+func (parser *exprParser) binary(prec int) (AlertExpr, error) {
+	if prec == precedence["not"] {
+		return parser.not()
+	}
+	if prec > precedence["*"] {
+		return parser.unary()
+	}
+	x, err := parser.binary(prec + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		token := parser.peek()
+		if token.kind != tokenOp || precedence[token.text] != prec ||
+			token.text == "not" {
+			return x, nil
+		}
+		parser.take()
+		y, err := parser.binary(prec + 1)
+		if err != nil {
+			return nil, err
+		}
+		if err := parser.check(token, x, y); err != nil {
+			return nil, err
+		}
+		if prec == precedence[">"] {
+			next := parser.peek()
+			if next.kind == tokenOp && precedence[next.text] == prec {
+				return nil, parser.fail(next, "comparisons can't be chained")
+			}
+		}
+		x = &BinaryExpr{Op: token.text, X: x, Y: y}
+	}
+}
+
+// check verifies the types of the operands of op.
+func (parser *exprParser) check(op exprToken, x, y AlertExpr) error {
+	logical := op.text == "and" || op.text == "or"
+	for _, operand := range []AlertExpr{x, y} {
+		if operand.boolean() != logical {
+			if logical {
+				return parser.fail(op, fmt.Sprintf("%q needs conditions, got %s",
+					op.text, operand))
+			}
+			return parser.fail(op, fmt.Sprintf("%q needs numbers, got %s",
+				op.text, operand))
+		}
+	}
+	if (op.text == "/" || op.text == "%") && isZero(y) {
+		return parser.fail(op, "division by zero")
+	}
+	return nil
+}
+
+func isZero(expr AlertExpr) bool {
+	lit, ok := expr.(*NumberLit)
+	return ok && lit.Value == 0
+}
+
+func (parser *exprParser) not() (AlertExpr, error) {
+	token := parser.peek()
+	if token.kind != tokenOp || token.text != "not" {
+		return parser.binary(precedence["not"] + 1)
+	}
+	parser.take()
+	x, err := parser.not()
+	if err != nil {
+		return nil, err
+	}
+	if !x.boolean() {
+		return nil, parser.fail(token,
+			fmt.Sprintf(`"not" needs a condition, got %s`, x))
+	}
+	return &UnaryExpr{Op: "not", X: x}, nil
+}
+
+func (parser *exprParser) unary() (AlertExpr, error) {
+	token := parser.peek()
+	if token.kind == tokenOp && (token.text == "-" || token.text == "+") {
+		parser.take()
+		x, err := parser.unary()
+		if err != nil {
+			return nil, err
+		}
+		if x.boolean() {
+			return nil, parser.fail(token, fmt.Sprintf("%q needs a number, got %s",
+				token.text, x))
+		}
+		if token.text == "+" {
+			return x, nil
+		}
+		if lit, ok := x.(*NumberLit); ok {
+			return &NumberLit{Value: -lit.Value}, nil
+		}
+		return &UnaryExpr{Op: "-", X: x}, nil
+	}
+	return parser.primary()
+}
+
+func (parser *exprParser) primary() (AlertExpr, error) {
+	token := parser.take()
+	switch token.kind {
+	case tokenNumber:
+		value, err := strconv.ParseFloat(token.text, 64)
+		if err != nil || math.IsInf(value, 0) {
+			return nil, parser.fail(token,
+				fmt.Sprintf("invalid number %q", token.text))
+		}
+		return &NumberLit{Value: value}, nil
+	case tokenName:
+		if next := parser.peek(); next.kind == tokenOp && next.text == "(" {
+			return parser.call(token)
+		}
+		return &MetricRef{Name: token.text}, nil
+	case tokenOp:
+		if token.text == "(" {
+			x, err := parser.binary(1)
+			if err != nil {
+				return nil, err
+			}
+			if closing := parser.take(); closing.text != ")" {
+				return nil, parser.fail(closing, `missing ")"`)
+			}
+			return x, nil
+		}
+	case tokenEOF:
+		return nil, parser.fail(token, "unexpected end of expression")
+	}
+	return nil, parser.fail(token, fmt.Sprintf("unexpected %q", token.text))
+}
+
+// call parses "aggregator(metric)", name being the aggregator.
+func (parser *exprParser) call(name exprToken) (AlertExpr, error) {
+	fn := Aggregator(strings.ToLower(name.text))
+	if !fn.valid() {
+		return nil, parser.fail(name, fmt.Sprintf("unknown function %q", name.text))
+	}
+	parser.take()
+	arg := parser.take()
+	if arg.kind != tokenName {
+		return nil, parser.fail(arg, fmt.Sprintf("%s needs a metric", fn))
+	}
+	if closing := parser.take(); closing.text != ")" {
+		return nil, parser.fail(closing, `missing ")"`)
+	}
+	return &CallExpr{Func: fn, Arg: &MetricRef{Name: arg.text}}, nil
+}
+
+// CheckAlert checks the expression of alert, and that the metrics it refers
+// to exist, retrieving their names with the GetMetricNames of api. A
+// reference resolves to a metric of its name, or to a column of the metric
+// named by what precedes its last dot. The Metric_name of the alert, if
+// set, resolves the same way, so "cpu.value" names column value of metric
+// cpu, and the metric it resolves to must be referred to by the expression.
+func CheckAlert(ctx context.Context, api MetricsAPI, alert Alert) error {
+	_, _, err := alertMetrics(ctx, api, alert)
+	return err
+}
+
+// alertMetrics parses the expression of alert and checks it against the
+// metrics of api, as CheckAlert does. It returns the metrics it
+// refers to, a reference resolving to the metric of its own name first.
+func alertMetrics(ctx context.Context, api MetricsAPI, alert Alert) (
+	AlertExpr, []string, error) {
+	expr, err := ParseAlertExpression(alert.Alert_expression)
+	if err != nil {
+		return nil, nil, err
+	}
+	refs := MetricRefs(expr)
+	var candidates []string
+	for _, ref := range refs {
+		candidates = append(candidates, metricCandidates(ref)...)
+	}
+	if alert.Metric_name != "" {
+		candidates = append(candidates, metricCandidates(alert.Metric_name)...)
+	}
+	if len(candidates) == 0 {
+		// A constant expression, such as "1 > 0", refers to no metric.
+		return expr, nil, nil
+	}
+	quoted := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		quoted[i] = regexp.QuoteMeta(candidate)
+	}
+	names, err := api.GetMetricNamesCtx(ctx,
+		"^("+strings.Join(quoted, "|")+")$", 0, len(candidates))
+	if err != nil {
+		return nil, nil, err
+	}
+	known := make(map[string]bool, len(names))
+	for _, name := range names {
+		known[name] = true
+	}
+
+	var metricName string
+	if alert.Metric_name != "" {
+		for _, candidate := range metricCandidates(alert.Metric_name) {
+			if known[candidate] && metricName == "" {
+				metricName = candidate
+			}
+		}
+		if metricName == "" {
+			return nil, nil, &ValidationError{Field: "metric_name",
+				Reason: fmt.Sprintf("no metric %q", alert.Metric_name)}
+		}
+	}
+	var metrics []string
+	referred := metricName == ""
+	for _, ref := range refs {
+		resolved := ""
+		for _, candidate := range metricCandidates(ref) {
+			if known[candidate] && resolved == "" {
+				resolved = candidate
+			}
+			referred = referred ||
+				(known[candidate] && candidate == metricName)
+		}
+		if resolved == "" {
+			return nil, nil, &ValidationError{Field: "alert_expression",
+				Reason: fmt.Sprintf("no metric %q", ref)}
+		}
+		if !oneOf(resolved, metrics) {
+			metrics = append(metrics, resolved)
+		}
+	}
+	if !referred {
+		return nil, nil, &ValidationError{Field: "alert_expression",
+			Reason: fmt.Sprintf("doesn't refer to metric %q", alert.Metric_name)}
+	}
+	return expr, metrics, nil
+}
+
+// metricCandidates returns the metrics ref may refer to: itself, or the
+// metric of which it names a column.
+func metricCandidates(ref string) []string {
+	candidates := []string{ref}
+	if dot := strings.LastIndex(ref, "."); dot > 0 {
+		candidates = append(candidates, ref[:dot])
+	}
+	return candidates
+}
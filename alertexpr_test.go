@@ -0,0 +1,171 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestParseAlertExpression(t *testing.T) {
+	for expr, canonical := range map[string]string{
+		"cpu.value > 20":                      "cpu.value > 20",
+		"cpu.value>20&&mem.used<=1e3":         "cpu.value > 20 and mem.used <= 1000",
+		"(a > 1 || b < 2) AND c = 3":          "(a > 1 or b < 2) and c == 3",
+		"a > 1 or b < 2 and c <> 3":           "a > 1 or b < 2 and c != 3",
+		"!(a > 1)":                            "not a > 1",
+		"not (a > 1 and b > 1)":               "not (a > 1 and b > 1)",
+		"((a + b) * 2) >= -c":                 "(a + b) * 2 >= -c",
+		"a - (b - c) > a - b - c":             "a - (b - c) > a - b - c",
+		"a / (b * c) < +.5":                   "a / (b * c) < 0.5",
+		"MEAN(cpu.value) > 2 * max(cpu.idle)": "mean(cpu.value) > 2 * max(cpu.idle)",
+		"a_1.b2 % 3 == -0.25e1":               "a_1.b2 % 3 == -2.5",
+	} {
+		parsed, err := ParseAlertExpression(expr)
+		if err != nil {
+			t.Errorf("%s: %v", expr, err)
+			continue
+		}
+		if parsed.String() != canonical {
+			t.Errorf("%s: expected %q, got %q", expr, canonical, parsed)
+		}
+		reparsed, err := ParseAlertExpression(parsed.String())
+		if err != nil || !reflect.DeepEqual(parsed, reparsed) {
+			t.Errorf("%s: the canonical form parses differently: %v", expr, err)
+		}
+	}
+
+	for expr, reason := range map[string]string{
+		"":                "at offset 0: empty expression",
+		"cpu.value":       "at offset 0: expression is a number, not a condition",
+		"cpu.value > ":    "at offset 12: unexpected end of expression",
+		"cpu.value 20":    `at offset 10: unexpected "20"`,
+		"a > 1.2.3":       `at offset 4: invalid number "1.2.3"`,
+		"a > 0x10":        `at offset 4: invalid number "0x10"`,
+		"a > 1e999":       `at offset 4: invalid number "1e999"`,
+		"cpu. > 1":        `at offset 0: invalid metric "cpu."`,
+		"a >> 1":          `at offset 3: unexpected ">"`,
+		"a > 1 ; b":       `at offset 6: unexpected ';'`,
+		"a > b > c":       "at offset 6: comparisons can't be chained",
+		"a and b > 1":     `at offset 2: "and" needs conditions, got a`,
+		"(a > 1) + 2 > 0": `at offset 8: "+" needs numbers, got a > 1`,
+		"not a":           `at offset 0: "not" needs a condition, got a`,
+		"-(a > 1)":        `at offset 0: "-" needs a number, got a > 1`,
+		"a / 0 > 1":       "at offset 2: division by zero",
+		"avg(a) > 1":      `at offset 0: unknown function "avg"`,
+		"max(1) > 1":      "at offset 4: max needs a metric",
+		"(a > 1":          `at offset 6: missing ")"`,
+	} {
+		_, err := ParseAlertExpression(expr)
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) ||
+			validationErr.Field != "alert_expression" ||
+			validationErr.Reason != reason {
+			t.Errorf("%q: expected %q, got %v", expr, reason, err)
+		}
+	}
+}
+
+func TestMetricRefs(t *testing.T) {
+	expr, err := ParseAlertExpression(
+		"cpu.user + cpu.system > 90 or max(mem) > 1 and cpu.user < 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"cpu.user", "cpu.system", "mem"}
+	if refs := MetricRefs(expr); !reflect.DeepEqual(refs, expected) {
+		t.Errorf("expected %v, got %v", expected, refs)
+	}
+}
+
+func TestCheckAlert(t *testing.T) {
+	metrics := []string{"cpu", "disk.free", "mem"}
+	var patterns []string
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			pattern := r.URL.Query().Get("metric_name")
+			patterns = append(patterns, pattern)
+			names := []string{}
+			for _, name := range metrics {
+				if regexp.MustCompile(pattern).MatchString(name) {
+					names = append(names, name)
+				}
+			}
+			json.NewEncoder(w).Encode(names)
+		}))
+	defer server.Close()
+	bucket := (&Zeus{ApiServ: server.URL, Token: "goZeus"}).Bucket("b")
+
+	alert := Alert{Metric_name: "cpu",
+		Alert_expression: "cpu.user > 20 and disk.free < 1"}
+	if err := CheckAlert(context.Background(), bucket, alert); err != nil {
+		t.Error("valid alert failed:", err)
+	}
+	expected := `^(cpu\.user|cpu|disk\.free|disk|cpu)$`
+	if len(patterns) != 1 || patterns[0] != expected {
+		t.Errorf("expected a request for %s, got %v", expected, patterns)
+	}
+	alert.Metric_name = ""
+	if err := CheckAlert(context.Background(), bucket, alert); err != nil {
+		t.Error("an alert without metric name failed:", err)
+	}
+	alert.Metric_name = "cpu.user"
+	if err := CheckAlert(context.Background(), bucket, alert); err != nil {
+		t.Error("an alert naming a column of its metric failed:", err)
+	}
+
+	for _, invalid := range []struct {
+		field string
+		alert Alert
+	}{
+		{"metric_name", Alert{Metric_name: "swap",
+			Alert_expression: "cpu.user > 20"}},
+		{"alert_expression", Alert{Metric_name: "mem",
+			Alert_expression: "cpu.user > 20"}},
+		{"alert_expression", Alert{Metric_name: "mem.used",
+			Alert_expression: "cpu.user > 20"}},
+		{"alert_expression", Alert{
+			Alert_expression: "cpu.user > 20 and net.in > 1"}},
+	} {
+		err := CheckAlert(context.Background(), bucket, invalid.alert)
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) ||
+			validationErr.Field != invalid.field {
+			t.Errorf("%v: expected a validation error on %s, got %v",
+				invalid.alert, invalid.field, err)
+		}
+	}
+	patterns = nil
+	invalid := Alert{Alert_expression: "cpu >"}
+	if err := CheckAlert(context.Background(), bucket, invalid); err == nil {
+		t.Error("expected a syntax error")
+	}
+	if len(patterns) != 0 {
+		t.Error("an invalid expression should not be checked against Zeus")
+	}
+	constant := Alert{Alert_expression: "1 > 0"}
+	if err := CheckAlert(context.Background(), bucket, constant); err != nil {
+		t.Error("a constant expression failed:", err)
+	}
+	if len(patterns) != 0 {
+		t.Error("an expression without metrics should not be checked against Zeus")
+	}
+}
@@ -0,0 +1,337 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AlertType is what an alert watches. Zeus may report types other than the
+// constants below; they are kept as they are.
+type AlertType string
+
+// Alert types.
+const (
+	AlertTypeMetric AlertType = "metric"
+	AlertTypeLog    AlertType = "log"
+)
+
+// Severity is the severity of an alert, S1 being the most severe. Other
+// severities are kept as they are.
+type Severity string
+
+// Alert severities.
+const (
+	SeverityS1 Severity = "S1"
+	SeverityS2 Severity = "S2"
+	SeverityS3 Severity = "S3"
+	SeverityS4 Severity = "S4"
+)
+
+// AlertStatus tells whether an alert is evaluated. Other statuses are kept
+// as they are.
+type AlertStatus string
+
+// Alert statuses.
+const (
+	AlertActive   AlertStatus = "active"
+	AlertDisabled AlertStatus = "disabled"
+)
+
+// AlertV2 is an Alert with typed fields. Convert an Alert with ParseAlert,
+// and back with AlertV2.Alert to send it.
+type AlertV2 struct {
+	ID         int64
+	Name       string
+	Username   string
+	Token      string
+	Type       AlertType
+	Expression string
+	Severity   Severity
+	MetricName string
+	Emails     []string
+	Status     AlertStatus
+	// Frequency is how often the alert is evaluated. Zeus counts it in
+	// seconds.
+	Frequency   time.Duration
+	Created     time.Time
+	LastUpdated time.Time
+}
+
+// alertTimeLayouts are the layouts accepted for Created and Last_updated.
+var alertTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05.999999",
+}
+
+// ParseAlert converts alert to an AlertV2. Emails are split on commas, the
+// frequency is read as seconds, and the timestamps as RFC 3339, as
+// "2006-01-02 15:04:05" in UTC, or as unix seconds. Types, severities and
+// statuses are kept as they are, known or not.
+func ParseAlert(alert Alert) (AlertV2, error) {
+	created, err := parseAlertTime(alert.Created)
+	if err != nil {
+		return AlertV2{}, &ValidationError{Field: "created", Reason: err.Error()}
+	}
+	updated, err := parseAlertTime(alert.Last_updated)
+	if err != nil {
+		return AlertV2{}, &ValidationError{Field: "last_updated", Reason: err.Error()}
+	}
+	if math.IsNaN(alert.Frequency) || math.IsInf(alert.Frequency, 0) {
+		return AlertV2{}, &ValidationError{Field: "frequency",
+			Reason: "must be a number of seconds"}
+	}
+	var emails []string
+	for _, email := range strings.Split(alert.Emails, ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			emails = append(emails, email)
+		}
+	}
+	return AlertV2{
+		ID:          alert.Id,
+		Name:        alert.Alert_name,
+		Username:    alert.Username,
+		Token:       alert.Token,
+		Type:        AlertType(alert.Alerts_type),
+		Expression:  alert.Alert_expression,
+		Severity:    Severity(alert.Alert_severity),
+		MetricName:  alert.Metric_name,
+		Emails:      emails,
+		Status:      AlertStatus(alert.Status),
+		Frequency:   time.Duration(math.Round(alert.Frequency * float64(time.Second))),
+		Created:     created,
+		LastUpdated: updated,
+	}, nil
+}
+
+func parseAlertTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		sec, frac := math.Modf(seconds)
+		return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+	}
+	for _, layout := range alertTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", value)
+}
+
+// Alert converts the alert back to an Alert, as sent by PostAlert and
+// PutAlert. Timestamps are formatted as RFC 3339.
+func (alert AlertV2) Alert() Alert {
+	converted := Alert{
+		Id:               alert.ID,
+		Alert_name:       alert.Name,
+		Username:         alert.Username,
+		Token:            alert.Token,
+		Alerts_type:      string(alert.Type),
+		Alert_expression: alert.Expression,
+		Alert_severity:   string(alert.Severity),
+		Metric_name:      alert.MetricName,
+		Emails:           strings.Join(alert.Emails, ","),
+		Status:           string(alert.Status),
+		Frequency:        alert.Frequency.Seconds(),
+	}
+	if !alert.Created.IsZero() {
+		converted.Created = alert.Created.Format(time.RFC3339)
+	}
+	if !alert.LastUpdated.IsZero() {
+		converted.Last_updated = alert.LastUpdated.Format(time.RFC3339)
+	}
+	return converted
+}
+
+// Validate checks the alert before it is sent. It returns a *ValidationError
+// naming the invalid field as Zeus does: the name and expression are
+// required, as is the metric name of a metric alert; emails must be plain
+// addresses; and the frequency must be a positive whole number of seconds if
+// set. The type, severity and status are not checked, so that alerts read
+// from Zeus with values unknown to the client can be sent back.
+func (alert AlertV2) Validate() error {
+	if strings.TrimSpace(alert.Name) == "" {
+		return &ValidationError{Field: "alert_name", Reason: "is required"}
+	}
+	if strings.TrimSpace(alert.Expression) == "" {
+		return &ValidationError{Field: "alert_expression", Reason: "is required"}
+	}
+	if alert.Type == AlertTypeMetric && alert.MetricName == "" {
+		return &ValidationError{Field: "metric_name",
+			Reason: "is required for a metric alert"}
+	}
+	for _, email := range alert.Emails {
+		address, err := mail.ParseAddress(email)
+		if err != nil || address.Address != email {
+			return &ValidationError{Field: "emails",
+				Reason: fmt.Sprintf("invalid address %q", email)}
+		}
+	}
+	if alert.Frequency < 0 || alert.Frequency%time.Second != 0 {
+		return &ValidationError{Field: "frequency",
+			Reason: "must be a positive whole number of seconds"}
+	}
+	return nil
+}
+
+func oneOf[T comparable](value T, values []T) bool {
+	for _, known := range values {
+		if value == known {
+			return true
+		}
+	}
+	return false
+}
+
+// alertJSON is the JSON form of an AlertV2, with the field names of Zeus.
+type alertJSON struct {
+	ID          int64          `json:"id,omitempty"`
+	Name        string         `json:"alert_name"`
+	Username    string         `json:"username,omitempty"`
+	Token       string         `json:"token,omitempty"`
+	Type        AlertType      `json:"alerts_type,omitempty"`
+	Expression  string         `json:"alert_expression"`
+	Severity    Severity       `json:"alert_severity,omitempty"`
+	MetricName  string         `json:"metric_name,omitempty"`
+	Emails      emailList      `json:"emails,omitempty"`
+	Status      AlertStatus    `json:"status,omitempty"`
+	Frequency   alertFrequency `json:"frequency,omitempty"`
+	Created     string         `json:"created,omitempty"`
+	LastUpdated string         `json:"last_updated,omitempty"`
+}
+
+// emailList is a list of emails, read from an array or a comma separated
+// string.
+type emailList []string
+
+func (emails *emailList) UnmarshalJSON(js []byte) error {
+	var joined string
+	if err := json.Unmarshal(js, &joined); err != nil {
+		return json.Unmarshal(js, (*[]string)(emails))
+	}
+	*emails = nil
+	for _, email := range strings.Split(joined, ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			*emails = append(*emails, email)
+		}
+	}
+	return nil
+}
+
+// alertFrequency is a frequency, written as seconds and read from seconds or
+// a duration string such as "5m".
+type alertFrequency time.Duration
+
+func (frequency alertFrequency) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(frequency).Seconds())
+}
+
+func (frequency *alertFrequency) UnmarshalJSON(js []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(js, &raw); err != nil {
+		return err
+	}
+	switch value := raw.(type) {
+	case float64:
+		*frequency = alertFrequency(math.Round(value * float64(time.Second)))
+		return nil
+	case string:
+		d, err := time.ParseDuration(value)
+		*frequency = alertFrequency(d)
+		return err
+	}
+	return fmt.Errorf("invalid frequency %s", js)
+}
+
+// MarshalJSON encodes the alert with the field names of Zeus, emails as an
+// array and the frequency in seconds, leaving out empty fields:
+//
+//	{"alert_name": "cpu-high", "alert_expression": "cpu.value > 20",
+//	 "emails": ["ops@example.com"], "frequency": 60}
+func (alert AlertV2) MarshalJSON() ([]byte, error) {
+	encoded := alertJSON{
+		ID:         alert.ID,
+		Name:       alert.Name,
+		Username:   alert.Username,
+		Token:      alert.Token,
+		Type:       alert.Type,
+		Expression: alert.Expression,
+		Severity:   alert.Severity,
+		MetricName: alert.MetricName,
+		Emails:     alert.Emails,
+		Status:     alert.Status,
+		Frequency:  alertFrequency(alert.Frequency),
+	}
+	if !alert.Created.IsZero() {
+		encoded.Created = alert.Created.Format(time.RFC3339)
+	}
+	if !alert.LastUpdated.IsZero() {
+		encoded.LastUpdated = alert.LastUpdated.Format(time.RFC3339)
+	}
+	return json.Marshal(encoded)
+}
+
+// UnmarshalJSON decodes the alert as encoded by MarshalJSON. Emails may also
+// be given as a comma separated string, the frequency as a duration string
+// such as "5m", and timestamps as ParseAlert reads them.
+func (alert *AlertV2) UnmarshalJSON(js []byte) error {
+	var decoded alertJSON
+	if err := json.Unmarshal(js, &decoded); err != nil {
+		return err
+	}
+	converted, err := decoded.alertV2()
+	if err != nil {
+		return err
+	}
+	*alert = converted
+	return nil
+}
+
+func (decoded alertJSON) alertV2() (AlertV2, error) {
+	created, err := parseAlertTime(decoded.Created)
+	if err != nil {
+		return AlertV2{}, &ValidationError{Field: "created", Reason: err.Error()}
+	}
+	updated, err := parseAlertTime(decoded.LastUpdated)
+	if err != nil {
+		return AlertV2{}, &ValidationError{Field: "last_updated", Reason: err.Error()}
+	}
+	return AlertV2{
+		ID:          decoded.ID,
+		Name:        decoded.Name,
+		Username:    decoded.Username,
+		Token:       decoded.Token,
+		Type:        decoded.Type,
+		Expression:  decoded.Expression,
+		Severity:    decoded.Severity,
+		MetricName:  decoded.MetricName,
+		Emails:      decoded.Emails,
+		Status:      decoded.Status,
+		Frequency:   time.Duration(decoded.Frequency),
+		Created:     created,
+		LastUpdated: updated,
+	}, nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseAlert(t *testing.T) {
+	alert := Alert{
+		Id:               7,
+		Alert_name:       "hot",
+		Created:          "2015-04-30 01:04:29",
+		Username:         "jon",
+		Token:            "goZeus",
+		Alerts_type:      "metric",
+		Alert_expression: "cpu.value > 20",
+		Alert_severity:   "S1",
+		Metric_name:      "cpu.value",
+		Emails:           "a@example.com, b@example.com,",
+		Status:           "active",
+		Frequency:        30.5,
+		Last_updated:     "1430355869",
+	}
+	parsed, err := ParseAlert(alert)
+	if err != nil {
+		t.Fatal("failed to parse alert:", err)
+	}
+	expected := AlertV2{
+		ID:          7,
+		Name:        "hot",
+		Username:    "jon",
+		Token:       "goZeus",
+		Type:        AlertTypeMetric,
+		Expression:  "cpu.value > 20",
+		Severity:    SeverityS1,
+		MetricName:  "cpu.value",
+		Emails:      []string{"a@example.com", "b@example.com"},
+		Status:      AlertActive,
+		Frequency:   30500 * time.Millisecond,
+		Created:     time.Date(2015, 4, 30, 1, 4, 29, 0, time.UTC),
+		LastUpdated: time.Date(2015, 4, 30, 1, 4, 29, 0, time.UTC),
+	}
+	if !reflect.DeepEqual(parsed, expected) {
+		t.Errorf("expected %+v, got %+v", expected, parsed)
+	}
+
+	back := parsed.Alert()
+	alert.Emails = "a@example.com,b@example.com"
+	alert.Created = "2015-04-30T01:04:29Z"
+	alert.Last_updated = "2015-04-30T01:04:29Z"
+	if back != alert {
+		t.Errorf("expected %+v, got %+v", alert, back)
+	}
+	if again, err := ParseAlert(back); err != nil || !reflect.DeepEqual(again, parsed) {
+		t.Error("conversion should round trip:", again, err)
+	}
+
+	_, err = ParseAlert(Alert{Created: "yesterday"})
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Field != "created" {
+		t.Error("should fail on an invalid time:", err)
+	}
+}
+
+func TestAlertV2Validate(t *testing.T) {
+	valid := AlertV2{
+		Name:       "hot",
+		Type:       AlertTypeMetric,
+		Expression: "cpu.value > 20",
+		MetricName: "cpu.value",
+		Severity:   SeverityS2,
+		Status:     AlertDisabled,
+		Emails:     []string{"ops@example.com"},
+		Frequency:  time.Minute,
+	}
+	if err := valid.Validate(); err != nil {
+		t.Error("valid alert was rejected:", err)
+	}
+	if err := (AlertV2{Name: "n", Expression: "e"}).Validate(); err != nil {
+		t.Error("optional fields should not be required:", err)
+	}
+	unknown := Alert{Alert_name: "n", Alert_expression: "e", Alerts_type: "trace",
+		Alert_severity: "urgent", Status: "muted"}
+	if parsed, err := ParseAlert(unknown); err != nil || parsed.Validate() != nil ||
+		parsed.Alert() != unknown {
+		t.Error("unknown values should be kept and accepted:", parsed, err)
+	}
+
+	for field, modify := range map[string]func(alert *AlertV2){
+		"alert_name":       func(alert *AlertV2) { alert.Name = " " },
+		"alert_expression": func(alert *AlertV2) { alert.Expression = "" },
+		"metric_name":      func(alert *AlertV2) { alert.MetricName = "" },
+		"emails": func(alert *AlertV2) {
+			alert.Emails = []string{"Ops <ops@example.com>"}
+		},
+		"frequency": func(alert *AlertV2) { alert.Frequency = 1500 * time.Millisecond },
+	} {
+		alert := valid
+		alert.Emails = append([]string(nil), valid.Emails...)
+		modify(&alert)
+		err := alert.Validate()
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) || validationErr.Field != field {
+			t.Errorf("%s: expected a validation error, got %v", field, err)
+		}
+	}
+}
+
+func TestAlertV2JSON(t *testing.T) {
+	alert := AlertV2{
+		ID:          7,
+		Name:        "cpu-high",
+		Type:        AlertTypeMetric,
+		Expression:  "cpu.value > 20",
+		MetricName:  "cpu.value",
+		Emails:      []string{"ops@example.com", "dev@example.com"},
+		Frequency:   90 * time.Second,
+		LastUpdated: time.Date(2015, 4, 30, 1, 4, 29, 0, time.UTC),
+	}
+	js, err := json.Marshal(alert)
+	if err != nil {
+		t.Fatal("failed to marshal:", err)
+	}
+	expected := `{"id":7,"alert_name":"cpu-high","alerts_type":"metric",` +
+		`"alert_expression":"cpu.value \u003e 20","metric_name":"cpu.value",` +
+		`"emails":["ops@example.com","dev@example.com"],"frequency":90,` +
+		`"last_updated":"2015-04-30T01:04:29Z"}`
+	if string(js) != expected {
+		t.Errorf("expected %s, got %s", expected, js)
+	}
+	var decoded AlertV2
+	if err := json.Unmarshal(js, &decoded); err != nil ||
+		!reflect.DeepEqual(decoded, alert) {
+		t.Errorf("expected %+v, got %+v, %v", alert, decoded, err)
+	}
+
+	js = []byte(`{"alert_name": "n", "alert_expression": "e",
+		"emails": "ops@example.com, dev@example.com", "frequency": "1m30s"}`)
+	if err := json.Unmarshal(js, &decoded); err != nil ||
+		!reflect.DeepEqual(decoded.Emails, alert.Emails) ||
+		decoded.Frequency != alert.Frequency {
+		t.Errorf("wrong alert: %+v, %v", decoded, err)
+	}
+	for _, invalid := range []string{
+		`{"frequency": "often"}`,
+		`{"frequency": true}`,
+		`{"emails": 3}`,
+		`{"created": "yesterday"}`,
+	} {
+		if err := json.Unmarshal([]byte(invalid), &decoded); err == nil {
+			t.Errorf("%s: expected an error", invalid)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import "context"
+
+// LogsAPI sends and retrieves logs. *Zeus and *Bucket implement it, and so
+// does zeustest.Mock, so that code depending on LogsAPI rather than on the
+// client can be tested without a server. The same holds for MetricsAPI,
+// AlertsAPI, TrigalertsAPI and API.
+type LogsAPI interface {
+	GetLogs(logName, field, pattern string, from, to int64, offset, limit int) (
+		total int, logs LogList, err error)
+	GetLogsCtx(ctx context.Context, logName, field, pattern string, from,
+		to int64, offset, limit int) (total int, logs LogList, err error)
+	PostLogs(logs LogList) (successful int, err error)
+	PostLogsCtx(ctx context.Context, logs LogList) (successful int, err error)
+	PostLogsResult(ctx context.Context, logs LogList) (PostResult, error)
+}
+
+// MetricsAPI sends, retrieves and deletes metrics.
+type MetricsAPI interface {
+	PostMetrics(metrics MetricList) (successful int, err error)
+	PostMetricsCtx(ctx context.Context, metrics MetricList) (successful int,
+		err error)
+	PostMetricsResult(ctx context.Context, metrics MetricList) (PostResult, error)
+	GetMetricNames(metricName string, offset, limit int) (names []string,
+		err error)
+	GetMetricNamesCtx(ctx context.Context, metricName string, offset,
+		limit int) (names []string, err error)
+	GetMetricValues(metricName string, aggregator string, aggregatorCol,
+		groupInterval string, from, to float64, filterCondition string, offset,
+		limit int) (metrics MetricList, err error)
+	GetMetricValuesCtx(ctx context.Context, metricName string, aggregator string,
+		aggregatorCol, groupInterval string, from, to float64,
+		filterCondition string, offset, limit int) (metrics MetricList, err error)
+	GetMetricSeries(metricName string, aggregator string, aggregatorCol,
+		groupInterval string, from, to float64, filterCondition string, offset,
+		limit int) ([]MetricList, error)
+	GetMetricSeriesCtx(ctx context.Context, metricName string, aggregator string,
+		aggregatorCol, groupInterval string, from, to float64,
+		filterCondition string, offset, limit int) (series []MetricList, err error)
+	DeleteMetrics(metricName string) (bool, error)
+	DeleteMetricsCtx(ctx context.Context, metricName string) (bool, error)
+}
+
+// AlertsAPI creates, retrieves, updates and deletes alerts.
+type AlertsAPI interface {
+	PostAlert(alert Alert) (successful int, err error)
+	PostAlertCtx(ctx context.Context, alert Alert) (successful int, err error)
+	GetAlerts() (total int, alerts []Alert, err error)
+	GetAlertsCtx(ctx context.Context) (total int, alerts []Alert, err error)
+	GetAlert(id int64) (alert Alert, err error)
+	GetAlertCtx(ctx context.Context, id int64) (alert Alert, err error)
+	PutAlert(id int64, alert Alert) (successful int, err error)
+	PutAlertCtx(ctx context.Context, id int64, alert Alert) (successful int,
+		err error)
+	DeleteAlert(id int64) (successful int, err error)
+	DeleteAlertCtx(ctx context.Context, id int64) (successful int, err error)
+}
+
+// TrigalertsAPI retrieves the alerts which were triggered.
+type TrigalertsAPI interface {
+	GetTrigalert() (trigalert map[string]interface{}, err error)
+	GetTrigalertCtx(ctx context.Context) (trigalert map[string]interface{},
+		err error)
+	GetTrigalertLast24() (trigalert map[string]interface{}, err error)
+	GetTrigalertLast24Ctx(ctx context.Context) (
+		trigalert map[string]interface{}, err error)
+}
+
+// DataAPI sends and retrieves logs and metrics.
+type DataAPI interface {
+	LogsAPI
+	MetricsAPI
+}
+
+// API is every operation of a bucket.
+type API interface {
+	LogsAPI
+	MetricsAPI
+	AlertsAPI
+	TrigalertsAPI
+}
+
+var (
+	_ API = (*Zeus)(nil)
+	_ API = (*Bucket)(nil)
+)
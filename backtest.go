@@ -0,0 +1,369 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BacktestConfig sets when an alert expression is evaluated by Backtest:
+// every Frequency from From to To. Each evaluation sees the values of the
+// last Frequency, as Zeus does when it evaluates an alert.
+type BacktestConfig struct {
+	From time.Time
+	// To defaults to now.
+	To        time.Time
+	Frequency time.Duration
+}
+
+// Trigger is an evaluation at which the expression held, so that the alert
+// would have been triggered.
+type Trigger struct {
+	Time time.Time
+	// Value is the left operand of the comparison which held, such as the
+	// value of cpu.value for "cpu.value > 20".
+	Value float64
+	// Values holds the value of each metric reference and aggregator call
+	// of the expression, keyed by its canonical form, such as "cpu.value" or
+	// "mean(cpu.value)".
+	Values map[string]float64
+}
+
+// BacktestResult tells how often an alert expression would have held.
+type BacktestResult struct {
+	Evaluations int
+	// Unknown counts the evaluations which lacked the values to decide, a
+	// metric having no value in the window, or a number being divided by
+	// zero.
+	Unknown  int
+	Triggers []Trigger
+}
+
+func (config BacktestConfig) validate() error {
+	switch {
+	case config.Frequency <= 0:
+		return &ValidationError{Field: "frequency", Reason: "must be positive"}
+	case config.From.IsZero():
+		return &ValidationError{Field: "from", Reason: "is required"}
+	case !config.To.IsZero() && config.To.Before(config.From):
+		return &ValidationError{Field: "to", Reason: "is before from"}
+	}
+	return nil
+}
+
+// Backtest evaluates expr over metrics, reporting when it would have
+// triggered an alert. Metric references resolve as for CheckAlert: "cpu"
+// refers to the metric cpu, which must have a single column or one named
+// "value", and "cpu.user" to the column user of cpu, unless a metric is
+// named cpu.user. A reference takes the latest value of the window, and an
+// aggregator call aggregates every value of the window. The count of an
+// empty window is zero; any other value missing makes the evaluation
+// unknown, as does a division by zero, unless the rest of the expression
+// decides it, as in "cpu.value > 20 or mem.value > 20".
+func Backtest(expr AlertExpr, config BacktestConfig, metrics ...MetricList) (
+	BacktestResult, error) {
+	if err := config.validate(); err != nil {
+		return BacktestResult{}, err
+	}
+	if config.To.IsZero() {
+		config.To = time.Now()
+	}
+	columns := make(map[string]*timeline)
+	for _, ref := range MetricRefs(expr) {
+		column, err := resolveColumn(ref, metrics)
+		if err != nil {
+			return BacktestResult{}, err
+		}
+		columns[ref] = column
+	}
+
+	var result BacktestResult
+	step := config.Frequency
+	for at := config.From.Add(step); !at.After(config.To); at = at.Add(step) {
+		eval := &evaluation{
+			columns: columns,
+			from:    UnixSeconds(at.Add(-step)),
+			to:      UnixSeconds(at),
+			values:  make(map[string]float64),
+		}
+		held, known, value := eval.condition(expr)
+		result.Evaluations++
+		switch {
+		case !known:
+			result.Unknown++
+		case held:
+			result.Triggers = append(result.Triggers,
+				Trigger{Time: at, Value: value, Values: eval.values})
+		}
+	}
+	return result, nil
+}
+
+// BacktestAlert backtests the expression of alert over the values of the
+// metrics it refers to, which it checks and retrieves with api.
+// config.Frequency defaults to the frequency of the alert.
+func BacktestAlert(ctx context.Context, api MetricsAPI, alert Alert,
+	config BacktestConfig) (BacktestResult, error) {
+	if config.Frequency == 0 {
+		config.Frequency = time.Duration(alert.Frequency * float64(time.Second))
+	}
+	if config.To.IsZero() {
+		config.To = time.Now()
+	}
+	if err := config.validate(); err != nil {
+		return BacktestResult{}, err
+	}
+	expr, names, err := alertMetrics(ctx, api, alert)
+	if err != nil {
+		return BacktestResult{}, err
+	}
+	metrics := make([]MetricList, len(names))
+	for i, name := range names {
+		columns, err := metricColumns(ctx, api, name)
+		if err != nil {
+			return BacktestResult{}, err
+		}
+		metrics[i] = MetricList{Name: name, Columns: columns}
+		query := NewMetricQuery(name).Between(config.From, config.To)
+		cursor := metricValueCursor(ctx, api, query)
+		for cursor.Next() {
+			metrics[i].Metrics = append(metrics[i].Metrics, cursor.Value())
+		}
+		if err := cursor.Err(); err != nil {
+			return BacktestResult{}, err
+		}
+	}
+	return Backtest(expr, config, metrics...)
+}
+
+// timeline holds the values of a column, in chronological order.
+type timeline struct {
+	times  []float64
+	values []float64
+}
+
+// window returns the values of the timeline after from, until to.
+func (line *timeline) window(from, to float64) []float64 {
+	start := sort.SearchFloat64s(line.times, math.Nextafter(from, math.Inf(1)))
+	end := sort.SearchFloat64s(line.times, math.Nextafter(to, math.Inf(1)))
+	return line.values[start:end]
+}
+
+// resolveColumn returns the timeline of the column ref refers to.
+func resolveColumn(ref string, metrics []MetricList) (*timeline, error) {
+	for _, candidate := range metricCandidates(ref) {
+		for _, metric := range metrics {
+			if metric.Name != candidate {
+				continue
+			}
+			idx := -1
+			if candidate == ref {
+				idx = metricColumn(metric.Columns, "value")
+				if len(metric.Columns) == 1 {
+					idx = 0
+				}
+			} else {
+				idx = metricColumn(metric.Columns,
+					strings.TrimPrefix(ref, candidate+"."))
+			}
+			if idx < 0 {
+				continue
+			}
+			return newTimeline(metric, idx), nil
+		}
+	}
+	return nil, &ValidationError{Field: "alert_expression",
+		Reason: fmt.Sprintf("no metric %q", ref)}
+}
+
+func metricColumn(columns []string, name string) int {
+	for idx, column := range columns {
+		if column == name {
+			return idx
+		}
+	}
+	return -1
+}
+
+func newTimeline(metric MetricList, idx int) *timeline {
+	points := make([]Metric, len(metric.Metrics))
+	copy(points, metric.Metrics)
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].Timestamp < points[j].Timestamp
+	})
+	line := &timeline{}
+	for _, point := range points {
+		if value, ok := point.Value(idx); ok {
+			line.times = append(line.times, point.Timestamp)
+			line.values = append(line.values, value)
+		}
+	}
+	return line
+}
+
+// evaluation evaluates an expression over a window of the columns it
+// refers to, recording the values of references and calls.
+type evaluation struct {
+	columns  map[string]*timeline
+	from, to float64
+	values   map[string]float64
+}
+
+// condition evaluates a condition. known is false when it can't be decided,
+// and value is the left operand of the comparison which decided it.
+func (eval *evaluation) condition(expr AlertExpr) (held, known bool,
+	value float64) {
+	switch node := expr.(type) {
+	case *UnaryExpr:
+		held, known, value = eval.condition(node.X)
+		return !held && known, known, value
+	case *BinaryExpr:
+		switch node.Op {
+		case "and", "or":
+			decisive := node.Op == "or"
+			xHeld, xKnown, xValue := eval.condition(node.X)
+			yHeld, yKnown, yValue := eval.condition(node.Y)
+			switch {
+			case xKnown && xHeld == decisive:
+				return decisive, true, xValue
+			case yKnown && yHeld == decisive:
+				return decisive, true, yValue
+			}
+			return !decisive, xKnown && yKnown, xValue
+		}
+		x, xKnown := eval.number(node.X)
+		y, yKnown := eval.number(node.Y)
+		if !xKnown || !yKnown {
+			return false, false, x
+		}
+		return compare(node.Op, x, y), true, x
+	}
+	return false, false, 0
+}
+
+func compare(op string, x, y float64) bool {
+	switch op {
+	case ">":
+		return x > y
+	case ">=":
+		return x >= y
+	case "<":
+		return x < y
+	case "<=":
+		return x <= y
+	case "==":
+		return x == y
+	}
+	return x != y
+}
+
+// number evaluates a number, known being false when a value is missing.
+func (eval *evaluation) number(expr AlertExpr) (value float64, known bool) {
+	switch node := expr.(type) {
+	case *NumberLit:
+		return node.Value, true
+	case *MetricRef:
+		values := eval.columns[node.Name].window(eval.from, eval.to)
+		if len(values) == 0 {
+			return 0, false
+		}
+		value = values[len(values)-1]
+	case *CallExpr:
+		values := eval.columns[node.Arg.Name].window(eval.from, eval.to)
+		if len(values) == 0 && node.Func != Count {
+			return 0, false
+		}
+		value = aggregate(node.Func, values)
+	case *UnaryExpr:
+		value, known = eval.number(node.X)
+		return -value, known
+	case *BinaryExpr:
+		x, xKnown := eval.number(node.X)
+		y, yKnown := eval.number(node.Y)
+		divided := node.Op == "/" || node.Op == "%"
+		if !xKnown || !yKnown || (divided && y == 0) {
+			return 0, false
+		}
+		switch node.Op {
+		case "+":
+			return x + y, true
+		case "-":
+			return x - y, true
+		case "*":
+			return x * y, true
+		case "/":
+			return x / y, true
+		}
+		return math.Mod(x, y), true
+	}
+	eval.values[expr.String()] = value
+	return value, true
+}
+
+// aggregate applies fn to values, which may only be empty for Count.
+func aggregate(fn Aggregator, values []float64) float64 {
+	switch fn {
+	case Count:
+		return float64(len(values))
+	case Min:
+		result := values[0]
+		for _, value := range values[1:] {
+			result = math.Min(result, value)
+		}
+		return result
+	case Max:
+		result := values[0]
+		for _, value := range values[1:] {
+			result = math.Max(result, value)
+		}
+		return result
+	case Sum, Mean:
+		var sum float64
+		for _, value := range values {
+			sum += value
+		}
+		if fn == Mean {
+			return sum / float64(len(values))
+		}
+		return sum
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	if fn == Median {
+		middle := len(sorted) / 2
+		if len(sorted)%2 == 0 {
+			return (sorted[middle-1] + sorted[middle]) / 2
+		}
+		return sorted[middle]
+	}
+	// Mode: the most frequent value, the least of them on ties.
+	mode, best := sorted[0], 0
+	for start := 0; start < len(sorted); {
+		end := start
+		for end < len(sorted) && sorted[end] == sorted[start] {
+			end++
+		}
+		if end-start > best {
+			mode, best = sorted[start], end-start
+		}
+		start = end
+	}
+	return mode
+}
@@ -0,0 +1,188 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cpuMetrics has a value every 10s from 1000 to 1090, user being 10 times
+// the index of the value, and system missing from the 5th value on.
+func cpuMetrics() MetricList {
+	metrics := MetricList{Name: "cpu", Columns: []string{"user", "system"}}
+	for i := 9; i >= 0; i-- {
+		metric := Metric{Timestamp: float64(1000 + 10*i),
+			Point: []float64{float64(10 * i), 1}}
+		if i >= 5 {
+			metric.SetMissing(1)
+		}
+		metrics.Metrics = append(metrics.Metrics, metric)
+	}
+	return metrics
+}
+
+func triggerTimes(result BacktestResult) []int64 {
+	var times []int64
+	for _, trigger := range result.Triggers {
+		times = append(times, trigger.Time.Unix())
+	}
+	return times
+}
+
+func TestBacktest(t *testing.T) {
+	config := BacktestConfig{From: time.Unix(1000, 0), To: time.Unix(1090, 0),
+		Frequency: 20 * time.Second}
+	mem := MetricList{Name: "mem", Columns: []string{"used"},
+		Metrics: []Metric{{Timestamp: 1030, Point: []float64{3}}}}
+	for expr, expected := range map[string]struct {
+		times   []int64
+		unknown int
+		value   float64
+		values  map[string]float64
+	}{
+		// Windows are (1000, 1020], (1020, 1040] ... (1060, 1080].
+		"cpu.user > 50": {[]int64{1060, 1080}, 0, 60,
+			map[string]float64{"cpu.user": 60}},
+		"mean(cpu.user) >= 50": {[]int64{1060, 1080}, 0, 55,
+			map[string]float64{"mean(cpu.user)": 55}},
+		"count(cpu.system) < 1": {[]int64{1060, 1080}, 0, 0,
+			map[string]float64{"count(cpu.system)": 0}},
+		"cpu.system == 1": {[]int64{1020, 1040}, 2, 1,
+			map[string]float64{"cpu.system": 1}},
+		"cpu.user > 70 or cpu.system > 0": {[]int64{1020, 1040, 1080}, 1, 1,
+			map[string]float64{"cpu.user": 20, "cpu.system": 1}},
+		"mem > 0 and cpu.user < 50": {[]int64{1040}, 1, 3,
+			map[string]float64{"mem": 3, "cpu.user": 40}},
+		"not cpu.user / (cpu.user - 20) < 2": {[]int64{1040}, 1, 2,
+			map[string]float64{"cpu.user": 40}},
+	} {
+		parsed, err := ParseAlertExpression(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := Backtest(parsed, config, cpuMetrics(), mem)
+		if err != nil {
+			t.Errorf("%s: %v", expr, err)
+			continue
+		}
+		if result.Evaluations != 4 || result.Unknown != expected.unknown ||
+			!reflect.DeepEqual(triggerTimes(result), expected.times) {
+			t.Errorf("%s: wrong result: %+v", expr, result)
+			continue
+		}
+		first := result.Triggers[0]
+		if first.Value != expected.value ||
+			!reflect.DeepEqual(first.Values, expected.values) {
+			t.Errorf("%s: wrong first trigger: %+v", expr, first)
+		}
+	}
+
+	parsed, _ := ParseAlertExpression("cpu.idle > 1")
+	var validationErr *ValidationError
+	if _, err := Backtest(parsed, config, cpuMetrics()); !errors.As(err,
+		&validationErr) || validationErr.Field != "alert_expression" {
+		t.Error("expected an unknown column to fail, got", err)
+	}
+	parsed, _ = ParseAlertExpression("cpu > 1")
+	if _, err := Backtest(parsed, config, cpuMetrics()); err == nil {
+		t.Error("expected a metric of several columns to need one")
+	}
+	for field, config := range map[string]BacktestConfig{
+		"frequency": {From: config.From},
+		"from":      {Frequency: time.Second},
+		"to": {From: config.From, To: config.From.Add(-time.Second),
+			Frequency: time.Second},
+	} {
+		if _, err := Backtest(parsed, config); !errors.As(err,
+			&validationErr) || validationErr.Field != field {
+			t.Errorf("expected a validation error on %s, got %v", field, err)
+		}
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	values := []float64{3, 1, 4, 1, 5, 9, 2, 6}
+	for fn, expected := range map[Aggregator]float64{
+		Count: 8, Min: 1, Max: 9, Sum: 31, Mean: 3.875, Mode: 1, Median: 3.5,
+	} {
+		if value := aggregate(fn, values); value != expected {
+			t.Errorf("%s: expected %v, got %v", fn, expected, value)
+		}
+	}
+	if value := aggregate(Median, values[:5]); value != 3 {
+		t.Error("wrong median of an odd count:", value)
+	}
+	if value := aggregate(Count, nil); value != 0 {
+		t.Error("wrong count of no values:", value)
+	}
+}
+
+func TestBacktestAlert(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			requests = append(requests, r.URL.Path+"?"+query.Encode())
+			if strings.HasSuffix(r.URL.Path, "/_names/") {
+				json.NewEncoder(w).Encode([]string{"cpu"})
+				return
+			}
+			offset, _ := strconv.Atoi(query.Get("offset"))
+			limit, _ := strconv.Atoi(query.Get("limit"))
+			points := [][]interface{}{}
+			for i := 9 - offset; i >= 0 && len(points) < limit; i-- {
+				points = append(points,
+					[]interface{}{1000 + 10*i, 10 * i, nil})
+			}
+			json.NewEncoder(w).Encode([]interface{}{map[string]interface{}{
+				"name": "cpu", "columns": []string{"time", "user", "system"},
+				"points": points}})
+		}))
+	defer server.Close()
+	bucket := (&Zeus{ApiServ: server.URL, Token: "goZeus"}).Bucket("b")
+
+	alert := Alert{Metric_name: "cpu", Alert_expression: "cpu.user > 50",
+		Frequency: 20}
+	result, err := BacktestAlert(context.Background(), bucket, alert,
+		BacktestConfig{From: time.Unix(1000, 0), To: time.Unix(1090, 0)})
+	if err != nil {
+		t.Fatal("failed to backtest:", err)
+	}
+	if result.Evaluations != 4 ||
+		!reflect.DeepEqual(triggerTimes(result), []int64{1060, 1080}) {
+		t.Errorf("wrong result: %+v", result)
+	}
+	if len(requests) != 3 || !strings.Contains(requests[2],
+		"from=1000.000") || !strings.Contains(requests[2], "to=1090.000") {
+		t.Error("wrong requests:", requests)
+	}
+
+	alert.Alert_expression = "mem.used > 1"
+	var validationErr *ValidationError
+	if _, err := BacktestAlert(context.Background(), bucket, alert,
+		BacktestConfig{From: time.Unix(1000, 0)}); !errors.As(err,
+		&validationErr) || validationErr.Field != "alert_expression" {
+		t.Error("expected an unknown metric to fail, got", err)
+	}
+}
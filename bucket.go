@@ -0,0 +1,337 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Bucket is a handle to one "organization/bucket" of a Zeus client. It
+// carries its own bucket name and never modifies the Zeus it was created
+// from, so one client can serve many goroutines and buckets at once.
+type Bucket struct {
+	zeus *Zeus
+	name string
+}
+
+// Bucket returns a handle for the given "organization/bucket" name. An empty
+// name selects the default bucket set with WithBucket.
+func (zeus *Zeus) Bucket(organizationAndBucket string) *Bucket {
+	if organizationAndBucket == "" {
+		organizationAndBucket = zeus.defaultBucket
+	}
+	return &Bucket{zeus: zeus, name: organizationAndBucket}
+}
+
+// Name returns the "organization/bucket" name of the handle.
+func (bucket *Bucket) Name() string {
+	return bucket.name
+}
+
+// request sends a request to the bucket, retrying it as allowed by the
+// retry policy of the client. A response with a non-2xx status is returned
+// together with an *APIError.
+func (bucket *Bucket) request(ctx context.Context, method, urlStr string,
+	data *url.Values) (
+	responseBody []byte, responseStatus int, err error) {
+	if bucket.name == "" {
+		return []byte{}, 0, errors.New("bucket name is empty")
+	}
+
+	if data == nil {
+		data = &url.Values{}
+	}
+
+	policy := bucket.zeus.retry
+	for attempt := 1; ; attempt++ {
+		var retryAfter time.Duration
+		responseBody, responseStatus, retryAfter, err = bucket.send(ctx, method,
+			urlStr, data)
+		if ctx.Err() != nil ||
+			!policy.shouldRetry(method, attempt, responseStatus, retryAfter, err) {
+			return
+		}
+		if err := policy.wait(ctx, attempt, retryAfter); err != nil {
+			return []byte{}, 0, err
+		}
+	}
+}
+
+// send makes a single attempt of a request. It also returns the delay asked
+// for by a Retry-After header, if any.
+func (bucket *Bucket) send(ctx context.Context, method, urlStr string,
+	data *url.Values) (
+	responseBody []byte, responseStatus int, retryAfter time.Duration, err error) {
+	body := strings.NewReader(data.Encode())
+
+	var request *http.Request
+	if method == "GET" {
+		request, err = http.NewRequestWithContext(ctx, "GET", urlStr+"?"+data.Encode(), nil)
+	} else if method == "POST" {
+		request, err = http.NewRequestWithContext(ctx, "POST", urlStr, body)
+	} else if method == "PUT" {
+		request, err = http.NewRequestWithContext(ctx, "PUT", urlStr, body)
+		request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	} else if method == "DELETE" {
+		request, err = http.NewRequestWithContext(ctx, "DELETE", urlStr, body)
+	}
+	if err != nil {
+		return []byte{}, 0, 0, err
+	}
+	for key, values := range bucket.zeus.header {
+		for _, value := range values {
+			request.Header.Add(key, value)
+		}
+	}
+	if bucket.zeus.userAgent != "" {
+		request.Header.Set("User-Agent", bucket.zeus.userAgent)
+	}
+	request.Header.Set("Authorization", "Bearer "+bucket.zeus.Token)
+	request.Header.Set("Bucket-Name", bucket.name)
+
+	response, err := bucket.zeus.httpClient().Do(request)
+	if err != nil {
+		return []byte{}, 0, 0, err
+	}
+
+	responseBody, err = ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return []byte{}, 0, 0, err
+	}
+
+	responseStatus = response.StatusCode
+	if responseStatus < 200 || responseStatus > 299 {
+		retryAfter = parseRetryAfter(response.Header.Get("Retry-After"))
+		return responseBody, responseStatus, retryAfter, newAPIError(method,
+			request.URL.String(), bucket.zeus.Token, responseStatus, responseBody)
+	}
+	return
+}
+
+// bucket returns a copy of zeus whose calls use the given bucket. It is kept
+// for the chained API, zeus.bucket("org1/bucket1").GetLogs(); prefer Bucket.
+// zeus itself is left unchanged, so that it can be shared between
+// goroutines.
+func (zeus *Zeus) bucket(organization_and_bucket string) *Zeus {
+	chained := *zeus
+	chained.OrganizationAndBucket = organization_and_bucket
+	return &chained
+}
+
+// current returns the bucket of the calls made on zeus: OrganizationAndBucket,
+// or the default bucket set with WithBucket when it is empty.
+func (zeus *Zeus) current() *Bucket {
+	return zeus.Bucket(zeus.OrganizationAndBucket)
+}
+
+// PostAlert sends a alert using the bucket set by zeus.bucket().
+func (zeus *Zeus) PostAlert(alert Alert) (successful int, err error) {
+	return zeus.current().PostAlert(alert)
+}
+
+// PostAlertCtx is like PostAlert but carries ctx into the HTTP request.
+func (zeus *Zeus) PostAlertCtx(ctx context.Context, alert Alert) (
+	successful int, err error) {
+	return zeus.current().PostAlertCtx(ctx, alert)
+}
+
+// GetAlerts returns list of alert using the bucket set by zeus.bucket().
+func (zeus *Zeus) GetAlerts() (total int, alerts []Alert, err error) {
+	return zeus.current().GetAlerts()
+}
+
+// GetAlertsCtx is like GetAlerts but carries ctx into the HTTP request.
+func (zeus *Zeus) GetAlertsCtx(ctx context.Context) (total int, alerts []Alert,
+	err error) {
+	return zeus.current().GetAlertsCtx(ctx)
+}
+
+// PutAlert update alert which is specified with id using the bucket set by
+// zeus.bucket().
+func (zeus *Zeus) PutAlert(id int64, alert Alert) (successful int, err error) {
+	return zeus.current().PutAlert(id, alert)
+}
+
+// PutAlertCtx is like PutAlert but carries ctx into the HTTP request.
+func (zeus *Zeus) PutAlertCtx(ctx context.Context, id int64, alert Alert) (
+	successful int, err error) {
+	return zeus.current().PutAlertCtx(ctx, id, alert)
+}
+
+// GetAlert returns a alert by id using the bucket set by zeus.bucket().
+func (zeus *Zeus) GetAlert(id int64) (alert Alert, err error) {
+	return zeus.current().GetAlert(id)
+}
+
+// GetAlertCtx is like GetAlert but carries ctx into the HTTP request.
+func (zeus *Zeus) GetAlertCtx(ctx context.Context, id int64) (alert Alert,
+	err error) {
+	return zeus.current().GetAlertCtx(ctx, id)
+}
+
+// DeleteAlert delete a alert which is specified with id using the bucket set
+// by zeus.bucket().
+func (zeus *Zeus) DeleteAlert(id int64) (successful int, err error) {
+	return zeus.current().DeleteAlert(id)
+}
+
+// DeleteAlertCtx is like DeleteAlert but carries ctx into the HTTP request.
+func (zeus *Zeus) DeleteAlertCtx(ctx context.Context, id int64) (
+	successful int, err error) {
+	return zeus.current().DeleteAlertCtx(ctx, id)
+}
+
+// GetLogs returns a list of logs using the bucket set by zeus.bucket(). See
+// Bucket.GetLogs.
+func (zeus *Zeus) GetLogs(logName, field, pattern string, from, to int64,
+	offset, limit int) (total int, logs LogList, err error) {
+	return zeus.current().GetLogs(logName, field, pattern, from, to, offset, limit)
+}
+
+// GetLogsCtx is like GetLogs but carries ctx into the HTTP request.
+func (zeus *Zeus) GetLogsCtx(ctx context.Context, logName, field,
+	pattern string, from, to int64, offset, limit int) (total int,
+	logs LogList, err error) {
+	return zeus.current().GetLogsCtx(ctx, logName, field, pattern, from, to,
+		offset, limit)
+}
+
+// PostLogs sends a list of logs using the bucket set by zeus.bucket().
+func (zeus *Zeus) PostLogs(logs LogList) (successful int, err error) {
+	return zeus.current().PostLogs(logs)
+}
+
+// PostLogsCtx is like PostLogs but carries ctx into the HTTP request.
+func (zeus *Zeus) PostLogsCtx(ctx context.Context, logs LogList) (
+	successful int, err error) {
+	return zeus.current().PostLogsCtx(ctx, logs)
+}
+
+// PostLogsResult is like PostLogs but reports accepted and rejected logs.
+func (zeus *Zeus) PostLogsResult(ctx context.Context, logs LogList) (
+	PostResult, error) {
+	return zeus.current().PostLogsResult(ctx, logs)
+}
+
+// PostMetrics sends a list of points using the bucket set by zeus.bucket().
+func (zeus *Zeus) PostMetrics(metrics MetricList) (successful int, err error) {
+	return zeus.current().PostMetrics(metrics)
+}
+
+// PostMetricsCtx is like PostMetrics but carries ctx into the HTTP request.
+func (zeus *Zeus) PostMetricsCtx(ctx context.Context, metrics MetricList) (
+	successful int, err error) {
+	return zeus.current().PostMetricsCtx(ctx, metrics)
+}
+
+// PostMetricsResult is like PostMetrics but reports accepted and rejected
+// points.
+func (zeus *Zeus) PostMetricsResult(ctx context.Context, metrics MetricList) (
+	PostResult, error) {
+	return zeus.current().PostMetricsResult(ctx, metrics)
+}
+
+// GetMetricNames returns metric names using the bucket set by zeus.bucket().
+func (zeus *Zeus) GetMetricNames(metricName string, offset, limit int) (
+	names []string, err error) {
+	return zeus.current().GetMetricNames(metricName, offset, limit)
+}
+
+// GetMetricNamesCtx is like GetMetricNames but carries ctx into the HTTP
+// request.
+func (zeus *Zeus) GetMetricNamesCtx(ctx context.Context, metricName string,
+	offset, limit int) (names []string, err error) {
+	return zeus.current().GetMetricNamesCtx(ctx, metricName, offset, limit)
+}
+
+// GetMetricValues returns metric values using the bucket set by
+// zeus.bucket(). See Bucket.GetMetricValues.
+func (zeus *Zeus) GetMetricValues(metricName string, aggregator string,
+	aggregatorCol, groupInterval string, from, to float64, filterCondition string,
+	offset, limit int) (metrics MetricList, err error) {
+	return zeus.current().GetMetricValues(metricName, aggregator, aggregatorCol,
+		groupInterval, from, to, filterCondition, offset, limit)
+}
+
+// GetMetricValuesCtx is like GetMetricValues but carries ctx into the HTTP
+// request.
+func (zeus *Zeus) GetMetricValuesCtx(ctx context.Context, metricName string,
+	aggregator string, aggregatorCol, groupInterval string, from, to float64,
+	filterCondition string, offset, limit int) (metrics MetricList, err error) {
+	return zeus.current().GetMetricValuesCtx(ctx, metricName, aggregator,
+		aggregatorCol, groupInterval, from, to, filterCondition, offset, limit)
+}
+
+// GetMetricSeries returns every series of metric values using the bucket set
+// by zeus.bucket(). See Bucket.GetMetricSeries.
+func (zeus *Zeus) GetMetricSeries(metricName string, aggregator string,
+	aggregatorCol, groupInterval string, from, to float64, filterCondition string,
+	offset, limit int) ([]MetricList, error) {
+	return zeus.current().GetMetricSeries(metricName, aggregator, aggregatorCol,
+		groupInterval, from, to, filterCondition, offset, limit)
+}
+
+// GetMetricSeriesCtx is like GetMetricSeries but carries ctx into the HTTP
+// request.
+func (zeus *Zeus) GetMetricSeriesCtx(ctx context.Context, metricName string,
+	aggregator string, aggregatorCol, groupInterval string, from, to float64,
+	filterCondition string, offset, limit int) ([]MetricList, error) {
+	return zeus.current().GetMetricSeriesCtx(ctx, metricName, aggregator,
+		aggregatorCol, groupInterval, from, to, filterCondition, offset, limit)
+}
+
+// DeleteMetrics deletes one entire series using the bucket set by
+// zeus.bucket().
+func (zeus *Zeus) DeleteMetrics(metricName string) (bool, error) {
+	return zeus.current().DeleteMetrics(metricName)
+}
+
+// DeleteMetricsCtx is like DeleteMetrics but carries ctx into the HTTP
+// request.
+func (zeus *Zeus) DeleteMetricsCtx(ctx context.Context, metricName string) (
+	bool, error) {
+	return zeus.current().DeleteMetricsCtx(ctx, metricName)
+}
+
+// GetTrigalert returns a trigalert using the bucket set by zeus.bucket().
+func (zeus *Zeus) GetTrigalert() (trigalert map[string]interface{}, err error) {
+	return zeus.current().GetTrigalert()
+}
+
+// GetTrigalertCtx is like GetTrigalert but carries ctx into the HTTP request.
+func (zeus *Zeus) GetTrigalertCtx(ctx context.Context) (
+	trigalert map[string]interface{}, err error) {
+	return zeus.current().GetTrigalertCtx(ctx)
+}
+
+// GetTrigalertLast24 returns a trigalert of last24 using the bucket set by
+// zeus.bucket().
+func (zeus *Zeus) GetTrigalertLast24() (trigalert map[string]interface{}, err error) {
+	return zeus.current().GetTrigalertLast24()
+}
+
+// GetTrigalertLast24Ctx is like GetTrigalertLast24 but carries ctx into the
+// HTTP request.
+func (zeus *Zeus) GetTrigalertLast24Ctx(ctx context.Context) (
+	trigalert map[string]interface{}, err error) {
+	return zeus.current().GetTrigalertLast24Ctx(ctx)
+}
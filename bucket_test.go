@@ -0,0 +1,114 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestBucketConcurrent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			// Echo the bucket back as the log message so the caller can
+			// check that its request carried its own bucket.
+			fmt.Fprintf(w, `{"total": 1, "result": [{"message": "%s"}]}`,
+				r.Header.Get("Bucket-Name"))
+		}))
+	defer server.Close()
+
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+	names := []string{"org1/bucket1", "org1/bucket2", "org2/bucket1"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			bucket := zeus.Bucket(name)
+			_, logs, err := bucket.GetLogs("syslog", "", "", 0, 0, 0, 0)
+			if err != nil {
+				t.Error("failed to retrieve logs:", err)
+				return
+			}
+			if logs.Logs[0]["message"] != name {
+				t.Errorf("request for %s was sent to %v", name, logs.Logs[0]["message"])
+			}
+		}(names[i%len(names)])
+	}
+	wg.Wait()
+
+	if zeus.OrganizationAndBucket != "" {
+		t.Error("Bucket should not modify the client")
+	}
+}
+
+func TestBucketEmptyName(t *testing.T) {
+	zeus := &Zeus{ApiServ: "http://127.0.0.1:1", Token: "goZeus"}
+	if _, _, err := zeus.Bucket("").GetLogs("syslog", "", "", 0, 0, 0, 0); err == nil {
+		t.Error("should fail on empty bucket name")
+	}
+	if _, _, err := zeus.GetLogs("syslog", "", "", 0, 0, 0, 0); err == nil {
+		t.Error("should fail when zeus.bucket() was not called")
+	}
+	if name := zeus.Bucket("org1/bucket1").Name(); name != "org1/bucket1" {
+		t.Errorf("Name()=%s != org1/bucket1", name)
+	}
+}
+
+func TestZeusConcurrent(t *testing.T) {
+	var mu sync.Mutex
+	var names []string
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			names = append(names, r.Header.Get("Bucket-Name"))
+			mu.Unlock()
+			fmt.Fprintln(w, `{"successful": 1}`)
+		}))
+	defer server.Close()
+
+	zeus, _ := NewClient(server.URL, "goZeus", WithBucket("org1/bucket1"))
+	// Chained calls don't change the client shared by the shipper.
+	done := make(chan struct{})
+	go func() {
+		zeus.bucket("org1/bucket2").GetTrigalert()
+		close(done)
+	}()
+	var api LogsAPI = zeus
+	shipper := NewLogShipper(api, LogShipperConfig{MaxBatchSize: 1, Workers: 4})
+	for i := 0; i < 20; i++ {
+		shipper.Send("syslog", Log{"seq": i})
+	}
+	if err := shipper.Close(context.Background()); err != nil {
+		t.Fatal("failed to ship logs:", err)
+	}
+	<-done
+	mu.Lock()
+	defer mu.Unlock()
+	count := 0
+	for _, name := range names {
+		if name == "org1/bucket1" {
+			count++
+		}
+	}
+	if count != 20 {
+		t.Errorf("expected 20 posts to org1/bucket1, got %v", names)
+	}
+}
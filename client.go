@@ -0,0 +1,136 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Option configures a Zeus client built by NewClient.
+type Option func(zeus *Zeus) error
+
+// NewClient returns a Zeus client for the rest api at apiServ, authenticated
+// with token and configured by opts. A Zeus struct literal is equivalent to
+// NewClient without options.
+func NewClient(apiServ, token string, opts ...Option) (*Zeus, error) {
+	zeus := &Zeus{ApiServ: apiServ, Token: token}
+	for _, opt := range opts {
+		if err := opt(zeus); err != nil {
+			return nil, err
+		}
+	}
+	return zeus, nil
+}
+
+// WithHTTPClient makes the client send its requests through client instead
+// of http.DefaultClient.
+func WithHTTPClient(client *http.Client) Option {
+	return func(zeus *Zeus) error {
+		if client == nil {
+			return errors.New("HTTP client is nil")
+		}
+		zeus.client = client
+		return nil
+	}
+}
+
+// WithTransport sets the transport of the HTTP client, e.g. to configure
+// proxies or connection pool limits.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(zeus *Zeus) error {
+		if transport == nil {
+			return errors.New("transport is nil")
+		}
+		client := zeus.copyClient()
+		client.Transport = transport
+		return nil
+	}
+}
+
+// WithTimeout sets the time limit of every request sent by the client,
+// including reading the response body.
+func WithTimeout(timeout time.Duration) Option {
+	return func(zeus *Zeus) error {
+		zeus.copyClient().Timeout = timeout
+		return nil
+	}
+}
+
+// WithTLSConfig sets the TLS configuration, e.g. a custom CA pool or client
+// certificates. It requires the transport to be an *http.Transport.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(zeus *Zeus) error {
+		client := zeus.copyClient()
+		base := client.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		transport, ok := base.(*http.Transport)
+		if !ok {
+			return errors.New("TLS config requires an *http.Transport")
+		}
+		transport = transport.Clone()
+		transport.TLSClientConfig = config
+		client.Transport = transport
+		return nil
+	}
+}
+
+// WithUserAgent sets the User-Agent header of every request.
+func WithUserAgent(userAgent string) Option {
+	return func(zeus *Zeus) error {
+		zeus.userAgent = userAgent
+		return nil
+	}
+}
+
+// WithHeader adds a header to every request. Authorization and Bucket-Name
+// are always set by the client and can't be overridden.
+func WithHeader(key, value string) Option {
+	return func(zeus *Zeus) error {
+		if zeus.header == nil {
+			zeus.header = make(http.Header)
+		}
+		zeus.header.Add(key, value)
+		return nil
+	}
+}
+
+// WithBucket sets the "organization/bucket" used when no bucket is given to
+// zeus.bucket() or Zeus.Bucket.
+func WithBucket(organizationAndBucket string) Option {
+	return func(zeus *Zeus) error {
+		zeus.defaultBucket = organizationAndBucket
+		return nil
+	}
+}
+
+func (zeus *Zeus) httpClient() *http.Client {
+	if zeus.client == nil {
+		return http.DefaultClient
+	}
+	return zeus.client
+}
+
+// copyClient replaces the client with a copy which options can modify
+// without touching a client shared with other code.
+func (zeus *Zeus) copyClient() *http.Client {
+	client := *zeus.httpClient()
+	zeus.client = &client
+	return zeus.client
+}
@@ -0,0 +1,134 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type countingTransport struct {
+	count int
+}
+
+func (transport *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	transport.count++
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestNewClient(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			header = r.Header
+			fmt.Fprintln(w, `{"successful": 1}`)
+		}))
+	defer server.Close()
+
+	transport := &countingTransport{}
+	zeus, err := NewClient(server.URL, "goZeus",
+		WithTransport(transport),
+		WithTimeout(time.Second),
+		WithUserAgent("zeus-test/1.0"),
+		WithHeader("X-Request-Source", "unit-test"),
+		WithHeader("Authorization", "Basic override"),
+		WithBucket("org1/bucket1"))
+	if err != nil {
+		t.Fatal("failed to create client:", err)
+	}
+
+	logs := LogList{Name: "syslog", Logs: []Log{Log{"foo": "bar"}}}
+	if _, err := zeus.PostLogs(logs); err != nil {
+		t.Fatal("failed to post logs:", err)
+	}
+	if transport.count != 1 {
+		t.Errorf("transport was used %d times, expected 1", transport.count)
+	}
+	if header.Get("Bucket-Name") != "org1/bucket1" {
+		t.Error("default bucket was not used:", header.Get("Bucket-Name"))
+	}
+	if header.Get("User-Agent") != "zeus-test/1.0" {
+		t.Error("user agent was not set:", header.Get("User-Agent"))
+	}
+	if header.Get("X-Request-Source") != "unit-test" {
+		t.Error("base header was not sent")
+	}
+	if header.Get("Authorization") != "Bearer goZeus" {
+		t.Error("base headers should not override the token:", header.Get("Authorization"))
+	}
+
+	if _, err := zeus.bucket("org1/bucket2").PostLogs(logs); err != nil {
+		t.Fatal("failed to post logs:", err)
+	}
+	if header.Get("Bucket-Name") != "org1/bucket2" {
+		t.Error("zeus.bucket() should override the default bucket")
+	}
+	if http.DefaultClient.Timeout != 0 {
+		t.Error("options should not modify http.DefaultClient")
+	}
+}
+
+func TestNewClientTLS(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, `["cpu"]`)
+		}))
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	zeus, _ := NewClient(server.URL, "goZeus")
+	if _, err := zeus.Bucket("org1/bucket1").GetMetricNames("", 0, 0); err == nil {
+		t.Error("should fail on an unknown certificate authority")
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	zeus, err := NewClient(server.URL, "goZeus",
+		WithTLSConfig(&tls.Config{RootCAs: pool}))
+	if err != nil {
+		t.Fatal("failed to create client:", err)
+	}
+	names, err := zeus.Bucket("org1/bucket1").GetMetricNames("", 0, 0)
+	if err != nil || len(names) != 1 {
+		t.Error("failed to get metric names:", names, err)
+	}
+
+	_, err = NewClient(server.URL, "goZeus", WithTransport(&countingTransport{}),
+		WithTLSConfig(&tls.Config{}))
+	if err == nil {
+		t.Error("should fail to set TLS config on a custom transport")
+	}
+	if _, err := NewClient(server.URL, "goZeus", WithHTTPClient(nil)); err == nil {
+		t.Error("should fail on nil HTTP client")
+	}
+}
+
+func TestZeroValueClient(t *testing.T) {
+	zeus := Zeus{}
+	if _, err := zeus.Bucket("org1/bucket1").GetAlert(1); err == nil {
+		t.Error("should fail on empty token")
+	}
+	if zeus.httpClient() != http.DefaultClient {
+		t.Error("zero value should use http.DefaultClient")
+	}
+}
@@ -0,0 +1,281 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/CiscoZeus/go-zeusclient"
+)
+
+var alertHeaders = []string{"id", "name", "type", "metric", "severity",
+	"status", "frequency", "expression"}
+
+func alertRow(alert zeus.Alert) []string {
+	return []string{
+		strconv.FormatInt(alert.Id, 10),
+		alert.Alert_name,
+		alert.Alerts_type,
+		alert.Metric_name,
+		alert.Alert_severity,
+		alert.Status,
+		cell(alert.Frequency),
+		alert.Alert_expression,
+	}
+}
+
+// alertsList prints every alert.
+func alertsList(ctx context.Context, app *app, args []string) error {
+	flags := app.newFlags("alerts list", "")
+	if _, err := parse(flags, args, 0, 0); err != nil {
+		return err
+	}
+	_, alerts, err := app.bucket.GetAlertsCtx(ctx)
+	if err != nil {
+		return err
+	}
+	if alerts == nil {
+		alerts = []zeus.Alert{}
+	}
+	rows := make([][]string, len(alerts))
+	for i, alert := range alerts {
+		rows[i] = alertRow(alert)
+	}
+	return app.render(alertHeaders, rows, alerts)
+}
+
+// alertsGet prints one alert.
+func alertsGet(ctx context.Context, app *app, args []string) error {
+	flags := app.newFlags("alerts get", "ID")
+	args, err := parse(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	id, err := parseID(args[0])
+	if err != nil {
+		return err
+	}
+	alert, err := app.bucket.GetAlertCtx(ctx, id)
+	if err != nil {
+		return err
+	}
+	return app.render(alertHeaders, [][]string{alertRow(alert)}, alert)
+}
+
+// alertFlags adds the flags setting the fields of an alert, and returns a
+// function applying the flags given to an alert once they are parsed.
+func alertFlags(flags *flag.FlagSet) func(alert *zeus.Alert) {
+	setters := make(map[string]func(alert *zeus.Alert))
+	text := func(name, usage string, set func(alert *zeus.Alert, value string)) {
+		value := flags.String(name, "", usage)
+		setters[name] = func(alert *zeus.Alert) { set(alert, *value) }
+	}
+	text("name", "alert name",
+		func(alert *zeus.Alert, value string) { alert.Alert_name = value })
+	text("expression", `alert expression, such as "cpu.load > 0.9"`,
+		func(alert *zeus.Alert, value string) { alert.Alert_expression = value })
+	text("type", "alert type, such as metric",
+		func(alert *zeus.Alert, value string) { alert.Alerts_type = value })
+	text("metric", "metric name",
+		func(alert *zeus.Alert, value string) { alert.Metric_name = value })
+	text("severity", "alert severity",
+		func(alert *zeus.Alert, value string) { alert.Alert_severity = value })
+	text("emails", "emails notified",
+		func(alert *zeus.Alert, value string) { alert.Emails = value })
+	text("status", "alert status, such as active",
+		func(alert *zeus.Alert, value string) { alert.Status = value })
+	text("username", "user name",
+		func(alert *zeus.Alert, value string) { alert.Username = value })
+	frequency := flags.Float64("frequency", 0, "evaluation frequency, in seconds")
+	setters["frequency"] = func(alert *zeus.Alert) { alert.Frequency = *frequency }
+
+	return func(alert *zeus.Alert) {
+		flags.Visit(func(f *flag.Flag) {
+			setters[f.Name](alert)
+		})
+	}
+}
+
+// alertsCreate creates an alert from the flags.
+func alertsCreate(ctx context.Context, app *app, args []string) error {
+	flags := app.newFlags("alerts create", "")
+	apply := alertFlags(flags)
+	if _, err := parse(flags, args, 0, 0); err != nil {
+		return err
+	}
+	if err := required(flags, "name", "expression"); err != nil {
+		return err
+	}
+	var alert zeus.Alert
+	apply(&alert)
+	successful, err := app.bucket.PostAlertCtx(ctx, alert)
+	if err != nil {
+		return err
+	}
+	if successful == 0 {
+		return fmt.Errorf("alert %s was not created", alert.Alert_name)
+	}
+	fmt.Fprintf(app.stderr, "created alert %s\n", alert.Alert_name)
+	return nil
+}
+
+// alertsUpdate changes the fields of an alert given as flags.
+func alertsUpdate(ctx context.Context, app *app, args []string) error {
+	flags := app.newFlags("alerts update", "ID")
+	apply := alertFlags(flags)
+	args, err := parse(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	id, err := parseID(args[0])
+	if err != nil {
+		return err
+	}
+	alert, err := app.bucket.GetAlertCtx(ctx, id)
+	if err != nil {
+		return err
+	}
+	apply(&alert)
+	successful, err := app.bucket.PutAlertCtx(ctx, id, alert)
+	if err != nil {
+		return err
+	}
+	if successful == 0 {
+		return fmt.Errorf("alert %d was not updated", id)
+	}
+	fmt.Fprintf(app.stderr, "updated alert %d\n", id)
+	return nil
+}
+
+// alertsDelete deletes an alert.
+func alertsDelete(ctx context.Context, app *app, args []string) error {
+	flags := app.newFlags("alerts delete", "ID")
+	args, err := parse(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	id, err := parseID(args[0])
+	if err != nil {
+		return err
+	}
+	successful, err := app.bucket.DeleteAlertCtx(ctx, id)
+	if err != nil {
+		return err
+	}
+	if successful == 0 {
+		return fmt.Errorf("alert %d was not deleted", id)
+	}
+	fmt.Fprintf(app.stderr, "deleted alert %d\n", id)
+	return nil
+}
+
+// alertsApply makes the alerts of the bucket match those defined in JSON or
+// YAML files, printing the changes made.
+func alertsApply(ctx context.Context, app *app, args []string) error {
+	flags := app.newFlags("alerts apply", "FILE|DIR...")
+	usage := flags.Usage
+	flags.Usage = func() {
+		usage()
+		fmt.Fprintln(app.stderr, "FILE is a .json, .yaml or .yml file of alerts, "+
+			"and DIR stands for those in it.")
+	}
+	dryRun := flags.Bool("dry-run", false, "print the changes without making them")
+	prune := flags.Bool("prune", false, "delete the alerts which aren't defined")
+	paths, err := parse(flags, args, 1, -1)
+	if err != nil {
+		return err
+	}
+	desired, err := zeus.LoadAlerts(paths...)
+	if err != nil {
+		return err
+	}
+	// On failure, the plan only holds the changes applied before it.
+	plan, err := zeus.Reconcile(ctx, app.bucket, desired,
+		zeus.ReconcileConfig{DryRun: *dryRun, Prune: *prune})
+	if len(plan.Changes) == 0 && err != nil {
+		return err
+	}
+	changes := plan.Changes
+	if changes == nil {
+		changes = []zeus.AlertChange{}
+	}
+	rows := make([][]string, len(changes))
+	for i, change := range changes {
+		id := ""
+		if change.ID != 0 {
+			id = strconv.FormatInt(change.ID, 10)
+		}
+		rows[i] = []string{string(change.Action), change.Name, id,
+			strings.Join(change.Fields, ",")}
+	}
+	headers := []string{"action", "name", "id", "fields"}
+	if renderErr := app.render(headers, rows, changes); err == nil {
+		err = renderErr
+	}
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(changes) == 0:
+		fmt.Fprintln(app.stderr, "no changes")
+	case *dryRun:
+		fmt.Fprintf(app.stderr, "dry run: %d changes not applied\n", len(changes))
+	default:
+		fmt.Fprintf(app.stderr, "applied %d changes\n", len(changes))
+	}
+	return nil
+}
+
+// trigalerts prints the triggered alerts.
+func trigalerts(ctx context.Context, app *app, args []string) error {
+	flags := app.newFlags("trigalerts", "")
+	last24 := flags.Bool("last24", false, "only the alerts triggered in the last 24 hours")
+	if _, err := parse(flags, args, 0, 0); err != nil {
+		return err
+	}
+	var trigalert map[string]interface{}
+	var err error
+	if *last24 {
+		trigalert, err = app.bucket.GetTrigalertLast24Ctx(ctx)
+	} else {
+		trigalert, err = app.bucket.GetTrigalertCtx(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	fields := make([]string, 0, len(trigalert))
+	for field := range trigalert {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	rows := make([][]string, len(fields))
+	for i, field := range fields {
+		rows[i] = []string{field, cell(trigalert[field])}
+	}
+	return app.render([]string{"field", "value"}, rows, trigalert)
+}
+
+func parseID(arg string) (int64, error) {
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid alert id %q", arg)
+	}
+	return id, nil
+}
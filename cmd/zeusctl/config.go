@@ -0,0 +1,59 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package main
+
+import (
+	"errors"
+
+	"github.com/CiscoZeus/go-zeusclient"
+)
+
+// settings are the connection flags of zeusctl.
+type settings struct {
+	Server string
+	Token  string
+	Bucket string
+}
+
+// resolve returns the profile called name, or the default one, from the
+// config file at path, or its default location, with the settings given as
+// flags applied on top. Its user agent is "zeusctl" unless it sets one.
+func resolve(cli settings, path, name string) (zeus.Profile, error) {
+	config, err := zeus.LoadConfig(path)
+	if err != nil {
+		return zeus.Profile{}, err
+	}
+	profile, err := config.Profile(name)
+	if err != nil {
+		return zeus.Profile{}, err
+	}
+	if cli.Server != "" {
+		profile.Server = cli.Server
+	}
+	if cli.Token != "" {
+		profile.Token = cli.Token
+	}
+	if cli.Bucket != "" {
+		profile.Bucket = cli.Bucket
+	}
+	if profile.UserAgent == "" {
+		profile.UserAgent = "zeusctl"
+	}
+	if profile.Token == "" && profile.TokenEnv == "" && profile.TokenFile == "" {
+		return zeus.Profile{}, errors.New(
+			"no API token: use -token, ZEUS_TOKEN or a config file")
+	}
+	return profile, nil
+}
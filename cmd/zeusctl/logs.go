@@ -0,0 +1,242 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CiscoZeus/go-zeusclient"
+)
+
+// logsPost sends the logs read from a file, or stdin, as a JSON array or
+// one JSON object per line.
+func logsPost(ctx context.Context, app *app, args []string) error {
+	flags := app.newFlags("logs post", "[FILE]")
+	name := flags.String("name", "", "log name")
+	args, err := parse(flags, args, 0, 1)
+	if err != nil {
+		return err
+	}
+	if err := required(flags, "name"); err != nil {
+		return err
+	}
+	objects, err := app.readObjects(args)
+	if err != nil {
+		return err
+	}
+	logs := zeus.LogList{Name: *name, Logs: make([]zeus.Log, len(objects))}
+	for i, object := range objects {
+		logs.Logs[i] = zeus.Log(object)
+	}
+	successful, err := app.bucket.PostLogsCtx(ctx, logs)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(app.stderr, "posted %d of %d logs\n", successful, len(logs.Logs))
+	return nil
+}
+
+// logsGet prints the logs matching the flags.
+func logsGet(ctx context.Context, app *app, args []string) error {
+	flags := app.newFlags("logs get", "")
+	query := logQueryFlags(flags)
+	limit := flags.Int("limit", 100, "maximum number of logs, 0 for all")
+	sortField := flags.String("sort", "", "field to sort by")
+	desc := flags.Bool("desc", false, "sort in descending order")
+	if _, err := parse(flags, args, 0, 0); err != nil {
+		return err
+	}
+	if err := required(flags, "name"); err != nil {
+		return err
+	}
+	q, err := query()
+	if err != nil {
+		return err
+	}
+	q = q.Limit(*limit)
+	if *sortField != "" {
+		order := zeus.Ascending
+		if *desc {
+			order = zeus.Descending
+		}
+		q = q.OrderBy(*sortField, order)
+	}
+	logs, err := zeus.QueryLogs(ctx, app.bucket, q)
+	if err != nil {
+		return err
+	}
+	maps := make([]map[string]interface{}, len(logs.Logs))
+	for i, log := range logs.Logs {
+		maps[i] = log
+	}
+	headers := keys(maps)
+	return app.render(headers, mapRows(headers, maps), logs.Logs)
+}
+
+// logsTail prints the logs matching the flags as they arrive, until
+// interrupted. As the logs aren't known in advance, the CSV header is made
+// of the fields of the first log: fields only later logs have are left out.
+func logsTail(ctx context.Context, app *app, args []string) error {
+	flags := app.newFlags("logs tail", "")
+	query := logQueryFlags(flags)
+	interval := flags.Duration("max-interval", 0, "longest delay between polls")
+	if _, err := parse(flags, args, 0, 0); err != nil {
+		return err
+	}
+	if err := required(flags, "name"); err != nil {
+		return err
+	}
+	q, err := query()
+	if err != nil {
+		return err
+	}
+
+	var headers []string
+	writer := csv.NewWriter(app.stdout)
+	config := zeus.TailConfig{
+		MaxInterval: *interval,
+		OnError: func(err error) {
+			fmt.Fprintln(app.stderr, "zeusctl: retrying:", err)
+		},
+	}
+	for log, err := range zeus.TailLogs(ctx, app.bucket, q, config) {
+		if err != nil {
+			return err
+		}
+		switch app.output {
+		case "json":
+			js, err := json.Marshal(log)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(app.stdout, "%s\n", js)
+		case "csv":
+			if headers == nil {
+				headers = keys([]map[string]interface{}{log})
+				writer.Write(headers)
+			}
+			if err := writer.WriteAll(mapRows(headers,
+				[]map[string]interface{}{log})); err != nil {
+				return err
+			}
+		default:
+			fields := keys([]map[string]interface{}{log})
+			for i, field := range fields {
+				fields[i] = field + "=" + strconv.Quote(cell(log[field]))
+			}
+			fmt.Fprintln(app.stdout, strings.Join(fields, " "))
+		}
+	}
+	return ctx.Err()
+}
+
+// logQueryFlags adds the flags selecting logs, and returns a function
+// building the query once they are parsed.
+func logQueryFlags(flags *flag.FlagSet) func() (zeus.LogQuery, error) {
+	name := flags.String("name", "", "log name")
+	field := flags.String("field", "", "field matched by -pattern")
+	pattern := flags.String("pattern", "", `pattern, with "*" and "?" wildcards`)
+	from := flags.String("from", "", "start time: RFC 3339, unix seconds or a duration ago")
+	to := flags.String("to", "", "end time, like -from")
+	return func() (zeus.LogQuery, error) {
+		query := zeus.NewLogQuery(*name)
+		if *pattern != "" {
+			if *field == "" {
+				return query, errors.New("-pattern needs -field")
+			}
+			query = query.Where(zeus.Field(*field).Matches(*pattern))
+		}
+		now := timeNow()
+		start, err := parseTime(*from, now)
+		if err != nil {
+			return query, err
+		}
+		end, err := parseTime(*to, now)
+		if err != nil {
+			return query, err
+		}
+		return query.Between(start, end), nil
+	}
+}
+
+// timeNow is replaced by tests.
+var timeNow = time.Now
+
+// parseTime parses an RFC 3339 time, unix seconds or a duration before now.
+// An empty string is the zero time.
+func parseTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Unix(0, int64(seconds*1e9)), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: use RFC 3339, unix seconds or a duration", value)
+	}
+	return t, nil
+}
+
+// readObjects reads JSON objects from the file named by args, or stdin if
+// there is none or it is "-", given as an array or one per line.
+func (app *app) readObjects(args []string) ([]map[string]interface{}, error) {
+	var input io.Reader = app.stdin
+	if len(args) > 0 && args[0] != "-" {
+		file, err := os.Open(args[0])
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		input = file
+	}
+	js, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	var objects []map[string]interface{}
+	js = bytes.TrimSpace(js)
+	if len(js) > 0 && js[0] == '[' {
+		if err := json.Unmarshal(js, &objects); err != nil {
+			return nil, err
+		}
+		return objects, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(js))
+	for {
+		var object map[string]interface{}
+		if err := decoder.Decode(&object); err == io.EOF {
+			return objects, nil
+		} else if err != nil {
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+// Command zeusctl inspects and feeds a Zeus bucket from the command line.
+//
+//	zeusctl [-profile NAME] [-server URL] [-token TOKEN] [-bucket ORG/BUCKET]
+//	        [-config FILE] [-output table|json|csv] COMMAND [ARGS]
+//
+// The commands are:
+//
+//	logs post|get|tail
+//	metrics post|names|values|delete
+//	alerts list|get|create|update|delete|apply
+//	trigalerts
+//
+// Settings not given as flags come from a profile of the config file, by
+// default ~/.config/zeus/config.yaml or the file named by ZEUS_CONFIG, with
+// the ZEUS_SERVER, ZEUS_TOKEN and ZEUS_BUCKET environment variables taking
+// precedence, as described by zeus.Config:
+//
+//	profiles:
+//	  default:
+//	    server: https://api.ciscozeus.io
+//	    token_file: ~/.config/zeus/token
+//	    bucket: org1/bucket1
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/CiscoZeus/go-zeusclient"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// app holds what commands need.
+type app struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	bucket *zeus.Bucket
+	output string
+}
+
+// command runs a subcommand with its arguments.
+type command func(ctx context.Context, app *app, args []string) error
+
+var commands = map[string]map[string]command{
+	"logs": {
+		"post": logsPost,
+		"get":  logsGet,
+		"tail": logsTail,
+	},
+	"metrics": {
+		"post":   metricsPost,
+		"names":  metricsNames,
+		"values": metricsValues,
+		"delete": metricsDelete,
+	},
+	"alerts": {
+		"list":   alertsList,
+		"get":    alertsGet,
+		"create": alertsCreate,
+		"update": alertsUpdate,
+		"delete": alertsDelete,
+		"apply":  alertsApply,
+	},
+	"trigalerts": {
+		"": trigalerts,
+	},
+}
+
+const usage = `usage: zeusctl [flags] COMMAND [ARGS]
+
+commands:
+  logs post|get|tail
+  metrics post|names|values|delete
+  alerts list|get|create|update|delete|apply
+  trigalerts
+
+Run "zeusctl COMMAND SUBCOMMAND -h" for the flags of a command.
+
+flags:
+`
+
+// errUsage reports a command line error whose message was already printed.
+var errUsage = errors.New("usage")
+
+// run runs zeusctl and returns its exit status.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout,
+	stderr io.Writer) int {
+	flags := flag.NewFlagSet("zeusctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	var cli settings
+	profileName := flags.String("profile", "", "profile of the config file, by default $ZEUS_PROFILE")
+	flags.StringVar(&cli.Server, "server", "", "URL of the Zeus API")
+	flags.StringVar(&cli.Token, "token", "", "API token")
+	flags.StringVar(&cli.Bucket, "bucket", "", `bucket, as "organization/bucket"`)
+	configPath := flags.String("config", "", "config file")
+	output := flags.String("output", "table", "output format: table, json or csv")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	switch *output {
+	case "table", "json", "csv":
+	default:
+		fmt.Fprintf(stderr, "zeusctl: unknown output format %q\n", *output)
+		return 2
+	}
+
+	args = flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		return 2
+	}
+	group, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "zeusctl: unknown command %q\n", args[0])
+		return 2
+	}
+	name := ""
+	if _, single := group[""]; !single {
+		if len(args) < 2 {
+			fmt.Fprintf(stderr, "zeusctl: %s needs one of: %s\n", args[0],
+				strings.Join(subcommands(group), ", "))
+			return 2
+		}
+		name = args[1]
+		args = args[1:]
+	}
+	cmd, ok := group[name]
+	if !ok {
+		fmt.Fprintf(stderr, "zeusctl: unknown command %q\n", flags.Arg(0)+" "+name)
+		return 2
+	}
+
+	profile, err := resolve(cli, *configPath, *profileName)
+	if err != nil {
+		fmt.Fprintln(stderr, "zeusctl:", err)
+		return 1
+	}
+	client, err := profile.NewClient()
+	if err != nil {
+		fmt.Fprintln(stderr, "zeusctl:", err)
+		return 1
+	}
+	app := &app{
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+		bucket: client.Bucket(profile.Bucket),
+		output: *output,
+	}
+	if err := cmd(ctx, app, args[1:]); err != nil {
+		if err == errUsage {
+			return 2
+		}
+		if errors.Is(err, context.Canceled) {
+			return 0
+		}
+		fmt.Fprintln(stderr, "zeusctl:", err)
+		return 1
+	}
+	return 0
+}
+
+func subcommands(group map[string]command) []string {
+	var names []string
+	for _, name := range []string{"post", "get", "tail", "names", "values",
+		"list", "create", "update", "delete", "apply"} {
+		if _, ok := group[name]; ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// newFlags returns the flag set of a command.
+func (app *app) newFlags(name, args string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(app.stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(app.stderr, strings.TrimSpace("usage: zeusctl "+name+" [flags] "+args))
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parse parses the flags of a command, which may come before or after its
+// arguments, and checks the number of arguments, max being negative when
+// there is no limit.
+func parse(flags *flag.FlagSet, args []string, min, max int) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, errUsage
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	if len(positional) < min || (max >= 0 && len(positional) > max) {
+		flags.Usage()
+		return nil, errUsage
+	}
+	return positional, nil
+}
+
+// required checks that flags were given a value.
+func required(flags *flag.FlagSet, names ...string) error {
+	for _, name := range names {
+		if flags.Lookup(name).Value.String() == "" {
+			fmt.Fprintf(flags.Output(), "flag -%s is required\n", name)
+			flags.Usage()
+			return errUsage
+		}
+	}
+	return nil
+}
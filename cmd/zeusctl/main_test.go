@@ -0,0 +1,356 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// request is a request received by the fake server.
+type request struct {
+	method, path string
+	form         url.Values
+}
+
+// fakeZeus answers each path with a body and records the requests.
+func fakeZeus(t *testing.T, bodies map[string]string) (*httptest.Server, *[]request) {
+	var requests []request
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			form, _ := url.ParseQuery(string(body))
+			if r.Method == "GET" {
+				form = r.URL.Query()
+			}
+			requests = append(requests, request{r.Method, r.URL.Path, form})
+			key := r.Method + " " + r.URL.Path
+			reply, ok := bodies[key]
+			if !ok {
+				t.Errorf("unexpected request %s", key)
+				w.WriteHeader(404)
+				return
+			}
+			if r.Method == "DELETE" {
+				w.WriteHeader(204)
+			} else if r.Method == "POST" && strings.HasPrefix(r.URL.Path, "/alerts/") {
+				w.WriteHeader(201)
+			}
+			fmt.Fprint(w, reply)
+		}))
+	return server, &requests
+}
+
+func zeusctl(server *httptest.Server, stdin string, args ...string) (
+	status int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	args = append([]string{"-server", server.URL, "-token", "goZeus",
+		"-bucket", "org1/bucket1"}, args...)
+	status = run(context.Background(), args, strings.NewReader(stdin), &out,
+		&errOut)
+	return status, out.String(), errOut.String()
+}
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	os.WriteFile(path, []byte(`
+profiles:
+  default:
+    server: http://file
+    token: file-token
+    bucket: file/bucket
+  other:
+    server: http://other
+    token_env: OTHER_TOKEN
+    user_agent: deploy-bot
+`), 0600)
+	for _, key := range []string{"ZEUS_SERVER", "ZEUS_TOKEN", "ZEUS_BUCKET",
+		"ZEUS_PROFILE"} {
+		t.Setenv(key, "")
+	}
+	t.Setenv("ZEUS_CONFIG", path)
+	t.Setenv("ZEUS_TOKEN", "env-token")
+
+	profile, err := resolve(settings{Bucket: "flag/bucket"}, "", "")
+	if err != nil {
+		t.Fatal("failed to resolve:", err)
+	}
+	if profile.Server != "http://file" || profile.Token != "env-token" ||
+		profile.Bucket != "flag/bucket" || profile.UserAgent != "zeusctl" {
+		t.Errorf("unexpected profile %+v", profile)
+	}
+	profile, err = resolve(settings{}, "", "other")
+	if err != nil || profile.Server != "http://other" ||
+		profile.UserAgent != "deploy-bot" {
+		t.Error("failed to resolve a named profile:", profile, err)
+	}
+	if _, err := resolve(settings{}, "", "missing"); err == nil {
+		t.Error("should fail on a missing profile")
+	}
+
+	t.Setenv("ZEUS_CONFIG", "")
+	t.Setenv("ZEUS_TOKEN", "")
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	if _, err := resolve(settings{}, "", ""); err == nil {
+		t.Error("should fail without a token")
+	}
+	if _, err = resolve(settings{Token: "t"}, "", ""); err != nil {
+		t.Error("a missing default config file should be ignored:", err)
+	}
+	if _, err := resolve(settings{Token: "t"}, filepath.Join(dir, "missing.yaml"), ""); err == nil {
+		t.Error("should fail on a missing config file given explicitly")
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Unix(1430355869, 0)
+	for value, expected := range map[string]time.Time{
+		"":                     {},
+		"1h":                   now.Add(-time.Hour),
+		"1430355860.5":         time.Unix(1430355860, 500000000),
+		"2015-04-30T01:02:03Z": time.Date(2015, 4, 30, 1, 2, 3, 0, time.UTC),
+	} {
+		if got, err := parseTime(value, now); err != nil || !got.Equal(expected) {
+			t.Errorf("%q: expected %v, got %v, %v", value, expected, got, err)
+		}
+	}
+	if _, err := parseTime("yesterday", now); err == nil {
+		t.Error("should fail on an invalid time")
+	}
+}
+
+func TestUsage(t *testing.T) {
+	server, _ := fakeZeus(t, nil)
+	defer server.Close()
+	for _, args := range [][]string{
+		{},
+		{"unknown"},
+		{"logs"},
+		{"logs", "unknown"},
+		{"logs", "get"},
+		{"alerts", "get"},
+		{"-output", "xml", "alerts", "list"},
+	} {
+		if status, _, _ := zeusctl(server, "", args...); status != 2 {
+			t.Errorf("%v: expected status 2, got %d", args, status)
+		}
+	}
+}
+
+func TestLogsGet(t *testing.T) {
+	server, requests := fakeZeus(t, map[string]string{
+		"GET /logs/goZeus/": `{"total": 2, "result": [
+			{"message": "hello", "status": 200},
+			{"message": "world", "user": "alice"}]}`,
+	})
+	defer server.Close()
+
+	status, stdout, stderr := zeusctl(server, "", "logs", "get", "-name", "syslog",
+		"-field", "message", "-pattern", "*o*")
+	if status != 0 {
+		t.Fatal("failed:", stderr)
+	}
+	expected := "MESSAGE  STATUS  USER\nhello    200     \nworld            alice\n"
+	if stdout != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, stdout)
+	}
+	form := (*requests)[0].form
+	if form.Get("log_name") != "syslog" || form.Get("attribute_name") != "message" ||
+		form.Get("pattern") != "*o*" {
+		t.Error("wrong parameters:", form)
+	}
+
+	_, stdout, _ = zeusctl(server, "", "-output", "csv", "logs", "get", "-name", "syslog")
+	if stdout != "message,status,user\nhello,200,\nworld,,alice\n" {
+		t.Error("wrong CSV:", stdout)
+	}
+	_, stdout, _ = zeusctl(server, "", "-output", "json", "logs", "get", "-name", "syslog")
+	if !strings.Contains(stdout, `"user": "alice"`) {
+		t.Error("wrong JSON:", stdout)
+	}
+}
+
+func TestMetricsPost(t *testing.T) {
+	server, requests := fakeZeus(t, map[string]string{
+		"POST /metrics/goZeus/cpu/": `{"successful": 2}`,
+	})
+	defer server.Close()
+
+	input := `{"timestamp": 1430355869, "user": 1, "system": 2}
+{"user": 3}`
+	status, _, stderr := zeusctl(server, input, "metrics", "post", "-name", "cpu")
+	if status != 0 {
+		t.Fatal("failed:", stderr)
+	}
+	points := (*requests)[0].form.Get("metrics")
+	expected := `[{"point":{"system":2,"user":1},"timestamp":1430355869.000},{"point":{"user":3}}]`
+	if points != expected {
+		t.Errorf("expected %s, got %s", expected, points)
+	}
+	if status, _, _ := zeusctl(server, `{"user": "high"}`, "metrics", "post", "-name", "cpu"); status != 1 {
+		t.Error("should fail on a value which is not a number")
+	}
+}
+
+func TestMetricsValues(t *testing.T) {
+	server, _ := fakeZeus(t, map[string]string{
+		"GET /metrics/goZeus/_values/": `[{"name": "cpu", "columns": ["time", "user", "system"],
+			"points": [[1430355869, 1, null]]}]`,
+	})
+	defer server.Close()
+
+	status, stdout, stderr := zeusctl(server, "", "-output", "csv", "metrics", "values",
+		"-name", "cpu")
+	if status != 0 {
+		t.Fatal("failed:", stderr)
+	}
+	if stdout != "time,user,system\n1430355869,1,\n" {
+		t.Error("wrong values:", stdout)
+	}
+}
+
+func TestAlertsUpdate(t *testing.T) {
+	server, requests := fakeZeus(t, map[string]string{
+		"GET /alerts/goZeus/7/": `{"id": 7, "alert_name": "load", "alert_expression": "cpu.load > 0.9",
+			"alert_severity": "low", "frequency": 60}`,
+		"PUT /alerts/goZeus/7/": ``,
+	})
+	defer server.Close()
+
+	status, _, stderr := zeusctl(server, "", "alerts", "update", "7", "-severity", "high")
+	if status != 0 {
+		t.Fatal("failed:", stderr)
+	}
+	form := (*requests)[1].form
+	if form.Get("alert_severity") != "high" || form.Get("alert_expression") != "cpu.load > 0.9" ||
+		form.Get("alert_name") != "load" {
+		t.Error("wrong alert sent:", form)
+	}
+}
+
+func TestAlertsCreateNotApplied(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(202)
+		}))
+	defer server.Close()
+
+	status, _, stderr := zeusctl(server, "", "alerts", "create", "-name", "load",
+		"-expression", "cpu.load > 0.9")
+	if status != 1 || strings.Contains(stderr, "created") {
+		t.Errorf("expected an alert not created to fail: %d %q", status, stderr)
+	}
+}
+
+func TestAlertsApply(t *testing.T) {
+	server, requests := fakeZeus(t, map[string]string{
+		"GET /alerts/goZeus/": `[
+			{"id": 1, "alert_name": "load", "alert_expression": "cpu.load>0.9"},
+			{"id": 2, "alert_name": "disk", "alert_expression": "disk.free < 1",
+			 "alert_severity": "S4"},
+			{"id": 3, "alert_name": "old", "alert_expression": "old.value > 1"}]`,
+		"POST /alerts/goZeus/":     `{}`,
+		"PUT /alerts/goZeus/2/":    ``,
+		"DELETE /alerts/goZeus/3/": ``,
+	})
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "alerts.json")
+	err := os.WriteFile(path, []byte(`[
+		{"alert_name": "load", "alert_expression": "cpu.load > 0.9"},
+		{"alert_name": "disk", "alert_expression": "disk.free < 1",
+		 "alert_severity": "S2"},
+		{"alert_name": "mem", "alert_expression": "mem.used > 0.9",
+		 "frequency": "1m"}]`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, stdout, stderr := zeusctl(server, "", "-output", "csv", "alerts",
+		"apply", "-dry-run", "-prune", path)
+	expected := "action,name,id,fields\nupdate,disk,2,alert_severity\n" +
+		"create,mem,,\ndelete,old,3,\n"
+	if status != 0 || stdout != expected ||
+		stderr != "dry run: 3 changes not applied\n" {
+		t.Fatalf("wrong dry run: %d %q %q", status, stdout, stderr)
+	}
+	if len(*requests) != 1 {
+		t.Fatal("a dry run should only retrieve the alerts:", *requests)
+	}
+
+	*requests = nil
+	status, _, stderr = zeusctl(server, "", "alerts", "apply", path)
+	if status != 0 || stderr != "applied 2 changes\n" {
+		t.Fatalf("failed to apply: %d %q", status, stderr)
+	}
+	if len(*requests) != 3 || (*requests)[1].form.Get("alert_severity") != "S2" ||
+		(*requests)[2].form.Get("frequency") != "60.000000" {
+		t.Error("wrong requests:", *requests)
+	}
+
+	if status, _, _ := zeusctl(server, "", "alerts", "apply"); status != 2 {
+		t.Error("expected a file to be required")
+	}
+	_, _, stderr = zeusctl(server, "", "alerts", "apply", "-h")
+	if !strings.Contains(stderr, ".yaml") {
+		t.Error("the help should tell the file formats:", stderr)
+	}
+}
+
+func TestAlertsApplyFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case "GET":
+				fmt.Fprint(w, `[{"id": 2, "alert_name": "disk",
+					"alert_expression": "disk.free < 1", "alert_severity": "S4"}]`)
+			case "PUT":
+				w.WriteHeader(200)
+			default:
+				w.WriteHeader(400)
+				fmt.Fprint(w, `{"error": "invalid alert"}`)
+			}
+		}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "alerts.yaml")
+	err := os.WriteFile(path, []byte(`
+- alert_name: disk
+  alert_expression: disk.free < 1
+  alert_severity: S2
+- alert_name: mem
+  alert_expression: mem.used > 0.9
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, stdout, stderr := zeusctl(server, "", "-output", "csv", "alerts",
+		"apply", path)
+	if status != 1 || stdout != "action,name,id,fields\nupdate,disk,2,alert_severity\n" ||
+		!strings.Contains(stderr, "create alert mem: ") {
+		t.Errorf("only the applied changes should be printed: %d %q %q", status,
+			stdout, stderr)
+	}
+}
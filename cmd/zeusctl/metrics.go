@@ -0,0 +1,192 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/CiscoZeus/go-zeusclient"
+)
+
+// metricsPost sends the points read from a file, or stdin, as JSON objects
+// mapping columns to values, with an optional "timestamp" in unix seconds.
+// Columns absent from a point are sent as missing.
+func metricsPost(ctx context.Context, app *app, args []string) error {
+	flags := app.newFlags("metrics post", "[FILE]")
+	name := flags.String("name", "", "metric name")
+	args, err := parse(flags, args, 0, 1)
+	if err != nil {
+		return err
+	}
+	if err := required(flags, "name"); err != nil {
+		return err
+	}
+	objects, err := app.readObjects(args)
+	if err != nil {
+		return err
+	}
+
+	metrics := zeus.MetricList{Name: *name}
+	for _, column := range keys(objects) {
+		if column != "timestamp" {
+			metrics.Columns = append(metrics.Columns, column)
+		}
+	}
+	for i, object := range objects {
+		metric := zeus.Metric{Point: make([]float64, len(metrics.Columns))}
+		if timestamp, ok := object["timestamp"]; ok {
+			if metric.Timestamp, ok = timestamp.(float64); !ok {
+				return fmt.Errorf("point %d: timestamp is not a number", i)
+			}
+		}
+		for idx, column := range metrics.Columns {
+			switch value := object[column].(type) {
+			case float64:
+				metric.Point[idx] = value
+			case nil:
+				metric.SetMissing(idx)
+			default:
+				return fmt.Errorf("point %d: %s is not a number", i, column)
+			}
+		}
+		metrics.Metrics = append(metrics.Metrics, metric)
+	}
+	successful, err := app.bucket.PostMetricsCtx(ctx, metrics)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(app.stderr, "posted %d of %d points\n", successful, len(metrics.Metrics))
+	return nil
+}
+
+// metricsNames prints the metric names matching a pattern.
+func metricsNames(ctx context.Context, app *app, args []string) error {
+	flags := app.newFlags("metrics names", "")
+	pattern := flags.String("pattern", "", "metric name pattern")
+	if _, err := parse(flags, args, 0, 0); err != nil {
+		return err
+	}
+	names := []string{}
+	for name, err := range app.bucket.MetricNames(ctx, *pattern, 0) {
+		if err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+	rows := make([][]string, len(names))
+	for i, name := range names {
+		rows[i] = []string{name}
+	}
+	return app.render([]string{"name"}, rows, names)
+}
+
+// metricsValues prints the values of a metric, one row per point of every
+// series returned.
+func metricsValues(ctx context.Context, app *app, args []string) error {
+	flags := app.newFlags("metrics values", "")
+	name := flags.String("name", "", "metric name")
+	aggregator := flags.String("aggregator", "",
+		"aggregator: count, min, max, sum, mean, mode or median")
+	column := flags.String("column", "", "aggregated column")
+	interval := flags.String("interval", "", `group interval, such as "1m"`)
+	filter := flags.String("filter", "", `filter condition, such as "value > 0"`)
+	from := flags.String("from", "", "start time: RFC 3339, unix seconds or a duration ago")
+	to := flags.String("to", "", "end time, like -from")
+	offset := flags.Int("offset", 0, "number of values skipped")
+	limit := flags.Int("limit", 100, "maximum number of values")
+	if _, err := parse(flags, args, 0, 0); err != nil {
+		return err
+	}
+	if err := required(flags, "name"); err != nil {
+		return err
+	}
+	now := timeNow()
+	start, err := parseTime(*from, now)
+	if err != nil {
+		return err
+	}
+	end, err := parseTime(*to, now)
+	if err != nil {
+		return err
+	}
+	series, err := app.bucket.GetMetricSeriesCtx(ctx, *name, *aggregator, *column,
+		*interval, zeus.UnixSeconds(start), zeus.UnixSeconds(end), *filter, *offset, *limit)
+	if err != nil {
+		return err
+	}
+
+	var headers []string
+	var rows [][]string
+	var result []map[string]interface{}
+	for n, metrics := range series {
+		if n == 0 {
+			if len(series) > 1 {
+				headers = append(headers, "series")
+			}
+			headers = append(headers, "time")
+			headers = append(headers, metrics.Columns...)
+		}
+		var points [][]interface{}
+		for _, metric := range metrics.Metrics {
+			var row []string
+			if len(series) > 1 {
+				row = append(row, strconv.Itoa(n))
+			}
+			row = append(row, cell(metric.Timestamp))
+			point := []interface{}{metric.Timestamp}
+			for idx := range metrics.Columns {
+				value, ok := metric.Value(idx)
+				if ok {
+					row = append(row, cell(value))
+					point = append(point, value)
+				} else {
+					row = append(row, "")
+					point = append(point, nil)
+				}
+			}
+			rows = append(rows, row)
+			points = append(points, point)
+		}
+		result = append(result, map[string]interface{}{
+			"name":    metrics.Name,
+			"columns": append([]string{"time"}, metrics.Columns...),
+			"points":  points,
+		})
+	}
+	return app.render(headers, rows, result)
+}
+
+// metricsDelete deletes a metric series.
+func metricsDelete(ctx context.Context, app *app, args []string) error {
+	flags := app.newFlags("metrics delete", "")
+	name := flags.String("name", "", "metric name")
+	if _, err := parse(flags, args, 0, 0); err != nil {
+		return err
+	}
+	if err := required(flags, "name"); err != nil {
+		return err
+	}
+	deleted, err := app.bucket.DeleteMetricsCtx(ctx, *name)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return fmt.Errorf("metric %s was not deleted", *name)
+	}
+	fmt.Fprintf(app.stderr, "deleted metric %s\n", *name)
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// render prints rows under headers as a table or CSV, or value as JSON.
+func (app *app) render(headers []string, rows [][]string, value interface{}) error {
+	switch app.output {
+	case "json":
+		encoder := json.NewEncoder(app.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case "csv":
+		writer := csv.NewWriter(app.stdout)
+		writer.Write(headers)
+		writer.WriteAll(rows)
+		return writer.Error()
+	}
+	writer := tabwriter.NewWriter(app.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, strings.ToUpper(strings.Join(headers, "\t")))
+	for _, row := range rows {
+		fmt.Fprintln(writer, strings.Join(row, "\t"))
+	}
+	return writer.Flush()
+}
+
+// cell formats a value for a table or CSV.
+func cell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]interface{}, []interface{}:
+		js, _ := json.Marshal(v)
+		return string(js)
+	}
+	return fmt.Sprint(value)
+}
+
+// keys returns the sorted keys of maps.
+func keys(maps []map[string]interface{}) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, m := range maps {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				result = append(result, key)
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// mapRows returns the rows of maps under headers.
+func mapRows(headers []string, maps []map[string]interface{}) [][]string {
+	rows := make([][]string, len(maps))
+	for i, m := range maps {
+		rows[i] = make([]string, len(headers))
+		for j, header := range headers {
+			rows[i][j] = cell(m[header])
+		}
+	}
+	return rows
+}
@@ -0,0 +1,137 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// APIError is returned when Zeus answers a request with a non-2xx status, or
+// a post of logs or metrics or a change of an alert with a 2xx status other
+// than the one telling it was done.
+// Use errors.As to get it from an error returned by the client.
+type APIError struct {
+	// StatusCode is the HTTP status of the response.
+	StatusCode int
+	// Message is the "error" field of the response, or the whole response
+	// body when it has none.
+	Message string
+	// Body is the raw response body.
+	Body []byte
+	// Method and URL describe the request. The API token is replaced with
+	// "REDACTED" in URL.
+	Method, URL string
+}
+
+func (err *APIError) Error() string {
+	msg := fmt.Sprintf("%s %s: %d %s", err.Method, err.URL, err.StatusCode,
+		http.StatusText(err.StatusCode))
+	if err.Message != "" {
+		msg += ": " + err.Message
+	}
+	return msg
+}
+
+func newAPIError(method, urlStr, token string, status int, body []byte) *APIError {
+	if token != "" {
+		urlStr = strings.Replace(urlStr, token, "REDACTED", -1)
+	}
+	message := strings.TrimSpace(string(body))
+	var resp struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &resp); err == nil && resp.Error != "" {
+		message = resp.Error
+	}
+	return &APIError{
+		StatusCode: status,
+		Message:    message,
+		Body:       body,
+		Method:     method,
+		URL:        urlStr,
+	}
+}
+
+func hasStatus(err error, statuses ...int) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	for _, status := range statuses {
+		if apiErr.StatusCode == status {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBadRequest reports whether err is an APIError with status 400.
+func IsBadRequest(err error) bool {
+	return hasStatus(err, http.StatusBadRequest)
+}
+
+// IsUnauthorized reports whether err is an APIError with status 401 or 403,
+// i.e. the token is wrong or has no access to the bucket.
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized, http.StatusForbidden)
+}
+
+// IsNotFound reports whether err is an APIError with status 404.
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsRateLimited reports whether err is an APIError with status 429.
+func IsRateLimited(err error) bool {
+	return hasStatus(err, http.StatusTooManyRequests)
+}
+
+// IsServerError reports whether err is an APIError with a 5xx status.
+func IsServerError(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode >= 500
+}
+
+// IsTransient reports whether a request which failed with err may succeed
+// later: the connection to Zeus failed or timed out, or Zeus answered 429 or
+// 5xx. Other errors, like a ValidationError or a missing token, are returned
+// again on every attempt.
+func IsTransient(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == 429 || apiErr.StatusCode >= 500
+	}
+	var netErr net.Error
+	return isConnError(err) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// ValidationError is returned when data is rejected by the client before
+// it is sent. Field names the offending field.
+type ValidationError struct {
+	Field  string
+	Reason string
+}
+
+func (err *ValidationError) Error() string {
+	return err.Field + ": " + err.Reason
+}
@@ -0,0 +1,170 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func fail(code int, retBody string) (*httptest.Server, *Bucket) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+			fmt.Fprintln(w, retBody)
+		}))
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+	return server, zeus.Bucket("org1/bucket1")
+}
+
+func TestAPIError(t *testing.T) {
+	server, bucket := fail(404, `{"error": "log not found"}`)
+	defer server.Close()
+
+	_, _, err := bucket.GetLogs("syslog", "", "", 0, 0, 0, 0)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatal("expected an APIError, got", err)
+	}
+	if apiErr.StatusCode != 404 || apiErr.Method != "GET" ||
+		apiErr.Message != "log not found" {
+		t.Errorf("wrong APIError: %#v", apiErr)
+	}
+	if strings.Contains(apiErr.URL, "goZeus") ||
+		strings.Contains(apiErr.Error(), "goZeus") {
+		t.Error("token should be redacted:", apiErr)
+	}
+	if !IsNotFound(err) || IsUnauthorized(err) || IsRateLimited(err) {
+		t.Error("wrong status helpers for", err)
+	}
+	if IsNotFound(errors.New("not found")) {
+		t.Error("only an APIError should be not found")
+	}
+}
+
+func TestAPIErrorStatuses(t *testing.T) {
+	cases := []struct {
+		code  int
+		check func(error) bool
+	}{
+		{400, IsBadRequest},
+		{401, IsUnauthorized},
+		{403, IsUnauthorized},
+		{429, IsRateLimited},
+		{500, IsServerError},
+		{503, IsServerError},
+	}
+	logs := LogList{Name: "syslog", Logs: []Log{Log{"foo": "bar"}}}
+	metrics := MetricList{Name: "cpu", Columns: []string{"value"},
+		Metrics: []Metric{Metric{Point: []float64{1}}}}
+	alert := Alert{Alert_name: "cpu", Alert_expression: "cpu.value > 20"}
+
+	for _, c := range cases {
+		server, bucket := fail(c.code, "server says no")
+		calls := map[string]error{}
+		_, calls["PostLogs"] = bucket.PostLogs(logs)
+		_, calls["PostMetrics"] = bucket.PostMetrics(metrics)
+		_, calls["GetMetricNames"] = bucket.GetMetricNames("", 0, 0)
+		_, calls["GetMetricValues"] = bucket.GetMetricValues("cpu", "", "", "",
+			0, 0, "", 0, 0)
+		_, calls["DeleteMetrics"] = bucket.DeleteMetrics("cpu")
+		_, calls["PostAlert"] = bucket.PostAlert(alert)
+		_, _, calls["GetAlerts"] = bucket.GetAlerts()
+		_, calls["PutAlert"] = bucket.PutAlert(1, alert)
+		_, calls["GetAlert"] = bucket.GetAlert(1)
+		_, calls["DeleteAlert"] = bucket.DeleteAlert(1)
+		_, calls["GetTrigalert"] = bucket.GetTrigalert()
+		_, calls["GetTrigalertLast24"] = bucket.GetTrigalertLast24()
+		for name, err := range calls {
+			if !c.check(err) {
+				t.Errorf("%s: status %d returned %v", name, c.code, err)
+			} else if err.(*APIError).Message != "server says no" {
+				t.Errorf("%s: wrong message %q", name, err.(*APIError).Message)
+			}
+		}
+		server.Close()
+	}
+}
+
+func TestUnexpectedSuccessStatus(t *testing.T) {
+	server, bucket := fail(202, `{"error": "queued"}`)
+	defer server.Close()
+	logs := LogList{Name: "syslog", Logs: []Log{Log{"foo": "bar"}}}
+	metrics := MetricList{Name: "cpu", Columns: []string{"value"},
+		Metrics: []Metric{Metric{Point: []float64{1}}}}
+
+	alert := Alert{Alert_name: "cpu", Alert_expression: "cpu.value > 20"}
+
+	calls := map[string]error{}
+	_, calls["PostLogs"] = bucket.PostLogs(logs)
+	_, calls["PostMetrics"] = bucket.PostMetrics(metrics)
+	_, calls["PostAlert"] = bucket.PostAlert(alert)
+	_, calls["PutAlert"] = bucket.PutAlert(1, alert)
+	_, calls["DeleteAlert"] = bucket.DeleteAlert(1)
+	_, calls["GetMetricNames"] = bucket.GetMetricNames("", 0, 0)
+	_, calls["GetMetricValues"] = bucket.GetMetricValues("cpu", "", "", "",
+		0, 0, "", 0, 0)
+	_, calls["DeleteMetrics"] = bucket.DeleteMetrics("cpu")
+	_, _, calls["GetAlerts"] = bucket.GetAlerts()
+	_, calls["GetAlert"] = bucket.GetAlert(1)
+	_, _, calls["GetLogs"] = bucket.GetLogs("syslog", "", "", 0, 0, 0, 0)
+	_, calls["GetTrigalert"] = bucket.GetTrigalert()
+	_, calls["GetTrigalertLast24"] = bucket.GetTrigalertLast24()
+	for name, err := range calls {
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != 202 ||
+			apiErr.Message != "queued" {
+			t.Errorf("%s: expected an APIError, got %v", name, err)
+		}
+	}
+}
+
+func TestDeleteMetricsEmptyResponse(t *testing.T) {
+	server, bucket := fail(200, `[]`)
+	defer server.Close()
+	deleted, err := bucket.DeleteMetrics("cpu")
+	var apiErr *APIError
+	if deleted || !errors.As(err, &apiErr) || apiErr.StatusCode != 200 {
+		t.Errorf("expected an APIError, got %v, %v", deleted, err)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	cases := []struct {
+		err       error
+		transient bool
+	}{
+		{&APIError{StatusCode: 429}, true},
+		{&APIError{StatusCode: 503}, true},
+		{&APIError{StatusCode: 400}, false},
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true},
+		{fmt.Errorf("post: %w", context.DeadlineExceeded), true},
+		{context.Canceled, false},
+		{&ValidationError{Field: "foo", Reason: "nested"}, false},
+		{errors.New("API token is empty"), false},
+	}
+	for _, c := range cases {
+		if IsTransient(c.err) != c.transient {
+			t.Errorf("IsTransient(%v) should be %v", c.err, c.transient)
+		}
+	}
+}
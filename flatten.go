@@ -0,0 +1,172 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// FlattenConfig controls how nested values of a Log are turned into the
+// flat string and number values Zeus accepts.
+type FlattenConfig struct {
+	// Separator joins the keys of nested maps and the indices of slices,
+	// e.g. "." turns {"a": {"b": [1]}} into {"a.b.0": 1}. It defaults to ".".
+	Separator string
+	// MaxDepth is the number of levels flattened; deeper values are encoded
+	// as JSON strings. Zero means no limit.
+	MaxDepth int
+	// TimeFormat formats time.Time values. It defaults to time.RFC3339Nano.
+	TimeFormat string
+	// Strict rejects any value which is not a string or a number instead of
+	// converting it.
+	Strict bool
+}
+
+// WithFlatten makes PostLogs flatten every log according to config. In
+// strict mode, PostLogs returns a *ValidationError instead of posting
+// nested values.
+func WithFlatten(config FlattenConfig) Option {
+	return func(zeus *Zeus) error {
+		zeus.flatten = &config
+		return nil
+	}
+}
+
+// Flatten returns a copy of log whose values are all strings or numbers.
+// Nested maps and slices are spread into keys joined by the separator,
+// booleans become "true" or "false", times are formatted and nil becomes
+// an empty string. A *ValidationError names the field when the log can't be
+// flattened, or in strict mode when it isn't flat.
+func (log Log) Flatten(config FlattenConfig) (Log, error) {
+	if config.Separator == "" {
+		config.Separator = "."
+	}
+	if config.TimeFormat == "" {
+		config.TimeFormat = time.RFC3339Nano
+	}
+	flat := make(Log, len(log))
+	// Sort keys so that collisions are reported consistently.
+	keys := make([]string, 0, len(log))
+	for key := range log {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := flattenValue(flat, key, log[key], 1, &config); err != nil {
+			return nil, err
+		}
+	}
+	return flat, nil
+}
+
+// Flatten returns a copy of lst with every log flattened.
+func (lst LogList) Flatten(config FlattenConfig) (LogList, error) {
+	flat := LogList{Name: lst.Name, Logs: make([]Log, len(lst.Logs))}
+	for i, log := range lst.Logs {
+		var err error
+		if flat.Logs[i], err = log.Flatten(config); err != nil {
+			return LogList{}, err
+		}
+	}
+	return flat, nil
+}
+
+func flattenValue(flat Log, key string, value interface{}, depth int,
+	config *FlattenConfig) error {
+	set := func(value interface{}) error {
+		if _, ok := flat[key]; ok {
+			return &ValidationError{Field: key, Reason: "collides with a flattened key"}
+		}
+		flat[key] = value
+		return nil
+	}
+
+	switch v := value.(type) {
+	case string, json.Number, float64, float32, int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64:
+		return set(v)
+	}
+	if config.Strict {
+		return &ValidationError{Field: key, Reason: "value must be a string or a number"}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return set("")
+	case bool:
+		return set(strconv.FormatBool(v))
+	case time.Time:
+		return set(v.Format(config.TimeFormat))
+	case *time.Time:
+		if v == nil {
+			return set("")
+		}
+		return set(v.Format(config.TimeFormat))
+	case map[string]interface{}:
+		if config.MaxDepth > 0 && depth > config.MaxDepth {
+			return setJSON(set, key, v)
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			err := flattenValue(flat, key+config.Separator+k, v[k], depth+1, config)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		if config.MaxDepth > 0 && depth > config.MaxDepth {
+			return setJSON(set, key, v)
+		}
+		for i, item := range v {
+			err := flattenValue(flat, key+config.Separator+strconv.Itoa(i), item,
+				depth+1, config)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Anything else, e.g. a struct or a typed map or slice, is flattened
+	// through its JSON form.
+	js, err := json.Marshal(value)
+	if err != nil {
+		return &ValidationError{Field: key, Reason: err.Error()}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(js))
+	decoder.UseNumber()
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		return &ValidationError{Field: key, Reason: err.Error()}
+	}
+	return flattenValue(flat, key, generic, depth, config)
+}
+
+func setJSON(set func(interface{}) error, key string, value interface{}) error {
+	js, err := json.Marshal(value)
+	if err != nil {
+		return &ValidationError{Field: key, Reason: err.Error()}
+	}
+	return set(string(js))
+}
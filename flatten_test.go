@@ -0,0 +1,117 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFlatten(t *testing.T) {
+	created := time.Date(2015, 4, 30, 1, 2, 3, 0, time.UTC)
+	log := Log{
+		"message": "hello",
+		"count":   3,
+		"ok":      true,
+		"missing": nil,
+		"created": created,
+		"http": map[string]interface{}{
+			"status": 200,
+			"headers": map[string]string{
+				"host": "example.com",
+			},
+		},
+		"tags": []string{"a", "b"},
+	}
+	flat, err := log.Flatten(FlattenConfig{})
+	if err != nil {
+		t.Fatal("failed to flatten:", err)
+	}
+	expected := Log{
+		"message":           "hello",
+		"count":             3,
+		"ok":                "true",
+		"missing":           "",
+		"created":           "2015-04-30T01:02:03Z",
+		"http.status":       200,
+		"http.headers.host": "example.com",
+		"tags.0":            "a",
+		"tags.1":            "b",
+	}
+	if !reflect.DeepEqual(flat, expected) {
+		t.Errorf("expected %v, got %v", expected, flat)
+	}
+	if _, ok := log["http.status"]; ok {
+		t.Error("Flatten should not modify the log")
+	}
+
+	flat, _ = log.Flatten(FlattenConfig{Separator: "_", MaxDepth: 1,
+		TimeFormat: "2006-01-02"})
+	if flat["http_status"] != 200 || flat["http_headers"] != `{"host":"example.com"}` ||
+		flat["tags_1"] != "b" || flat["created"] != "2015-04-30" {
+		t.Error("wrong flattening with options:", flat)
+	}
+}
+
+func TestFlattenErrors(t *testing.T) {
+	_, err := Log{"a": map[string]interface{}{"b": 1}, "a.b": 2}.Flatten(FlattenConfig{})
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Field != "a.b" {
+		t.Error("expected a collision on a.b, got", err)
+	}
+
+	_, err = Log{"message": "hello", "user": Log{"id": 1}}.Flatten(FlattenConfig{Strict: true})
+	if !errors.As(err, &validationErr) || validationErr.Field != "user" {
+		t.Error("strict mode should name the nested field, got", err)
+	}
+	if _, err = (Log{"ok": false}).Flatten(FlattenConfig{Strict: true}); err == nil {
+		t.Error("strict mode should reject booleans")
+	}
+	if _, err = (Log{"n": 1.5, "s": "x"}).Flatten(FlattenConfig{Strict: true}); err != nil {
+		t.Error("strict mode should accept strings and numbers:", err)
+	}
+}
+
+func TestPostLogsFlatten(t *testing.T) {
+	logName := randString(5)
+	logs := LogList{Name: logName, Logs: []Log{
+		Log{"message": "hello", "user": map[string]interface{}{"id": 7}},
+	}}
+	jsonStr, _ := json.Marshal([]Log{Log{"message": "hello", "user.id": 7}})
+	param := url.Values{"logs": {string(jsonStr)}}
+	server, zeus, bucket_name := mock("/logs/goZeus/"+logName+"/", &param, 200,
+		`{"successful": 1}`)
+	defer server.Close()
+
+	WithFlatten(FlattenConfig{})(zeus)
+	successful, err := zeus.bucket(bucket_name).PostLogs(logs)
+	if err != nil || successful != 1 {
+		t.Error("failed to post flattened logs:", successful, err)
+	}
+	if _, ok := logs.Logs[0]["user.id"]; ok {
+		t.Error("PostLogs should not modify the logs")
+	}
+
+	WithFlatten(FlattenConfig{Strict: true})(zeus)
+	_, err = zeus.bucket(bucket_name).PostLogs(logs)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Field != "user" {
+		t.Error("strict mode should reject nested logs, got", err)
+	}
+}
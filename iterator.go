@@ -0,0 +1,285 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"context"
+	"errors"
+	"iter"
+)
+
+// ErrResultsChanged is reported by a Cursor when the total number of results
+// changed between two pages, which shifts the offsets of the pages: results
+// may have been skipped or seen twice.
+var ErrResultsChanged = errors.New("results changed while paging")
+
+// page is one page of results. next is the offset of the following page, and
+// total the number of results Zeus reported, or 0 if it doesn't tell.
+type page[T any] struct {
+	items []T
+	next  int
+	total int
+	more  bool
+	err   error
+}
+
+// fetchFunc retrieves the page of results starting at offset.
+type fetchFunc[T any] func(ctx context.Context, offset int) page[T]
+
+// Cursor pages through the results of a query, retrieving the next page in
+// the background while the current one is read:
+//
+//	cursor := bucket.LogCursor(ctx, query)
+//	defer cursor.Close()
+//	for cursor.Next() {
+//		log := cursor.Value()
+//	}
+//	if err := cursor.Err(); err != nil {
+//	}
+//
+// Paging stops at the first empty page or once the offset reaches the total
+// of the latest page. Results added or removed meanwhile shift the offsets of
+// the following pages; when Zeus reports a total, as it does for logs, a
+// change in it between pages stops the iteration with ErrResultsChanged.
+// Otherwise results may be skipped or seen twice, but the iteration always
+// ends. A Cursor is not safe for concurrent use.
+type Cursor[T any] struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	fetch  fetchFunc[T]
+	limit  int
+
+	items   []T
+	pos     int
+	count   int
+	offset  int
+	total   int
+	paged   bool
+	pending chan page[T]
+	done    bool
+	closed  bool
+	value   T
+	err     error
+}
+
+func newCursor[T any](ctx context.Context, offset, limit int,
+	fetch fetchFunc[T]) *Cursor[T] {
+	cursor := &Cursor[T]{fetch: fetch, offset: offset, limit: limit}
+	cursor.ctx, cursor.cancel = context.WithCancel(ctx)
+	return cursor
+}
+
+// failedCursor returns a cursor which only reports err.
+func failedCursor[T any](err error) *Cursor[T] {
+	return &Cursor[T]{err: err, done: true, cancel: func() {}}
+}
+
+// Next advances to the next result. It returns false when there are no more
+// results, when ctx is done, when a request failed or after Close; Err tells
+// them apart.
+func (cursor *Cursor[T]) Next() bool {
+	if cursor.err != nil || cursor.closed {
+		return false
+	}
+	if err := cursor.ctx.Err(); err != nil {
+		cursor.fail(err)
+		return false
+	}
+	for cursor.pos >= len(cursor.items) {
+		if cursor.done {
+			cursor.Close()
+			return false
+		}
+		if cursor.pending == nil {
+			cursor.prefetch(cursor.offset)
+		}
+		var page page[T]
+		select {
+		case page = <-cursor.pending:
+		case <-cursor.ctx.Done():
+			cursor.fail(cursor.ctx.Err())
+			return false
+		}
+		cursor.pending = nil
+		if page.err != nil {
+			cursor.fail(page.err)
+			return false
+		}
+		if cursor.paged && page.total != cursor.total {
+			cursor.fail(ErrResultsChanged)
+			return false
+		}
+		cursor.total, cursor.paged = page.total, true
+
+		cursor.items, cursor.pos = page.items, 0
+		cursor.offset = page.next
+		if cursor.limit > 0 && cursor.count+len(page.items) >= cursor.limit {
+			cursor.items = page.items[:cursor.limit-cursor.count]
+			cursor.done = true
+		} else if !page.more {
+			cursor.done = true
+		} else {
+			cursor.prefetch(page.next)
+		}
+		cursor.count += len(cursor.items)
+	}
+	cursor.value = cursor.items[cursor.pos]
+	cursor.pos++
+	return true
+}
+
+// Value returns the result Next advanced to.
+func (cursor *Cursor[T]) Value() T {
+	return cursor.value
+}
+
+// Err returns the error which stopped the iteration, if any.
+func (cursor *Cursor[T]) Err() error {
+	return cursor.err
+}
+
+// Close stops the cursor and the request it has in flight. It is safe to
+// call Close more than once.
+func (cursor *Cursor[T]) Close() {
+	cursor.done = true
+	cursor.closed = true
+	cursor.cancel()
+}
+
+func (cursor *Cursor[T]) fail(err error) {
+	cursor.err = err
+	cursor.Close()
+}
+
+func (cursor *Cursor[T]) prefetch(offset int) {
+	pending := make(chan page[T], 1)
+	cursor.pending = pending
+	go func() {
+		pending <- cursor.fetch(cursor.ctx, offset)
+	}()
+}
+
+// seq adapts the cursors returned by open to an iterator. Each iteration
+// opens a new cursor, and yields the error which stopped it, if any, last.
+func seq[T any](open func() *Cursor[T]) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		cursor := open()
+		defer cursor.Close()
+		for cursor.Next() {
+			if !yield(cursor.Value(), nil) {
+				return
+			}
+		}
+		if err := cursor.Err(); err != nil {
+			var zero T
+			yield(zero, err)
+		}
+	}
+}
+
+// LogCursor returns a Cursor over the logs matching query. A query with
+// OrderBy is retrieved entirely before the first log is returned.
+func (bucket *Bucket) LogCursor(ctx context.Context, query LogQuery) *Cursor[Log] {
+	if err := query.Validate(); err != nil {
+		return failedCursor[Log](err)
+	}
+	if query.sortField != "" {
+		return newCursor(ctx, 0, 0, func(ctx context.Context, offset int) page[Log] {
+			logs, err := QueryLogs(ctx, bucket, query)
+			return page[Log]{items: logs.Logs, err: err}
+		})
+	}
+	return newCursor(ctx, 0, query.limit, logPages(bucket, query))
+}
+
+// Logs iterates over the logs matching query, like LogCursor:
+//
+//	for log, err := range bucket.Logs(ctx, query) {
+//		if err != nil {
+//			return err
+//		}
+//	}
+func (bucket *Bucket) Logs(ctx context.Context, query LogQuery) iter.Seq2[Log, error] {
+	return seq(func() *Cursor[Log] {
+		return bucket.LogCursor(ctx, query)
+	})
+}
+
+// MetricNameCursor returns a Cursor over the metric names matching
+// metricName, retrieving pageSize names per request, or DefaultPageSize if
+// it is 0.
+func (bucket *Bucket) MetricNameCursor(ctx context.Context, metricName string,
+	pageSize int) *Cursor[string] {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	return newCursor(ctx, 0, 0, func(ctx context.Context, offset int) page[string] {
+		names, err := bucket.GetMetricNamesCtx(ctx, metricName, offset, pageSize)
+		return page[string]{items: names, next: offset + len(names),
+			more: len(names) == pageSize, err: err}
+	})
+}
+
+// MetricNames iterates over the metric names matching metricName, like
+// MetricNameCursor.
+func (bucket *Bucket) MetricNames(ctx context.Context, metricName string,
+	pageSize int) iter.Seq2[string, error] {
+	return seq(func() *Cursor[string] {
+		return bucket.MetricNameCursor(ctx, metricName, pageSize)
+	})
+}
+
+// MetricValueCursor returns a Cursor over the values of the first series
+// of query, starting at its offset and stopping at its limit. The values
+// follow the columns given by MetricColumns.
+func (bucket *Bucket) MetricValueCursor(ctx context.Context,
+	query MetricQuery) *Cursor[Metric] {
+	return metricValueCursor(ctx, bucket, query)
+}
+
+func metricValueCursor(ctx context.Context, api MetricsAPI,
+	query MetricQuery) *Cursor[Metric] {
+	pageSize := query.pageSize
+	if pageSize == 0 {
+		pageSize = DefaultPageSize
+	}
+	prepared := false
+	return newCursor(ctx, query.offset, query.limit,
+		func(ctx context.Context, offset int) page[Metric] {
+			if !prepared {
+				var err error
+				if query, err = prepareMetricQuery(ctx, api, query); err != nil {
+					return page[Metric]{err: err}
+				}
+				prepared = true
+			}
+			series, err := sendMetricQuery(ctx, api, query, offset, pageSize)
+			if err != nil || len(series) == 0 {
+				return page[Metric]{err: err}
+			}
+			metrics := series[0].Metrics
+			return page[Metric]{items: metrics, next: offset + len(metrics),
+				more: len(metrics) == pageSize}
+		})
+}
+
+// MetricValues iterates over the values of the first series of query, like
+// MetricValueCursor.
+func (bucket *Bucket) MetricValues(ctx context.Context,
+	query MetricQuery) iter.Seq2[Metric, error] {
+	return seq(func() *Cursor[Metric] {
+		return bucket.MetricValueCursor(ctx, query)
+	})
+}
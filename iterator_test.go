@@ -0,0 +1,182 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLogsIterator(t *testing.T) {
+	server, source := newLogSource(25)
+	defer server.Close()
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+	bucket := zeus.Bucket("org1/bucket1")
+	ctx := context.Background()
+
+	query := NewLogQuery("syslog").Where(Field("level").Equals("error")).PageSize(10)
+	var seqs []interface{}
+	for log, err := range bucket.Logs(ctx, query) {
+		if err != nil {
+			t.Fatal("failed to iterate:", err)
+		}
+		seqs = append(seqs, log["seq"])
+	}
+	if len(seqs) != 9 || seqs[8] != 24.0 {
+		t.Error("wrong logs:", seqs)
+	}
+	if len(source.sent()) != 3 {
+		t.Errorf("expected 3 pages, got %d", len(source.sent()))
+	}
+
+	count := 0
+	for range bucket.Logs(ctx, query.Limit(4)) {
+		count++
+	}
+	if count != 4 {
+		t.Error("expected 4 logs with a limit, got", count)
+	}
+
+	for _, err := range bucket.Logs(ctx, NewLogQuery("")) {
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) {
+			t.Error("expected a validation error, got", err)
+		}
+	}
+}
+
+func TestLogCursorPrefetch(t *testing.T) {
+	server, source := newLogSource(25)
+	defer server.Close()
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+	cursor := zeus.Bucket("org1/bucket1").LogCursor(context.Background(),
+		NewLogQuery("syslog").PageSize(10))
+	defer cursor.Close()
+
+	if !cursor.Next() {
+		t.Fatal("expected a log:", cursor.Err())
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(source.sent()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if len(source.sent()) != 2 {
+		t.Fatal("the second page should be prefetched")
+	}
+
+	// The total shrinks to 12 after the second page was retrieved: the
+	// third page tells that the results changed.
+	source.reset(12)
+	count := 1
+	for cursor.Next() {
+		count++
+	}
+	if !errors.Is(cursor.Err(), ErrResultsChanged) || count != 20 {
+		t.Errorf("expected 20 logs and ErrResultsChanged, got %d, %v", count,
+			cursor.Err())
+	}
+}
+
+func TestLogCursorCancel(t *testing.T) {
+	server, _ := newLogSource(25)
+	defer server.Close()
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+	ctx, cancel := context.WithCancel(context.Background())
+	cursor := zeus.Bucket("org1/bucket1").LogCursor(ctx,
+		NewLogQuery("syslog").PageSize(10))
+	if !cursor.Next() {
+		t.Fatal("expected a log:", cursor.Err())
+	}
+	cancel()
+	if cursor.Next() || !errors.Is(cursor.Err(), context.Canceled) {
+		t.Error("expected the cursor to be canceled, got", cursor.Err())
+	}
+}
+
+func TestLogCursorClose(t *testing.T) {
+	server, _ := newLogSource(25)
+	defer server.Close()
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+	cursor := zeus.Bucket("org1/bucket1").LogCursor(context.Background(),
+		NewLogQuery("syslog").PageSize(10))
+	if !cursor.Next() {
+		t.Fatal("expected a log:", cursor.Err())
+	}
+	cursor.Close()
+	if cursor.Next() || cursor.Err() != nil {
+		t.Error("a closed cursor should stop without an error, got", cursor.Err())
+	}
+}
+
+func TestMetricNamesIterator(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+			limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+			names := []string{}
+			for i := offset; i < 7 && i < offset+limit; i++ {
+				names = append(names, fmt.Sprintf("metric%d", i))
+			}
+			json.NewEncoder(w).Encode(names)
+		}))
+	defer server.Close()
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+
+	var names []string
+	for name, err := range zeus.Bucket("org1/bucket1").MetricNames(context.Background(), "", 3) {
+		if err != nil {
+			t.Fatal("failed to iterate:", err)
+		}
+		names = append(names, name)
+	}
+	if len(names) != 7 || names[6] != "metric6" {
+		t.Error("wrong names:", names)
+	}
+}
+
+func TestMetricValuesIterator(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+			limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+			points := [][]float64{}
+			for i := offset; i < 50 && i < offset+limit; i++ {
+				points = append(points, []float64{float64(i), float64(i * 2)})
+			}
+			json.NewEncoder(w).Encode([]interface{}{map[string]interface{}{
+				"name": "cpu", "columns": []string{"time", "load"}, "points": points}})
+		}))
+	defer server.Close()
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+
+	query := NewMetricQuery("cpu").Offset(5).Limit(30).PageSize(8)
+	var metrics []Metric
+	for metric, err := range zeus.Bucket("org1/bucket1").MetricValues(context.Background(), query) {
+		if err != nil {
+			t.Fatal("failed to iterate:", err)
+		}
+		metrics = append(metrics, metric)
+	}
+	if len(metrics) != 30 || metrics[0].Timestamp != 5 || metrics[29].Point[0] != 68 {
+		t.Error("wrong metrics:", len(metrics), metrics)
+	}
+}
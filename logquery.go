@@ -0,0 +1,414 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LogField refers to a field of a log in a LogPredicate.
+type LogField string
+
+// Field returns the field name, to build a LogPredicate such as
+// Field("status").Ge(500).
+func Field(name string) LogField {
+	return LogField(name)
+}
+
+// LogPredicate is a condition on one field of a log.
+type LogPredicate struct {
+	field   string
+	op      string
+	value   interface{}
+	pattern *regexp.Regexp
+}
+
+// Matches is true when the field matches pattern, in which "*" matches any
+// text and "?" any character. The first Matches predicate of a query is
+// sent to Zeus; the others are checked by the client.
+func (field LogField) Matches(pattern string) LogPredicate {
+	return LogPredicate{field: string(field), op: "matches", value: pattern,
+		pattern: compileGlob(pattern)}
+}
+
+// Equals is true when the field equals value, comparing numbers by value.
+func (field LogField) Equals(value interface{}) LogPredicate {
+	return LogPredicate{field: string(field), op: "=", value: value}
+}
+
+// Contains is true when the field contains substr.
+func (field LogField) Contains(substr string) LogPredicate {
+	return LogPredicate{field: string(field), op: "contains", value: substr}
+}
+
+// Gt is true when the field is a number greater than value.
+func (field LogField) Gt(value float64) LogPredicate {
+	return LogPredicate{field: string(field), op: ">", value: value}
+}
+
+// Ge is true when the field is a number greater than or equal to value.
+func (field LogField) Ge(value float64) LogPredicate {
+	return LogPredicate{field: string(field), op: ">=", value: value}
+}
+
+// Lt is true when the field is a number less than value.
+func (field LogField) Lt(value float64) LogPredicate {
+	return LogPredicate{field: string(field), op: "<", value: value}
+}
+
+// Le is true when the field is a number less than or equal to value.
+func (field LogField) Le(value float64) LogPredicate {
+	return LogPredicate{field: string(field), op: "<=", value: value}
+}
+
+// Exists is true when the log has the field.
+func (field LogField) Exists() LogPredicate {
+	return LogPredicate{field: string(field), op: "exists"}
+}
+
+func (predicate LogPredicate) String() string {
+	if predicate.op == "exists" {
+		return predicate.field + " exists"
+	}
+	return fmt.Sprintf("%s %s %v", predicate.field, predicate.op, predicate.value)
+}
+
+// Match reports whether log satisfies the predicate.
+func (predicate LogPredicate) Match(log Log) bool {
+	raw, ok := log[predicate.field]
+	if predicate.op == "exists" || !ok {
+		return ok
+	}
+	switch predicate.op {
+	case "matches":
+		return predicate.pattern.MatchString(logText(raw))
+	case "contains":
+		return strings.Contains(logText(raw), predicate.value.(string))
+	case "=":
+		if _, isString := predicate.value.(string); !isString {
+			if want, ok := toFloat(predicate.value); ok {
+				got, ok := toFloat(raw)
+				return ok && got == want
+			}
+		}
+		return logText(raw) == logText(predicate.value)
+	}
+	got, ok := toFloat(raw)
+	if !ok {
+		return false
+	}
+	want, _ := predicate.value.(float64)
+	switch predicate.op {
+	case ">":
+		return got > want
+	case ">=":
+		return got >= want
+	case "<":
+		return got < want
+	case "<=":
+		return got <= want
+	}
+	return false
+}
+
+// logText returns the text of a log value.
+func logText(value interface{}) string {
+	if str, ok := value.(string); ok {
+		return str
+	}
+	return fmt.Sprint(value)
+}
+
+// compileGlob turns a pattern with "*" and "?" wildcards into a regexp.
+func compileGlob(pattern string) *regexp.Regexp {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String())
+}
+
+// SortOrder is the order of the logs returned for a LogQuery.
+type SortOrder int
+
+// Sort orders of a LogQuery.
+const (
+	Ascending SortOrder = iota
+	Descending
+)
+
+// DefaultPageSize is the number of entries retrieved per request when a
+// query doesn't set its page size.
+const DefaultPageSize = 100
+
+// LogQuery describes a query of logs, to be run with QueryLogs. Its
+// methods return a modified copy, so a query can be used as the base of
+// others:
+//
+//	failures := NewLogQuery("syslog").Where(Field("level").Equals("error"))
+//	logs, err := QueryLogs(ctx, bucket, failures.Since(time.Hour))
+type LogQuery struct {
+	name       string
+	predicates []LogPredicate
+	from, to   time.Time
+	sortField  string
+	order      SortOrder
+	pageSize   int
+	limit      int
+}
+
+// NewLogQuery returns a query of the logs named logName.
+func NewLogQuery(logName string) LogQuery {
+	return LogQuery{name: logName}
+}
+
+// Where keeps the logs satisfying every predicate, in addition to the
+// previous ones.
+func (query LogQuery) Where(predicates ...LogPredicate) LogQuery {
+	query.predicates = append(append([]LogPredicate(nil), query.predicates...),
+		predicates...)
+	return query
+}
+
+// Between keeps the logs between from and to. A zero time leaves that end
+// open. Zeus only filters on whole seconds, so logs in the seconds of from
+// and to are checked on the client against their "timestamp" field; logs
+// without one are kept.
+func (query LogQuery) Between(from, to time.Time) LogQuery {
+	query.from = from
+	query.to = to
+	return query
+}
+
+// Since keeps the logs of the last d, counted from when the query is built.
+func (query LogQuery) Since(d time.Duration) LogQuery {
+	query.from = time.Now().Add(-d)
+	query.to = time.Time{}
+	return query
+}
+
+// OrderBy sorts the logs by field, comparing numbers by value and other
+// values as text. Sorting needs every matching log, so Limit applies after
+// it rather than stopping the query early.
+func (query LogQuery) OrderBy(field string, order SortOrder) LogQuery {
+	query.sortField = field
+	query.order = order
+	return query
+}
+
+// PageSize sets the number of logs retrieved per request.
+func (query LogQuery) PageSize(n int) LogQuery {
+	query.pageSize = n
+	return query
+}
+
+// Limit returns at most n logs. Zero returns them all.
+func (query LogQuery) Limit(n int) LogQuery {
+	query.limit = n
+	return query
+}
+
+// Validate checks the query. It returns a *ValidationError naming the
+// invalid part.
+func (query LogQuery) Validate() error {
+	if query.name == "" {
+		return &ValidationError{Field: "log_name", Reason: "is required"}
+	}
+	for _, predicate := range query.predicates {
+		if predicate.field == "" {
+			return &ValidationError{Field: "attribute_name",
+				Reason: fmt.Sprintf("predicate %q has no field", predicate.String())}
+		}
+	}
+	if !query.from.IsZero() && !query.to.IsZero() && query.to.Before(query.from) {
+		return &ValidationError{Field: "to", Reason: "is before from"}
+	}
+	if query.pageSize < 0 || query.limit < 0 {
+		return &ValidationError{Field: "limit",
+			Reason: "page size and limit can't be negative"}
+	}
+	return nil
+}
+
+// Match reports whether log satisfies every predicate of the query.
+func (query LogQuery) Match(log Log) bool {
+	for _, predicate := range query.predicates {
+		if !predicate.Match(log) {
+			return false
+		}
+	}
+	return true
+}
+
+// serverPattern returns the index of the predicate sent to Zeus, or -1.
+func (query LogQuery) serverPattern() int {
+	for idx, predicate := range query.predicates {
+		if predicate.op == "matches" {
+			return idx
+		}
+	}
+	return -1
+}
+
+// clientMatch checks the predicates Zeus didn't, and the fractions of
+// seconds of the time range.
+func (query LogQuery) clientMatch(log Log, server int) bool {
+	for idx, predicate := range query.predicates {
+		if idx != server && !predicate.Match(log) {
+			return false
+		}
+	}
+	if timestamp, ok := toFloat(log["timestamp"]); ok {
+		if !query.from.IsZero() && timestamp < UnixSeconds(query.from) {
+			return false
+		}
+		if !query.to.IsZero() && timestamp > UnixSeconds(query.to) {
+			return false
+		}
+	}
+	return true
+}
+
+// logPage retrieves the logs of query from offset, before client-side
+// filtering.
+func logPage(ctx context.Context, api LogsAPI, query LogQuery,
+	offset int) (total int, logs LogList, err error) {
+	var field, pattern string
+	if server := query.serverPattern(); server >= 0 {
+		field = query.predicates[server].field
+		pattern = query.predicates[server].value.(string)
+	}
+	var from, to int64
+	if !query.from.IsZero() {
+		from = query.from.Unix()
+	}
+	if !query.to.IsZero() {
+		to = query.to.Unix()
+		if query.to.Nanosecond() != 0 {
+			to++
+		}
+	}
+	pageSize := query.pageSize
+	if pageSize == 0 {
+		pageSize = DefaultPageSize
+	}
+	return api.GetLogsCtx(ctx, query.name, field, pattern, from, to, offset,
+		pageSize)
+}
+
+// logPages returns the pages of logs matching query.
+func logPages(api LogsAPI, query LogQuery) fetchFunc[Log] {
+	server := query.serverPattern()
+	return func(ctx context.Context, offset int) page[Log] {
+		total, logs, err := logPage(ctx, api, query, offset)
+		if err != nil {
+			return page[Log]{err: err}
+		}
+		result := page[Log]{next: offset + len(logs.Logs), total: total}
+		for _, log := range logs.Logs {
+			if query.clientMatch(log, server) {
+				result.items = append(result.items, log)
+			}
+		}
+		result.more = len(logs.Logs) > 0 && result.next < total
+		return result
+	}
+}
+
+// scanLogs calls yield with each log matching query, in the order of Zeus,
+// until yield returns false.
+func scanLogs(ctx context.Context, api LogsAPI, query LogQuery,
+	yield func(log Log) bool) error {
+	if err := query.Validate(); err != nil {
+		return err
+	}
+	fetch := logPages(api, query)
+	for offset := 0; ; {
+		page := fetch(ctx, offset)
+		if page.err != nil {
+			return page.err
+		}
+		for _, log := range page.items {
+			if !yield(log) {
+				return nil
+			}
+		}
+		if !page.more {
+			return nil
+		}
+		offset = page.next
+	}
+}
+
+// QueryLogs runs query with the GetLogs of api, retrieving as many pages as
+// needed, and returns the matching logs.
+func QueryLogs(ctx context.Context, api LogsAPI, query LogQuery) (
+	LogList, error) {
+	result := LogList{Name: query.name}
+	sorted := query.sortField != ""
+	err := scanLogs(ctx, api, query, func(log Log) bool {
+		result.Logs = append(result.Logs, log)
+		return sorted || query.limit == 0 || len(result.Logs) < query.limit
+	})
+	if err != nil {
+		return LogList{}, err
+	}
+	if sorted {
+		sortLogs(result.Logs, query.sortField, query.order)
+		if query.limit > 0 && len(result.Logs) > query.limit {
+			result.Logs = result.Logs[:query.limit]
+		}
+	}
+	return result, nil
+}
+
+// sortLogs sorts logs by field. Logs without the field come last.
+func sortLogs(logs []Log, field string, order SortOrder) {
+	less := func(a, b interface{}) bool {
+		fa, aNum := toFloat(a)
+		fb, bNum := toFloat(b)
+		_, aString := a.(string)
+		_, bString := b.(string)
+		if aNum && bNum && !aString && !bString {
+			return fa < fb
+		}
+		return logText(a) < logText(b)
+	}
+	sort.SliceStable(logs, func(i, j int) bool {
+		a, aOk := logs[i][field]
+		b, bOk := logs[j][field]
+		if !aOk || !bOk {
+			return aOk && !bOk
+		}
+		if order == Descending {
+			return less(b, a)
+		}
+		return less(a, b)
+	})
+}
@@ -0,0 +1,182 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLogPredicateMatch(t *testing.T) {
+	log := Log{"message": "disk /dev/sda1 full", "status": 503.0, "code": "42"}
+	for _, test := range []struct {
+		predicate LogPredicate
+		match     bool
+	}{
+		{Field("message").Matches("disk * full"), true},
+		{Field("message").Matches("disk ?"), false},
+		{Field("message").Matches("*sda?*"), true},
+		{Field("message").Contains("/dev/"), true},
+		{Field("status").Equals(503), true},
+		{Field("status").Equals("503"), true},
+		{Field("code").Equals(42), true},
+		{Field("code").Equals("42.0"), false},
+		{Field("status").Ge(500), true},
+		{Field("status").Lt(500), false},
+		{Field("message").Gt(0), false},
+		{Field("status").Exists(), true},
+		{Field("missing").Exists(), false},
+		{Field("missing").Le(1), false},
+	} {
+		if test.predicate.Match(log) != test.match {
+			t.Errorf("%s: expected %v", test.predicate, test.match)
+		}
+	}
+}
+
+func TestLogQueryValidate(t *testing.T) {
+	now := time.Now()
+	for field, query := range map[string]LogQuery{
+		"log_name":       NewLogQuery(""),
+		"attribute_name": NewLogQuery("syslog").Where(Field("").Exists()),
+		"to":             NewLogQuery("syslog").Between(now, now.Add(-time.Second)),
+		"limit":          NewLogQuery("syslog").PageSize(-1),
+	} {
+		var validationErr *ValidationError
+		if err := query.Validate(); !errors.As(err, &validationErr) ||
+			validationErr.Field != field {
+			t.Errorf("expected a validation error on %s, got %v", field, err)
+		}
+	}
+}
+
+type logSource struct {
+	sync.Mutex
+	count    int
+	requests []url.Values
+}
+
+// newLogSource serves count logs, {"seq": i, "level": "error" or "info"},
+// honoring offset and limit.
+func newLogSource(count int) (*httptest.Server, *logSource) {
+	source := &logSource{count: count}
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			source.Lock()
+			source.requests = append(source.requests, query)
+			count := source.count
+			source.Unlock()
+			offset, _ := strconv.Atoi(query.Get("offset"))
+			limit, _ := strconv.Atoi(query.Get("limit"))
+			var logs []Log
+			for i := offset; i < count && i < offset+limit; i++ {
+				level := "info"
+				if i%3 == 0 {
+					level = "error"
+				}
+				logs = append(logs, Log{"seq": i, "level": level})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"total": count, "result": logs})
+		}))
+	return server, source
+}
+
+func (source *logSource) sent() []url.Values {
+	source.Lock()
+	defer source.Unlock()
+	return append([]url.Values(nil), source.requests...)
+}
+
+func (source *logSource) reset(count int) {
+	source.Lock()
+	defer source.Unlock()
+	source.count = count
+	source.requests = nil
+}
+
+func TestQueryLogs(t *testing.T) {
+	server, source := newLogSource(25)
+	defer server.Close()
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+	bucket := zeus.Bucket("org1/bucket1")
+	ctx := context.Background()
+
+	from := time.Unix(1430355860, 0)
+	query := NewLogQuery("syslog").
+		Where(Field("message").Matches("*"), Field("level").Equals("error")).
+		Between(from, from.Add(1500*time.Millisecond)).
+		PageSize(10)
+	logs, err := QueryLogs(ctx, bucket, query)
+	if err != nil {
+		t.Fatal("failed to query:", err)
+	}
+	if len(logs.Logs) != 9 || logs.Name != "syslog" {
+		t.Errorf("expected 9 logs, got %v", logs)
+	}
+	if len(source.sent()) != 3 {
+		t.Errorf("expected 3 pages, got %d", len(source.sent()))
+	}
+	first := source.sent()[0]
+	if first.Get("attribute_name") != "message" || first.Get("pattern") != "*" ||
+		first.Get("from") != "1430355860" || first.Get("to") != "1430355862" ||
+		first.Get("limit") != "10" {
+		t.Error("wrong parameters:", first)
+	}
+
+	source.reset(25)
+	logs, err = QueryLogs(ctx, bucket, query.Limit(2))
+	if err != nil || len(logs.Logs) != 2 || len(source.sent()) != 1 {
+		t.Error("limit should stop the query early:", logs, err, len(source.sent()))
+	}
+
+	logs, err = QueryLogs(ctx, bucket, query.OrderBy("seq", Descending).Limit(2))
+	if err != nil || len(logs.Logs) != 2 || logs.Logs[0]["seq"] != 24.0 ||
+		logs.Logs[1]["seq"] != 21.0 {
+		t.Error("wrong sorted logs:", logs, err)
+	}
+}
+
+func TestQueryLogsFractionalRange(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"total": 4, "result": [{"timestamp": 1430355860.2},
+				{"timestamp": 1430355860.7}, {"timestamp": 1430355861.4},
+				{"timestamp": 1430355861.6}]}`)
+		}))
+	defer server.Close()
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+
+	from := time.Unix(1430355860, 500000000)
+	query := NewLogQuery("syslog").Between(from, from.Add(time.Second))
+	logs, err := QueryLogs(context.Background(), zeus.Bucket("org1/bucket1"), query)
+	if err != nil {
+		t.Fatal("failed to query:", err)
+	}
+	if len(logs.Logs) != 2 || logs.Logs[0]["timestamp"] != 1430355860.7 ||
+		logs.Logs[1]["timestamp"] != 1430355861.4 {
+		t.Error("logs outside the range were kept:", logs.Logs)
+	}
+}
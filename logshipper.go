@@ -0,0 +1,350 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LogShipperConfig configures a LogShipper. Zero fields take their value
+// from DefaultLogShipperConfig.
+type LogShipperConfig struct {
+	// MaxBatchSize is the number of logs which triggers sending a batch.
+	MaxBatchSize int
+	// MaxBatchBytes is the JSON size of logs which triggers sending a batch.
+	MaxBatchBytes int
+	// FlushInterval is the age at which a batch is sent. Batches are
+	// checked every FlushInterval/2, so a log waits up to about 1.5 times
+	// FlushInterval, plus the time a worker takes to pick the batch up.
+	FlushInterval time.Duration
+	// Workers is the number of batches sent concurrently.
+	Workers int
+	// QueueSize is the number of logs buffered before Send drops them.
+	QueueSize int
+	// OnError, if set, is called from a worker with every batch which failed
+	// to be sent. A log which can't be encoded to JSON is passed to it alone,
+	// from the goroutine batching logs, which waits for it to return.
+	OnError func(logs LogList, err error)
+	// Spool, if set, stores batches which failed because Zeus couldn't be
+	// reached, to be replayed later.
+	Spool *Spool
+}
+
+// DefaultLogShipperConfig holds the defaults of LogShipperConfig.
+var DefaultLogShipperConfig = LogShipperConfig{
+	MaxBatchSize:  500,
+	MaxBatchBytes: 1 << 20,
+	FlushInterval: time.Second,
+	Workers:       2,
+	QueueSize:     10000,
+}
+
+// LogShipperStats counts the logs handled by a LogShipper.
+type LogShipperStats struct {
+	// Sent is the number of logs Zeus accepted.
+	Sent int64
+	// Failed is the number of logs which could not be sent or which Zeus
+	// rejected.
+	Failed int64
+	// Dropped is the number of logs Send refused because the queue was full
+	// or the shipper was closed.
+	Dropped int64
+	// Spooled is the number of logs written to the spool.
+	Spooled int64
+}
+
+// LogShipper sends logs to a bucket in the background. Logs given to Send
+// are batched per log name and sent with PostLogs when a batch is full or
+// old enough. A LogShipper is safe for concurrent use.
+type LogShipper struct {
+	api    LogsAPI
+	config LogShipperConfig
+
+	mu      sync.RWMutex
+	closed  bool
+	queue   chan logEntry
+	flushes chan chan []chan struct{}
+	batches chan *logBatch
+	stopped chan struct{}
+	workers sync.WaitGroup
+
+	closeOnce sync.Once
+	closeErr  error
+
+	// ctx is canceled when Close gives up, to abort requests in flight.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	inflightMu sync.Mutex
+	inflight   map[*logBatch]struct{}
+
+	sent, failed, dropped, spooled int64
+}
+
+type logEntry struct {
+	name string
+	log  Log
+}
+
+type logBatch struct {
+	logs    LogList
+	bytes   int
+	started time.Time
+	done    chan struct{}
+}
+
+// NewLogShipper starts a LogShipper sending logs with api.
+func NewLogShipper(api LogsAPI, config LogShipperConfig) *LogShipper {
+	if config.MaxBatchSize <= 0 {
+		config.MaxBatchSize = DefaultLogShipperConfig.MaxBatchSize
+	}
+	if config.MaxBatchBytes <= 0 {
+		config.MaxBatchBytes = DefaultLogShipperConfig.MaxBatchBytes
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = DefaultLogShipperConfig.FlushInterval
+	}
+	if config.Workers <= 0 {
+		config.Workers = DefaultLogShipperConfig.Workers
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultLogShipperConfig.QueueSize
+	}
+
+	shipper := &LogShipper{
+		api:      api,
+		config:   config,
+		queue:    make(chan logEntry, config.QueueSize),
+		flushes:  make(chan chan []chan struct{}),
+		batches:  make(chan *logBatch),
+		stopped:  make(chan struct{}),
+		inflight: make(map[*logBatch]struct{}),
+	}
+	shipper.ctx, shipper.cancel = context.WithCancel(context.Background())
+	for i := 0; i < config.Workers; i++ {
+		shipper.workers.Add(1)
+		go shipper.work()
+	}
+	go shipper.batch()
+	return shipper
+}
+
+// Send queues log under logName without blocking. It returns false when the
+// log was dropped because the queue is full or the shipper is closed.
+func (shipper *LogShipper) Send(logName string, log Log) bool {
+	shipper.mu.RLock()
+	defer shipper.mu.RUnlock()
+	if !shipper.closed && logName != "" {
+		select {
+		case shipper.queue <- logEntry{name: logName, log: log}:
+			return true
+		default:
+		}
+	}
+	atomic.AddInt64(&shipper.dropped, 1)
+	return false
+}
+
+// Flush sends every log queued before the call and waits until they are
+// sent, or until ctx is done.
+func (shipper *LogShipper) Flush(ctx context.Context) error {
+	reply := make(chan []chan struct{}, 1)
+	select {
+	case shipper.flushes <- reply:
+	case <-shipper.stopped:
+		// Closed: Close sends the queued logs.
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	var pending []chan struct{}
+	select {
+	case pending = <-reply:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	for _, done := range pending {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Close stops accepting logs, sends the queued ones and waits for them. If
+// ctx is done first, requests in flight are aborted and ctx's error is
+// returned. Calling Close again returns the result of the first call.
+func (shipper *LogShipper) Close(ctx context.Context) error {
+	shipper.closeOnce.Do(func() {
+		shipper.closeErr = shipper.close(ctx)
+	})
+	return shipper.closeErr
+}
+
+func (shipper *LogShipper) close(ctx context.Context) error {
+	shipper.mu.Lock()
+	shipper.closed = true
+	close(shipper.queue)
+	shipper.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		shipper.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		shipper.cancel()
+		return nil
+	case <-ctx.Done():
+		shipper.cancel()
+		return ctx.Err()
+	}
+}
+
+// Stats returns the number of logs sent, failed and dropped so far.
+func (shipper *LogShipper) Stats() LogShipperStats {
+	return LogShipperStats{
+		Sent:    atomic.LoadInt64(&shipper.sent),
+		Failed:  atomic.LoadInt64(&shipper.failed),
+		Dropped: atomic.LoadInt64(&shipper.dropped),
+		Spooled: atomic.LoadInt64(&shipper.spooled),
+	}
+}
+
+// batch collects queued logs into batches and hands them to the workers.
+func (shipper *LogShipper) batch() {
+	defer close(shipper.stopped)
+	defer close(shipper.batches)
+	pending := make(map[string]*logBatch)
+	tick := shipper.config.FlushInterval / 2
+	if tick <= 0 {
+		tick = shipper.config.FlushInterval
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	add := func(entry logEntry) {
+		js, err := json.Marshal(entry.log)
+		if err != nil {
+			shipper.fail(LogList{Name: entry.name, Logs: []Log{entry.log}}, err)
+			return
+		}
+		batch, ok := pending[entry.name]
+		if ok && batch.bytes+len(js) > shipper.config.MaxBatchBytes {
+			shipper.dispatch(batch)
+			ok = false
+		}
+		if !ok {
+			batch = &logBatch{logs: LogList{Name: entry.name}, started: time.Now()}
+			pending[entry.name] = batch
+		}
+		batch.logs.Logs = append(batch.logs.Logs, entry.log)
+		batch.bytes += len(js)
+		if len(batch.logs.Logs) >= shipper.config.MaxBatchSize ||
+			batch.bytes >= shipper.config.MaxBatchBytes {
+			shipper.dispatch(batch)
+			delete(pending, entry.name)
+		}
+	}
+	dispatchAll := func() {
+		for name, batch := range pending {
+			shipper.dispatch(batch)
+			delete(pending, name)
+		}
+	}
+
+	for {
+		select {
+		case entry, ok := <-shipper.queue:
+			if !ok {
+				dispatchAll()
+				return
+			}
+			add(entry)
+		case reply := <-shipper.flushes:
+			// Take in what was queued before the flush.
+			for n := len(shipper.queue); n > 0; n-- {
+				entry, ok := <-shipper.queue
+				if !ok {
+					break
+				}
+				add(entry)
+			}
+			dispatchAll()
+			reply <- shipper.pending()
+		case now := <-ticker.C:
+			for name, batch := range pending {
+				if now.Sub(batch.started) >= shipper.config.FlushInterval {
+					shipper.dispatch(batch)
+					delete(pending, name)
+				}
+			}
+		}
+	}
+}
+
+func (shipper *LogShipper) dispatch(batch *logBatch) {
+	batch.done = make(chan struct{})
+	shipper.inflightMu.Lock()
+	shipper.inflight[batch] = struct{}{}
+	shipper.inflightMu.Unlock()
+	shipper.batches <- batch
+}
+
+// pending returns the done channels of the batches not sent yet.
+func (shipper *LogShipper) pending() []chan struct{} {
+	shipper.inflightMu.Lock()
+	defer shipper.inflightMu.Unlock()
+	pending := make([]chan struct{}, 0, len(shipper.inflight))
+	for batch := range shipper.inflight {
+		pending = append(pending, batch.done)
+	}
+	return pending
+}
+
+func (shipper *LogShipper) work() {
+	defer shipper.workers.Done()
+	for batch := range shipper.batches {
+		successful, err := shipper.api.PostLogsCtx(shipper.ctx, batch.logs)
+		if err != nil && shipper.config.Spool != nil && IsTransient(err) &&
+			shipper.config.Spool.StoreLogs(batch.logs) == nil {
+			atomic.AddInt64(&shipper.spooled, int64(len(batch.logs.Logs)))
+		} else if err != nil {
+			shipper.fail(batch.logs, err)
+		} else {
+			atomic.AddInt64(&shipper.sent, int64(successful))
+			atomic.AddInt64(&shipper.failed, int64(len(batch.logs.Logs)-successful))
+		}
+
+		shipper.inflightMu.Lock()
+		delete(shipper.inflight, batch)
+		shipper.inflightMu.Unlock()
+		close(batch.done)
+	}
+}
+
+func (shipper *LogShipper) fail(logs LogList, err error) {
+	atomic.AddInt64(&shipper.failed, int64(len(logs.Logs)))
+	if shipper.config.OnError != nil {
+		shipper.config.OnError(logs, err)
+	}
+}
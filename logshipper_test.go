@@ -0,0 +1,208 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// logSink is a server storing the logs posted to it per log name.
+type logSink struct {
+	sync.Mutex
+	requests int
+	logs     map[string][]Log
+}
+
+func newLogSink() (*httptest.Server, *logSink) {
+	sink := &logSink{logs: make(map[string][]Log)}
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			// POST bodies are sent without a Content-Type, so r.FormValue
+			// can't be used.
+			reqBody, _ := ioutil.ReadAll(r.Body)
+			param, _ := url.ParseQuery(string(reqBody))
+			var logs []Log
+			if err := json.Unmarshal([]byte(param.Get("logs")), &logs); err != nil {
+				w.WriteHeader(400)
+				return
+			}
+			name := strings.Split(strings.Trim(r.URL.Path, "/"), "/")[2]
+			sink.Lock()
+			sink.requests++
+			sink.logs[name] = append(sink.logs[name], logs...)
+			sink.Unlock()
+			fmt.Fprintf(w, `{"successful": %d}`, len(logs))
+		}))
+	return server, sink
+}
+
+func (sink *logSink) count(name string) int {
+	sink.Lock()
+	defer sink.Unlock()
+	return len(sink.logs[name])
+}
+
+func TestLogShipperBatchSize(t *testing.T) {
+	server, sink := newLogSink()
+	defer server.Close()
+
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+	shipper := NewLogShipper(zeus.Bucket("org1/bucket1"), LogShipperConfig{
+		MaxBatchSize:  10,
+		FlushInterval: time.Hour,
+	})
+	for i := 0; i < 25; i++ {
+		shipper.Send("syslog", Log{"seq": i})
+		shipper.Send("applog", Log{"seq": i})
+	}
+	if err := shipper.Flush(context.Background()); err != nil {
+		t.Fatal("failed to flush:", err)
+	}
+	if sink.count("syslog") != 25 || sink.count("applog") != 25 {
+		t.Error("flush did not send every log:", sink.count("syslog"),
+			sink.count("applog"))
+	}
+	if sink.requests != 6 {
+		t.Errorf("logs were sent in %d requests, expected 6", sink.requests)
+	}
+	if err := shipper.Close(context.Background()); err != nil {
+		t.Error("failed to close:", err)
+	}
+	if err := shipper.Close(context.Background()); err != nil {
+		t.Error("failed to close twice:", err)
+	}
+	stats := shipper.Stats()
+	if stats.Sent != 50 || stats.Failed != 0 || stats.Dropped != 0 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+}
+
+func TestLogShipperBatchBytes(t *testing.T) {
+	server, sink := newLogSink()
+	defer server.Close()
+
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+	shipper := NewLogShipper(zeus.Bucket("org1/bucket1"), LogShipperConfig{
+		MaxBatchBytes: 120,
+		FlushInterval: time.Hour,
+	})
+	for i := 0; i < 10; i++ {
+		shipper.Send("syslog", Log{"message": strings.Repeat("x", 40)})
+	}
+	shipper.Close(context.Background())
+	if sink.count("syslog") != 10 || sink.requests != 5 {
+		t.Errorf("sent %d logs in %d requests, expected 10 in 5",
+			sink.count("syslog"), sink.requests)
+	}
+}
+
+func TestLogShipperFlushInterval(t *testing.T) {
+	server, sink := newLogSink()
+	defer server.Close()
+
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+	shipper := NewLogShipper(zeus.Bucket("org1/bucket1"), LogShipperConfig{
+		FlushInterval: 20 * time.Millisecond,
+	})
+	defer shipper.Close(context.Background())
+	shipper.Send("syslog", Log{"foo": "bar"})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for sink.count("syslog") == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if sink.count("syslog") != 1 {
+		t.Error("old batch was not sent")
+	}
+}
+
+func TestLogShipperFailures(t *testing.T) {
+	server, bucket := fail(503, "down")
+	defer server.Close()
+
+	var mu sync.Mutex
+	var failed []LogList
+	shipper := NewLogShipper(bucket, LogShipperConfig{
+		OnError: func(logs LogList, err error) {
+			if !IsServerError(err) {
+				t.Error("unexpected error:", err)
+			}
+			mu.Lock()
+			failed = append(failed, logs)
+			mu.Unlock()
+		},
+	})
+	shipper.Send("syslog", Log{"foo": "bar"})
+	shipper.Send("syslog", Log{"foo": "tar"})
+	shipper.Send("", Log{"foo": "woo"})
+	if err := shipper.Close(context.Background()); err != nil {
+		t.Error("failed to close:", err)
+	}
+	if shipper.Send("syslog", Log{"foo": "bar"}) {
+		t.Error("should drop logs after close")
+	}
+	if err := shipper.Flush(context.Background()); err != nil {
+		t.Error("flush after close should be a no-op:", err)
+	}
+
+	stats := shipper.Stats()
+	if stats.Sent != 0 || stats.Failed != 2 || stats.Dropped != 2 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+	if len(failed) != 1 || len(failed[0].Logs) != 2 {
+		t.Error("OnError got wrong batches:", failed)
+	}
+}
+
+func TestLogShipperCloseTimeout(t *testing.T) {
+	server, release := stall()
+	defer server.Close()
+	defer close(release)
+
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+	shipper := NewLogShipper(zeus.Bucket("org1/bucket1"), LogShipperConfig{
+		QueueSize: 1,
+		Workers:   1,
+	})
+	for i := 0; i < 100; i++ {
+		shipper.Send("syslog", Log{"seq": i})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := shipper.Flush(ctx); err != context.DeadlineExceeded {
+		t.Error("flush should time out, got", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := shipper.Close(ctx); err != context.DeadlineExceeded {
+		t.Error("close should time out, got", err)
+	}
+	if err := shipper.Close(context.Background()); err != context.DeadlineExceeded {
+		t.Error("a second close should return the first result, got", err)
+	}
+	if shipper.Stats().Dropped == 0 {
+		t.Error("a full queue should drop logs")
+	}
+}
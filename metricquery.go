@@ -0,0 +1,383 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Aggregator is a function aggregating metric values.
+type Aggregator string
+
+// Aggregators supported by Zeus.
+const (
+	Count  Aggregator = "count"
+	Min    Aggregator = "min"
+	Max    Aggregator = "max"
+	Sum    Aggregator = "sum"
+	Mean   Aggregator = "mean"
+	Mode   Aggregator = "mode"
+	Median Aggregator = "median"
+)
+
+func (aggregator Aggregator) valid() bool {
+	switch aggregator {
+	case Count, Min, Max, Sum, Mean, Mode, Median:
+		return true
+	}
+	return false
+}
+
+// Filter is a condition on the columns of a metric, built with Col, And and
+// Or. Its String is the filter_condition sent to Zeus.
+type Filter interface {
+	String() string
+	// columns returns the columns the condition refers to.
+	columns() []string
+}
+
+// Column refers to a column of a metric in a Filter.
+type Column string
+
+// Col returns the column name, to build a Filter such as
+// Col("age").Gt(10).
+func Col(name string) Column {
+	return Column(name)
+}
+
+type comparison struct {
+	column Column
+	op     string
+	value  float64
+}
+
+func (cmp comparison) String() string {
+	return string(cmp.column) + " " + cmp.op + " " +
+		strconv.FormatFloat(cmp.value, 'f', -1, 64)
+}
+
+func (cmp comparison) columns() []string {
+	return []string{string(cmp.column)}
+}
+
+// Eq is true when the column equals value.
+func (col Column) Eq(value float64) Filter { return comparison{col, "=", value} }
+
+// Ne is true when the column differs from value.
+func (col Column) Ne(value float64) Filter { return comparison{col, "!=", value} }
+
+// Gt is true when the column is greater than value.
+func (col Column) Gt(value float64) Filter { return comparison{col, ">", value} }
+
+// Ge is true when the column is greater than or equal to value.
+func (col Column) Ge(value float64) Filter { return comparison{col, ">=", value} }
+
+// Lt is true when the column is less than value.
+func (col Column) Lt(value float64) Filter { return comparison{col, "<", value} }
+
+// Le is true when the column is less than or equal to value.
+func (col Column) Le(value float64) Filter { return comparison{col, "<=", value} }
+
+type junction struct {
+	op      string
+	filters []Filter
+}
+
+func (j junction) String() string {
+	parts := make([]string, 0, len(j.filters))
+	for _, filter := range j.filters {
+		if filter == nil {
+			continue
+		}
+		if inner, ok := filter.(junction); ok && len(inner.filters) > 1 {
+			parts = append(parts, "("+inner.String()+")")
+		} else {
+			parts = append(parts, filter.String())
+		}
+	}
+	return strings.Join(parts, " "+j.op+" ")
+}
+
+func (j junction) columns() []string {
+	var columns []string
+	for _, filter := range j.filters {
+		if filter != nil {
+			columns = append(columns, filter.columns()...)
+		}
+	}
+	return columns
+}
+
+// And is true when every filter is. Nil filters are ignored.
+func And(filters ...Filter) Filter { return junction{"and", filters} }
+
+// Or is true when any filter is. Nil filters are ignored.
+func Or(filters ...Filter) Filter { return junction{"or", filters} }
+
+// MetricQuery describes a query of metric values, to be run with
+// Bucket.QueryMetrics. Its methods return a modified copy, so a query can
+// be used as the base of others:
+//
+//	base := NewMetricQuery("cpu").Since(time.Hour)
+//	busy, err := bucket.QueryMetrics(ctx, base.Where(Col("load").Gt(0.9)))
+type MetricQuery struct {
+	name       string
+	aggregator Aggregator
+	column     string
+	interval   time.Duration
+	from, to   time.Time
+	filter     Filter
+	offset     int
+	limit      int
+	pageSize   int
+	columns    []string
+}
+
+// NewMetricQuery returns a query of the values of metricName.
+func NewMetricQuery(metricName string) MetricQuery {
+	return MetricQuery{name: metricName}
+}
+
+// Aggregate aggregates the values of column with aggregator.
+func (query MetricQuery) Aggregate(aggregator Aggregator, column string) MetricQuery {
+	query.aggregator = aggregator
+	query.column = column
+	return query
+}
+
+// GroupBy aggregates values in windows of interval, which must be a whole
+// number of seconds.
+func (query MetricQuery) GroupBy(interval time.Duration) MetricQuery {
+	query.interval = interval
+	return query
+}
+
+// Between keeps the values between from and to. A zero time leaves that
+// end open.
+func (query MetricQuery) Between(from, to time.Time) MetricQuery {
+	query.from = from
+	query.to = to
+	return query
+}
+
+// Since keeps the values of the last d, counted from when the query is
+// built.
+func (query MetricQuery) Since(d time.Duration) MetricQuery {
+	query.from = time.Now().Add(-d)
+	query.to = time.Time{}
+	return query
+}
+
+// Where keeps the values matching filter.
+func (query MetricQuery) Where(filter Filter) MetricQuery {
+	query.filter = filter
+	return query
+}
+
+// Offset skips the first n values.
+func (query MetricQuery) Offset(n int) MetricQuery {
+	query.offset = n
+	return query
+}
+
+// Limit returns at most n values.
+func (query MetricQuery) Limit(n int) MetricQuery {
+	query.limit = n
+	return query
+}
+
+// PageSize sets the number of values retrieved per request when iterating
+// with Bucket.MetricValues.
+func (query MetricQuery) PageSize(n int) MetricQuery {
+	query.pageSize = n
+	return query
+}
+
+// Columns declares the columns of the metric, which Validate checks the
+// aggregated column and the filter against. Without them, QueryMetrics
+// retrieves the columns from Zeus when the query refers to any.
+func (query MetricQuery) Columns(columns ...string) MetricQuery {
+	query.columns = append([]string(nil), columns...)
+	return query
+}
+
+// Validate checks the query and, if columns were declared, that the columns
+// it refers to exist. It returns a *ValidationError naming the invalid
+// part.
+func (query MetricQuery) Validate() error {
+	if query.name == "" {
+		return &ValidationError{Field: "metric_name", Reason: "is required"}
+	}
+	if query.aggregator != "" && !query.aggregator.valid() {
+		return &ValidationError{Field: "aggregator_function",
+			Reason: fmt.Sprintf("unknown aggregator %q", query.aggregator)}
+	}
+	if query.column != "" && query.aggregator == "" {
+		return &ValidationError{Field: "aggregator_column",
+			Reason: "needs an aggregator"}
+	}
+	if query.interval != 0 {
+		if _, err := formatInterval(query.interval); err != nil {
+			return &ValidationError{Field: "group_interval", Reason: err.Error()}
+		}
+	}
+	if !query.from.IsZero() && !query.to.IsZero() && query.to.Before(query.from) {
+		return &ValidationError{Field: "to", Reason: "is before from"}
+	}
+	if query.offset < 0 || query.limit < 0 || query.pageSize < 0 {
+		return &ValidationError{Field: "limit",
+			Reason: "offset, limit and page size can't be negative"}
+	}
+	if query.columns == nil {
+		return nil
+	}
+	known := make(map[string]bool, len(query.columns))
+	for _, col := range query.columns {
+		known[col] = true
+	}
+	for _, col := range query.referenced() {
+		if !known[col] {
+			return &ValidationError{Field: col,
+				Reason: fmt.Sprintf("no such column in metric %s", query.name)}
+		}
+	}
+	return nil
+}
+
+// referenced returns the columns the query refers to.
+func (query MetricQuery) referenced() []string {
+	var columns []string
+	if query.column != "" {
+		columns = append(columns, query.column)
+	}
+	if query.filter != nil {
+		columns = append(columns, query.filter.columns()...)
+	}
+	return columns
+}
+
+// formatInterval formats d as a group_interval such as "30s" or "2h".
+func formatInterval(d time.Duration) (string, error) {
+	if d <= 0 || d%time.Second != 0 {
+		return "", errors.New("must be a positive whole number of seconds")
+	}
+	units := []struct {
+		suffix string
+		size   time.Duration
+	}{
+		{"w", 7 * 24 * time.Hour},
+		{"d", 24 * time.Hour},
+		{"h", time.Hour},
+		{"m", time.Minute},
+		{"s", time.Second},
+	}
+	for _, unit := range units {
+		if d%unit.size == 0 {
+			return strconv.FormatInt(int64(d/unit.size), 10) + unit.suffix, nil
+		}
+	}
+	return "", nil
+}
+
+// UnixSeconds converts t to the unix seconds taken as the from and to
+// arguments of GetMetricValues and GetMetricSeries. The zero time converts
+// to 0, which leaves the bound out.
+func UnixSeconds(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	return float64(t.Unix()) + float64(t.Nanosecond())/1e9
+}
+
+// QueryMetrics runs query and returns the first series of values, like
+// GetMetricValues.
+func (bucket *Bucket) QueryMetrics(ctx context.Context, query MetricQuery) (
+	MetricList, error) {
+	series, err := bucket.QueryMetricSeries(ctx, query)
+	if err != nil || len(series) == 0 {
+		return MetricList{}, err
+	}
+	return series[0], nil
+}
+
+// QueryMetricSeries runs query and returns every series of values, like
+// GetMetricSeries. The query is validated first; if it refers to columns
+// and none were declared, they are retrieved with MetricColumns, and
+// ErrUnknownColumns is returned when the metric has no values yet.
+func (bucket *Bucket) QueryMetricSeries(ctx context.Context, query MetricQuery) (
+	[]MetricList, error) {
+	query, err := prepareMetricQuery(ctx, bucket, query)
+	if err != nil {
+		return nil, err
+	}
+	return sendMetricQuery(ctx, bucket, query, query.offset, query.limit)
+}
+
+// ErrUnknownColumns is returned when the columns of a query can't be checked
+// because its metric has no values to read them from.
+var ErrUnknownColumns = errors.New("metric has no values to read its columns from")
+
+// prepareMetricQuery retrieves the columns query refers to, if needed, and
+// validates it.
+func prepareMetricQuery(ctx context.Context, api MetricsAPI, query MetricQuery) (
+	MetricQuery, error) {
+	if query.columns == nil && query.name != "" && len(query.referenced()) > 0 {
+		columns, err := metricColumns(ctx, api, query.name)
+		if err != nil {
+			return query, err
+		}
+		if len(columns) == 0 {
+			return query, ErrUnknownColumns
+		}
+		query.columns = columns
+	}
+	return query, query.Validate()
+}
+
+func sendMetricQuery(ctx context.Context, api MetricsAPI, query MetricQuery,
+	offset, limit int) ([]MetricList, error) {
+	var interval, filter string
+	if query.interval != 0 {
+		interval, _ = formatInterval(query.interval)
+	}
+	if query.filter != nil {
+		filter = query.filter.String()
+	}
+	return api.GetMetricSeriesCtx(ctx, query.name, string(query.aggregator),
+		query.column, interval, UnixSeconds(query.from), UnixSeconds(query.to),
+		filter, offset, limit)
+}
+
+// MetricColumns returns the columns of metricName, read from its latest
+// value. It returns nil when the metric has no values.
+func (bucket *Bucket) MetricColumns(ctx context.Context, metricName string) (
+	[]string, error) {
+	return metricColumns(ctx, bucket, metricName)
+}
+
+func metricColumns(ctx context.Context, api MetricsAPI, metricName string) (
+	[]string, error) {
+	metrics, err := api.GetMetricValuesCtx(ctx, metricName, "", "", "", 0, 0,
+		"", 0, 1)
+	if err != nil {
+		return nil, err
+	}
+	return metrics.Columns, nil
+}
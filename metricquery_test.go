@@ -0,0 +1,157 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestFilterString(t *testing.T) {
+	filter := And(Col("a").Gt(1), Or(Col("b").Lt(2.5), Col("c").Eq(3)), nil,
+		Col("d").Ne(-1))
+	expected := "a > 1 and (b < 2.5 or c = 3) and d != -1"
+	if filter.String() != expected {
+		t.Errorf("expected %q, got %q", expected, filter.String())
+	}
+	if s := Or(And(Col("a").Ge(1))).String(); s != "a >= 1" {
+		t.Error("single filters should not be parenthesized:", s)
+	}
+}
+
+func TestFormatInterval(t *testing.T) {
+	for d, expected := range map[time.Duration]string{
+		30 * time.Second:    "30s",
+		90 * time.Second:    "90s",
+		2 * time.Minute:     "2m",
+		3 * time.Hour:       "3h",
+		48 * time.Hour:      "2d",
+		14 * 24 * time.Hour: "2w",
+	} {
+		if s, err := formatInterval(d); err != nil || s != expected {
+			t.Errorf("%v: expected %s, got %s, %v", d, expected, s, err)
+		}
+	}
+	for _, d := range []time.Duration{0, -time.Second, 1500 * time.Millisecond} {
+		if _, err := formatInterval(d); err == nil {
+			t.Errorf("%v: expected an error", d)
+		}
+	}
+}
+
+func TestMetricQueryValidate(t *testing.T) {
+	base := NewMetricQuery("cpu").Columns("user", "system")
+	now := time.Now()
+	for field, query := range map[string]MetricQuery{
+		"metric_name":         NewMetricQuery(""),
+		"aggregator_function": base.Aggregate("average", "user"),
+		"aggregator_column":   base.Aggregate("", "user"),
+		"group_interval":      base.GroupBy(time.Millisecond),
+		"to":                  base.Between(now, now.Add(-time.Second)),
+		"limit":               base.Limit(-1),
+		"idle":                base.Where(Or(Col("user").Gt(1), Col("idle").Lt(1))),
+		"load":                base.Aggregate(Max, "load"),
+	} {
+		var validationErr *ValidationError
+		if err := query.Validate(); !errors.As(err, &validationErr) ||
+			validationErr.Field != field {
+			t.Errorf("expected a validation error on %s, got %v", field, err)
+		}
+	}
+	if err := base.Aggregate(Mean, "user").Where(Col("system").Gt(0)).Validate(); err != nil {
+		t.Error("valid query failed:", err)
+	}
+	if err := NewMetricQuery("cpu").Where(Col("idle").Gt(0)).Validate(); err != nil {
+		t.Error("columns should not be checked when not declared:", err)
+	}
+}
+
+func TestQueryMetrics(t *testing.T) {
+	var requests []url.Values
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.URL.Query())
+			fmt.Fprint(w, `[{"name": "cpu", "columns": ["time", "user", "system"], "points": [[1, 2, 3]]}]`)
+		}))
+	defer server.Close()
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+	bucket := zeus.Bucket("org1/bucket1")
+	ctx := context.Background()
+
+	from := time.Unix(1430355860, 0)
+	query := NewMetricQuery("cpu").
+		Aggregate(Max, "user").
+		GroupBy(time.Minute).
+		Between(from, from.Add(10*time.Second)).
+		Where(And(Col("user").Gt(10), Col("system").Le(5))).
+		Offset(20).
+		Limit(10)
+	metrics, err := bucket.QueryMetrics(ctx, query)
+	if err != nil {
+		t.Fatal("failed to query:", err)
+	}
+	if metrics.Name != "cpu" || len(metrics.Metrics) != 1 {
+		t.Error("wrong metrics:", metrics)
+	}
+	if len(requests) != 2 || requests[0].Get("limit") != "1" {
+		t.Fatal("expected the columns to be retrieved first, got", requests)
+	}
+	expected := url.Values{
+		"metric_name":         {"cpu"},
+		"aggregator_function": {"max"},
+		"aggregator_column":   {"user"},
+		"group_interval":      {"1m"},
+		"from":                {"1430355860.000"},
+		"to":                  {"1430355870.000"},
+		"filter_condition":    {"user > 10 and system <= 5"},
+		"offset":              {"20"},
+		"limit":               {"10"},
+	}
+	if requests[1].Encode() != expected.Encode() {
+		t.Errorf("expected %v, got %v", expected, requests[1])
+	}
+
+	requests = nil
+	_, err = bucket.QueryMetrics(ctx, query.Where(Col("idle").Gt(0)))
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Field != "idle" {
+		t.Error("expected a validation error on idle, got", err)
+	}
+	if len(requests) != 1 {
+		t.Error("an invalid query should not be sent")
+	}
+
+	requests = nil
+	if _, err := bucket.QueryMetrics(ctx, query.Columns("user", "system")); err != nil ||
+		len(requests) != 1 {
+		t.Error("declared columns should not be retrieved:", err, requests)
+	}
+
+	empty := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `[]`)
+		}))
+	defer empty.Close()
+	zeus.ApiServ = empty.URL
+	if _, err := bucket.QueryMetrics(ctx, query); err != ErrUnknownColumns {
+		t.Error("expected unknown columns for a metric without values, got", err)
+	}
+}
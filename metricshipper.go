@@ -0,0 +1,356 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MetricShipperConfig configures a MetricShipper. Zero fields take their
+// value from DefaultMetricShipperConfig.
+type MetricShipperConfig struct {
+	// FlushInterval is the window in which points of a series are merged
+	// into one MetricList.
+	FlushInterval time.Duration
+	// MaxPoints is the number of points which triggers sending a MetricList
+	// before the end of the window.
+	MaxPoints int
+	// MaxInFlight is the number of PostMetrics requests sent concurrently.
+	MaxInFlight int
+	// MaxPending is the number of points waiting to be sent at which Send
+	// starts blocking.
+	MaxPending int
+	// OnError, if set, is called with every MetricList which failed to be
+	// sent.
+	OnError func(metrics MetricList, err error)
+	// Spool, if set, stores MetricLists which failed because Zeus couldn't
+	// be reached, to be replayed later.
+	Spool *Spool
+}
+
+// DefaultMetricShipperConfig holds the defaults of MetricShipperConfig.
+var DefaultMetricShipperConfig = MetricShipperConfig{
+	FlushInterval: time.Second,
+	MaxPoints:     1000,
+	MaxInFlight:   4,
+	MaxPending:    100000,
+}
+
+// MetricShipperStats counts the points handled by a MetricShipper.
+type MetricShipperStats struct {
+	// Sent is the number of points Zeus accepted.
+	Sent int64
+	// Failed is the number of points which could not be sent or which Zeus
+	// rejected.
+	Failed int64
+	// Spooled is the number of points written to the spool.
+	Spooled int64
+}
+
+// MetricShipper merges metric points sent to the same series and posts
+// them to a bucket in the background, one MetricList per metric name and
+// column set per flush window. A MetricShipper is safe for concurrent use.
+type MetricShipper struct {
+	api    MetricsAPI
+	config MetricShipperConfig
+
+	mu      sync.Mutex
+	closed  bool
+	pending map[string]*metricBatch
+
+	// dispatching counts the dispatches started before the shipper was
+	// closed, which Close waits for before closing batches.
+	dispatching sync.WaitGroup
+	batches     chan *metricBatch
+	slots       chan struct{}
+	stop        chan struct{}
+	workers     sync.WaitGroup
+
+	closeOnce sync.Once
+	closeErr  error
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	inflightMu sync.Mutex
+	inflight   map[*metricBatch]struct{}
+
+	sent, failed, spooled int64
+}
+
+type metricBatch struct {
+	metrics MetricList
+	// index maps a column to its position in metrics.Columns.
+	index map[string]int
+	done  chan struct{}
+}
+
+// ErrShipperClosed is returned when sending to a closed shipper.
+var ErrShipperClosed = errors.New("shipper is closed")
+
+// NewMetricShipper starts a MetricShipper sending metrics with api.
+func NewMetricShipper(api MetricsAPI, config MetricShipperConfig) *MetricShipper {
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = DefaultMetricShipperConfig.FlushInterval
+	}
+	if config.MaxPoints <= 0 {
+		config.MaxPoints = DefaultMetricShipperConfig.MaxPoints
+	}
+	if config.MaxInFlight <= 0 {
+		config.MaxInFlight = DefaultMetricShipperConfig.MaxInFlight
+	}
+	if config.MaxPending <= 0 {
+		config.MaxPending = DefaultMetricShipperConfig.MaxPending
+	}
+
+	shipper := &MetricShipper{
+		api:      api,
+		config:   config,
+		pending:  make(map[string]*metricBatch),
+		batches:  make(chan *metricBatch),
+		slots:    make(chan struct{}, config.MaxPending),
+		stop:     make(chan struct{}),
+		inflight: make(map[*metricBatch]struct{}),
+	}
+	shipper.ctx, shipper.cancel = context.WithCancel(context.Background())
+	for i := 0; i < config.MaxInFlight; i++ {
+		shipper.workers.Add(1)
+		go shipper.work()
+	}
+	go shipper.tick()
+	return shipper
+}
+
+// Send adds a point to the series metricName with the given columns. Points
+// whose columns are the same set in another order are merged into the same
+// MetricList. Columns must be distinct, or a *ValidationError is returned.
+// Send blocks while MaxPending points wait to be sent, until ctx is done.
+func (shipper *MetricShipper) Send(ctx context.Context, metricName string,
+	columns []string, metric Metric) error {
+	if len(metricName) == 0 || len(columns) == 0 {
+		return errors.New("metricName and columns are required")
+	}
+	if len(metric.Point) != len(columns) ||
+		(metric.Missing != nil && len(metric.Missing) != len(columns)) {
+		return errors.New("field missing")
+	}
+	sorted := append([]string(nil), columns...)
+	sort.Strings(sorted)
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i] == sorted[i-1] {
+			return &ValidationError{Field: sorted[i], Reason: "duplicate column"}
+		}
+	}
+
+	select {
+	case shipper.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	key := metricName + "\x00" + strings.Join(sorted, "\x00")
+
+	shipper.mu.Lock()
+	if shipper.closed {
+		shipper.mu.Unlock()
+		<-shipper.slots
+		return ErrShipperClosed
+	}
+	batch, ok := shipper.pending[key]
+	if !ok {
+		batch = &metricBatch{
+			metrics: MetricList{
+				Name:    metricName,
+				Columns: append([]string(nil), columns...),
+			},
+			index: make(map[string]int, len(columns)),
+		}
+		for idx, col := range columns {
+			batch.index[col] = idx
+		}
+		shipper.pending[key] = batch
+	}
+	merged := Metric{Timestamp: metric.Timestamp, Point: make([]float64, len(columns))}
+	for idx, col := range columns {
+		merged.Point[batch.index[col]] = metric.Point[idx]
+	}
+	for idx, col := range columns {
+		if metric.IsMissing(idx) {
+			merged.SetMissing(batch.index[col])
+		}
+	}
+	batch.metrics.Metrics = append(batch.metrics.Metrics, merged)
+	full := len(batch.metrics.Metrics) >= shipper.config.MaxPoints
+	if full {
+		delete(shipper.pending, key)
+		shipper.dispatching.Add(1)
+	}
+	shipper.mu.Unlock()
+
+	if full {
+		shipper.dispatch(batch)
+		shipper.dispatching.Done()
+	}
+	return nil
+}
+
+// Flush sends every point given to Send before the call and waits until
+// they are sent, or until ctx is done.
+func (shipper *MetricShipper) Flush(ctx context.Context) error {
+	dispatched := make(chan struct{})
+	go func() {
+		shipper.dispatchAll(false)
+		close(dispatched)
+	}()
+	select {
+	case <-dispatched:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	shipper.inflightMu.Lock()
+	pending := make([]chan struct{}, 0, len(shipper.inflight))
+	for batch := range shipper.inflight {
+		pending = append(pending, batch.done)
+	}
+	shipper.inflightMu.Unlock()
+
+	for _, done := range pending {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Close stops accepting points, sends the pending ones and waits for them.
+// If ctx is done first, requests in flight are aborted and ctx's error is
+// returned. Calling Close again returns the result of the first call.
+func (shipper *MetricShipper) Close(ctx context.Context) error {
+	shipper.closeOnce.Do(func() {
+		shipper.closeErr = shipper.close(ctx)
+	})
+	return shipper.closeErr
+}
+
+func (shipper *MetricShipper) close(ctx context.Context) error {
+	shipper.mu.Lock()
+	shipper.closed = true
+	shipper.mu.Unlock()
+	close(shipper.stop)
+
+	done := make(chan struct{})
+	go func() {
+		shipper.dispatchAll(true)
+		shipper.dispatching.Wait()
+		close(shipper.batches)
+		shipper.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		shipper.cancel()
+		return nil
+	case <-ctx.Done():
+		shipper.cancel()
+		return ctx.Err()
+	}
+}
+
+// Stats returns the number of points sent and failed so far.
+func (shipper *MetricShipper) Stats() MetricShipperStats {
+	return MetricShipperStats{
+		Sent:    atomic.LoadInt64(&shipper.sent),
+		Failed:  atomic.LoadInt64(&shipper.failed),
+		Spooled: atomic.LoadInt64(&shipper.spooled),
+	}
+}
+
+func (shipper *MetricShipper) tick() {
+	ticker := time.NewTicker(shipper.config.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			shipper.dispatchAll(false)
+		case <-shipper.stop:
+			return
+		}
+	}
+}
+
+// dispatchAll ends the current window and sends its MetricLists. Once the
+// shipper is closed, only the final call from Close does anything.
+func (shipper *MetricShipper) dispatchAll(final bool) {
+	shipper.mu.Lock()
+	if shipper.closed && !final {
+		shipper.mu.Unlock()
+		return
+	}
+	pending := shipper.pending
+	shipper.pending = make(map[string]*metricBatch)
+	shipper.dispatching.Add(1)
+	shipper.mu.Unlock()
+
+	for _, batch := range pending {
+		shipper.dispatch(batch)
+	}
+	shipper.dispatching.Done()
+}
+
+func (shipper *MetricShipper) dispatch(batch *metricBatch) {
+	batch.done = make(chan struct{})
+	shipper.inflightMu.Lock()
+	shipper.inflight[batch] = struct{}{}
+	shipper.inflightMu.Unlock()
+
+	shipper.batches <- batch
+}
+
+func (shipper *MetricShipper) work() {
+	defer shipper.workers.Done()
+	for batch := range shipper.batches {
+		count := len(batch.metrics.Metrics)
+		successful, err := shipper.api.PostMetricsCtx(shipper.ctx, batch.metrics)
+		if err != nil && shipper.config.Spool != nil && IsTransient(err) &&
+			shipper.config.Spool.StoreMetrics(batch.metrics) == nil {
+			atomic.AddInt64(&shipper.spooled, int64(count))
+		} else if err != nil {
+			atomic.AddInt64(&shipper.failed, int64(count))
+			if shipper.config.OnError != nil {
+				shipper.config.OnError(batch.metrics, err)
+			}
+		} else {
+			atomic.AddInt64(&shipper.sent, int64(successful))
+			atomic.AddInt64(&shipper.failed, int64(count-successful))
+		}
+
+		shipper.inflightMu.Lock()
+		delete(shipper.inflight, batch)
+		shipper.inflightMu.Unlock()
+		close(batch.done)
+		for i := 0; i < count; i++ {
+			<-shipper.slots
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// metricSink is a server storing the metric points posted to it.
+type metricSink struct {
+	sync.Mutex
+	posts            []map[string]interface{}
+	active, maxAlive int
+	delay            time.Duration
+}
+
+func newMetricSink(delay time.Duration) (*httptest.Server, *metricSink) {
+	sink := &metricSink{delay: delay}
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			sink.Lock()
+			sink.active++
+			if sink.active > sink.maxAlive {
+				sink.maxAlive = sink.active
+			}
+			sink.Unlock()
+			time.Sleep(sink.delay)
+
+			reqBody, _ := ioutil.ReadAll(r.Body)
+			param, _ := url.ParseQuery(string(reqBody))
+			var points []map[string]interface{}
+			json.Unmarshal([]byte(param.Get("metrics")), &points)
+			sink.Lock()
+			sink.active--
+			sink.posts = append(sink.posts, map[string]interface{}{
+				"path": r.URL.Path, "points": points})
+			sink.Unlock()
+			fmt.Fprintf(w, `{"successful": %d}`, len(points))
+		}))
+	return server, sink
+}
+
+func TestMetricShipperMerge(t *testing.T) {
+	server, sink := newMetricSink(0)
+	defer server.Close()
+
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+	shipper := NewMetricShipper(zeus.Bucket("org1/bucket1"), MetricShipperConfig{
+		FlushInterval: time.Hour,
+	})
+	ctx := context.Background()
+	shipper.Send(ctx, "cpu", []string{"user", "system"}, Metric{Point: []float64{1, 2}})
+	shipper.Send(ctx, "cpu", []string{"system", "user"},
+		Metric{Point: []float64{4, 3}, Missing: []bool{true, false}})
+	shipper.Send(ctx, "cpu", []string{"user", "system", "idle"},
+		Metric{Point: []float64{5, 6, 7}})
+	shipper.Send(ctx, "mem", []string{"used"}, Metric{Point: []float64{8}})
+	if err := shipper.Send(ctx, "mem", []string{"used"}, Metric{}); err == nil {
+		t.Error("should fail on missing field")
+	}
+
+	if err := shipper.Flush(ctx); err != nil {
+		t.Fatal("failed to flush:", err)
+	}
+	if len(sink.posts) != 3 {
+		t.Fatalf("sent %d MetricLists, expected 3: %v", len(sink.posts), sink.posts)
+	}
+	for _, post := range sink.posts {
+		points := post["points"].([]map[string]interface{})
+		if len(points) == 2 {
+			for i, p := range points {
+				point := p["point"].(map[string]interface{})
+				if point["user"] != float64(2*i+1) {
+					t.Error("columns were not reordered:", point)
+				}
+				if system, ok := point["system"]; (i == 0 && system != 2.0) || (i == 1 && ok) {
+					t.Error("missing value was not reordered:", point)
+				}
+			}
+		} else if len(points) != 1 {
+			t.Error("wrong points:", post)
+		}
+	}
+	shipper.Close(ctx)
+	if stats := shipper.Stats(); stats.Sent != 4 || stats.Failed != 0 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+	if err := shipper.Send(ctx, "cpu", []string{"user"}, Metric{Point: []float64{1}}); err != ErrShipperClosed {
+		t.Error("should fail after close, got", err)
+	}
+}
+
+func TestMetricShipperDuplicateColumns(t *testing.T) {
+	zeus := &Zeus{ApiServ: "http://127.0.0.1:0", Token: "goZeus"}
+	shipper := NewMetricShipper(zeus.Bucket("org1/bucket1"), MetricShipperConfig{})
+	defer shipper.Close(context.Background())
+	var validationErr *ValidationError
+	err := shipper.Send(context.Background(), "cpu", []string{"user", "system", "user"},
+		Metric{Point: []float64{1, 2, 3}})
+	if !errors.As(err, &validationErr) || validationErr.Field != "user" {
+		t.Error("expected a validation error on user, got", err)
+	}
+}
+
+func TestMetricShipperInFlight(t *testing.T) {
+	server, sink := newMetricSink(20 * time.Millisecond)
+	defer server.Close()
+
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+	shipper := NewMetricShipper(zeus.Bucket("org1/bucket1"), MetricShipperConfig{
+		FlushInterval: time.Hour,
+		MaxPoints:     1,
+		MaxInFlight:   2,
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			shipper.Send(context.Background(), "cpu", []string{"value"},
+				Metric{Point: []float64{float64(i)}})
+		}(i)
+	}
+	wg.Wait()
+	if err := shipper.Close(context.Background()); err != nil {
+		t.Fatal("failed to close:", err)
+	}
+	if err := shipper.Close(context.Background()); err != nil {
+		t.Error("failed to close twice:", err)
+	}
+	if len(sink.posts) != 10 {
+		t.Errorf("sent %d MetricLists, expected 10", len(sink.posts))
+	}
+	if sink.maxAlive > 2 {
+		t.Errorf("%d requests were in flight, expected at most 2", sink.maxAlive)
+	}
+}
+
+func TestMetricShipperBackpressure(t *testing.T) {
+	server, release := stall()
+	defer server.Close()
+
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+	var failed int64
+	shipper := NewMetricShipper(zeus.Bucket("org1/bucket1"), MetricShipperConfig{
+		FlushInterval: 10 * time.Millisecond,
+		MaxPending:    2,
+		OnError: func(metrics MetricList, err error) {
+			atomic.AddInt64(&failed, int64(len(metrics.Metrics)))
+		},
+	})
+	columns := []string{"value"}
+	for i := 0; i < 2; i++ {
+		if err := shipper.Send(context.Background(), "cpu", columns,
+			Metric{Point: []float64{1}}); err != nil {
+			t.Fatal("failed to send:", err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := shipper.Send(ctx, "cpu", columns, Metric{Point: []float64{1}}); err != context.DeadlineExceeded {
+		t.Error("send should block while 2 points are pending, got", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := shipper.Close(ctx); err != context.DeadlineExceeded {
+		t.Error("close should time out, got", err)
+	}
+	if err := shipper.Close(context.Background()); err != context.DeadlineExceeded {
+		t.Error("a second close should return the first result, got", err)
+	}
+	close(release)
+	// Close aborted the request, so the points failed.
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt64(&failed) != 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if stats := shipper.Stats(); stats.Failed != 2 || atomic.LoadInt64(&failed) != 2 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+}
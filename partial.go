@@ -0,0 +1,166 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"context"
+	"errors"
+)
+
+// PostResult is the outcome of posting logs or metrics.
+type PostResult struct {
+	// Successful and Failed count the items Zeus accepted and rejected.
+	Successful, Failed int
+	// Error is the error text of the last response reporting failures.
+	Error string
+	// FailedIndices are the positions of the rejected items in the posted
+	// list, or nil when they are unknown. Zeus only reports counts, so they
+	// are only known when every item of a request failed.
+	FailedIndices []int
+	// Attempts is the number of requests made, including partial retries.
+	Attempts int
+}
+
+// PartialFailurePolicy controls what happens to the items Zeus rejects.
+// Zeus only reports how many items of a request failed, not which ones, so
+// the policy only applies when every item of a request failed. When Zeus
+// accepts some items and rejects others, the rejected ones can't be told
+// apart: they are only counted in the PostResult.
+type PartialFailurePolicy struct {
+	// Retries is the number of times the rejected items are sent again.
+	Retries int
+	// DeadLetter, if set, is called with the items still rejected after
+	// the retries, when they are known. Exactly one of logs and metrics is
+	// set.
+	DeadLetter func(logs *LogList, metrics *MetricList, result PostResult)
+}
+
+// WithPartialFailures sets how PostLogs and PostMetrics handle items which
+// Zeus rejects.
+func WithPartialFailures(policy PartialFailurePolicy) Option {
+	return func(zeus *Zeus) error {
+		if policy.Retries < 0 {
+			return errors.New("invalid partial failure policy")
+		}
+		zeus.partial = &policy
+		return nil
+	}
+}
+
+// result converts the response to a post of count items.
+func (resp postResponse) result(count int) PostResult {
+	result := PostResult{
+		Successful: resp.Successful,
+		Failed:     resp.Failed,
+		Error:      resp.Error,
+		Attempts:   1,
+	}
+	if resp.Failed > 0 && resp.Successful == 0 && resp.Failed == count {
+		result.FailedIndices = make([]int, count)
+		for i := range result.FailedIndices {
+			result.FailedIndices[i] = i
+		}
+	}
+	return result
+}
+
+// PostLogsResult sends a list of logs like PostLogs and reports how many
+// were accepted and rejected. Rejected logs are handled according to the
+// client's PartialFailurePolicy.
+func (bucket *Bucket) PostLogsResult(ctx context.Context, logs LogList) (
+	PostResult, error) {
+	result, failed, err := retryFailed(logs.Logs, bucket.zeus.partial,
+		func(items []Log) (PostResult, error) {
+			return bucket.postLogs(ctx, LogList{Name: logs.Name, Logs: items})
+		})
+	if err == nil && failed != nil && bucket.zeus.partial.DeadLetter != nil {
+		bucket.zeus.partial.DeadLetter(&LogList{Name: logs.Name, Logs: failed},
+			nil, result)
+	}
+	return result, err
+}
+
+// PostMetricsResult sends a list of points like PostMetrics and reports how
+// many were accepted and rejected. Rejected points are handled according to
+// the client's PartialFailurePolicy.
+func (bucket *Bucket) PostMetricsResult(ctx context.Context,
+	metrics MetricList) (PostResult, error) {
+	result, failed, err := retryFailed(metrics.Metrics, bucket.zeus.partial,
+		func(items []Metric) (PostResult, error) {
+			return bucket.postMetrics(ctx, MetricList{Name: metrics.Name,
+				Columns: metrics.Columns, Metrics: items})
+		})
+	if err == nil && failed != nil && bucket.zeus.partial.DeadLetter != nil {
+		bucket.zeus.partial.DeadLetter(nil, &MetricList{Name: metrics.Name,
+			Columns: metrics.Columns, Metrics: failed}, result)
+	}
+	return result, err
+}
+
+// retryFailed posts items with send, then resends the rejected subset as
+// allowed by policy. It returns the merged result, with FailedIndices
+// relative to items, and the items left rejected when policy is set and
+// they are known.
+func retryFailed[T any](items []T, policy *PartialFailurePolicy,
+	send func(items []T) (PostResult, error)) (PostResult, []T, error) {
+	result, err := send(items)
+	if err != nil || result.Failed == 0 || policy == nil {
+		return result, nil, err
+	}
+
+	// positions maps the items of the last attempt to items.
+	positions := make([]int, len(items))
+	for i := range positions {
+		positions[i] = i
+	}
+	pending := items
+	last := result
+	for attempt := 0; attempt < policy.Retries && last.FailedIndices != nil; attempt++ {
+		subset := make([]T, len(last.FailedIndices))
+		subsetPositions := make([]int, len(last.FailedIndices))
+		for i, idx := range last.FailedIndices {
+			subset[i] = pending[idx]
+			subsetPositions[i] = positions[idx]
+		}
+		pending, positions = subset, subsetPositions
+
+		last, err = send(pending)
+		result.Attempts++
+		if err != nil {
+			return result, nil, err
+		}
+		result.Successful += last.Successful
+		result.Failed = last.Failed
+		result.Error = last.Error
+		if last.Failed == 0 {
+			result.FailedIndices = nil
+			return result, nil, nil
+		}
+	}
+
+	if last.FailedIndices == nil {
+		// Unknown which items failed, and the others must not be sent
+		// again nor dead-lettered.
+		result.FailedIndices = nil
+		return result, nil, nil
+	}
+	failed := make([]T, len(last.FailedIndices))
+	result.FailedIndices = make([]int, len(last.FailedIndices))
+	for i, idx := range last.FailedIndices {
+		failed[i] = pending[idx]
+		result.FailedIndices[i] = positions[idx]
+	}
+	return result, failed, nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// scripted returns a server answering the given bodies in turn, repeating
+// the last one.
+func scripted(bodies ...string) (*httptest.Server, *int32) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			n := int(atomic.AddInt32(&count, 1))
+			if n > len(bodies) {
+				n = len(bodies)
+			}
+			fmt.Fprintln(w, bodies[n-1])
+		}))
+	return server, &count
+}
+
+func twoLogs() LogList {
+	return LogList{Name: "syslog", Logs: []Log{Log{"seq": 0}, Log{"seq": 1}}}
+}
+
+func TestPostLogsResult(t *testing.T) {
+	server, _ := scripted(`{"successful": 1, "failed": 1, "error": "bad log"}`)
+	defer server.Close()
+
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+	bucket := zeus.Bucket("org1/bucket1")
+	result, err := bucket.PostLogsResult(context.Background(), twoLogs())
+	if err != nil {
+		t.Fatal("failed to post logs:", err)
+	}
+	if result.Successful != 1 || result.Failed != 1 || result.Error != "bad log" ||
+		result.FailedIndices != nil || result.Attempts != 1 {
+		t.Errorf("wrong result: %+v", result)
+	}
+	if successful, err := bucket.PostLogs(twoLogs()); successful != 1 || err != nil {
+		t.Error("PostLogs should still report the successful logs:", successful, err)
+	}
+}
+
+func TestPartialFailureRetry(t *testing.T) {
+	server, count := scripted(`{"successful": 0, "failed": 2, "error": "busy"}`,
+		`{"successful": 2}`)
+	defer server.Close()
+
+	deadLetters := 0
+	zeus, _ := NewClient(server.URL, "goZeus", WithPartialFailures(PartialFailurePolicy{
+		Retries: 2,
+		DeadLetter: func(logs *LogList, metrics *MetricList, result PostResult) {
+			deadLetters++
+		},
+	}))
+	result, err := zeus.Bucket("org1/bucket1").PostLogsResult(context.Background(),
+		twoLogs())
+	if err != nil {
+		t.Fatal("failed to post logs:", err)
+	}
+	if result.Successful != 2 || result.Failed != 0 || result.Attempts != 2 ||
+		result.FailedIndices != nil {
+		t.Errorf("wrong result: %+v", result)
+	}
+	if *count != 2 || deadLetters != 0 {
+		t.Errorf("%d requests and %d dead letters, expected 2 and 0", *count,
+			deadLetters)
+	}
+}
+
+func TestPartialFailureDeadLetter(t *testing.T) {
+	server, count := scripted(`{"successful": 0, "failed": 2, "error": "bad metric"}`)
+	defer server.Close()
+
+	var dead *MetricList
+	zeus, _ := NewClient(server.URL, "goZeus", WithPartialFailures(PartialFailurePolicy{
+		Retries: 1,
+		DeadLetter: func(logs *LogList, metrics *MetricList, result PostResult) {
+			dead = metrics
+		},
+	}))
+	metrics := MetricList{Name: "cpu", Columns: []string{"value"},
+		Metrics: []Metric{Metric{Point: []float64{1}}, Metric{Point: []float64{2}}}}
+	result, err := zeus.Bucket("org1/bucket1").PostMetricsResult(context.Background(),
+		metrics)
+	if err != nil {
+		t.Fatal("failed to post metrics:", err)
+	}
+	if result.Successful != 0 || result.Failed != 2 || result.Attempts != 2 ||
+		fmt.Sprint(result.FailedIndices) != "[0 1]" || result.Error != "bad metric" {
+		t.Errorf("wrong result: %+v", result)
+	}
+	if *count != 2 || dead == nil || len(dead.Metrics) != 2 || dead.Name != "cpu" {
+		t.Error("failed points were not dead-lettered:", dead)
+	}
+}
+
+func TestPartialFailureUnknown(t *testing.T) {
+	server, count := scripted(`{"successful": 1, "failed": 1}`)
+	defer server.Close()
+
+	var dead *LogList
+	var deadResult PostResult
+	zeus, _ := NewClient(server.URL, "goZeus", WithPartialFailures(PartialFailurePolicy{
+		Retries: 3,
+		DeadLetter: func(logs *LogList, metrics *MetricList, result PostResult) {
+			dead, deadResult = logs, result
+		},
+	}))
+	zeus.Bucket("org1/bucket1").PostLogsResult(context.Background(), twoLogs())
+	if *count != 1 {
+		t.Errorf("logs were sent %d times, unknown failures must not be retried",
+			*count)
+	}
+	if dead != nil {
+		t.Error("accepted logs should not be dead-lettered:", dead, deadResult)
+	}
+}
+
+func TestRetryFailedPositions(t *testing.T) {
+	items := []string{"a", "b", "c", "d"}
+	responses := []PostResult{
+		{Successful: 1, Failed: 3, FailedIndices: []int{1, 2, 3}},
+		{Successful: 1, Failed: 2, FailedIndices: []int{0, 2}},
+	}
+	var sent [][]string
+	result, failed, err := retryFailed(items, &PartialFailurePolicy{Retries: 1},
+		func(items []string) (PostResult, error) {
+			sent = append(sent, items)
+			return responses[len(sent)-1], nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(sent) != "[[a b c d] [b c d]]" {
+		t.Error("wrong subsets sent:", sent)
+	}
+	if result.Successful != 2 || result.Failed != 2 ||
+		fmt.Sprint(result.FailedIndices) != "[1 3]" || fmt.Sprint(failed) != "[b d]" {
+		t.Errorf("wrong result: %+v, failed %v", result, failed)
+	}
+}
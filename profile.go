@@ -0,0 +1,312 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Profile holds where and as whom a client connects.
+type Profile struct {
+	Name string
+	// Server is the URL of the Zeus rest api.
+	Server string
+	// Token is the API token. When it is empty, the token is read from the
+	// environment variable TokenEnv, or else from TokenFile.
+	Token     string
+	TokenEnv  string
+	TokenFile string
+	// Bucket is the default "organization/bucket", see WithBucket.
+	Bucket string
+	// Timeout, UserAgent and RetryAttempts, when set, configure the client
+	// with WithTimeout, WithUserAgent and WithRetry.
+	Timeout       time.Duration
+	UserAgent     string
+	RetryAttempts int
+}
+
+// Config is a set of named profiles, usually loaded with LoadConfig from a
+// file such as:
+//
+//	default_profile: prod
+//	profiles:
+//	  prod:
+//	    server: https://api.ciscozeus.io
+//	    token_file: ~/.config/zeus/prod.token
+//	    bucket: org1/bucket1
+//	    timeout: 30s
+//	    retry_attempts: 5
+//	  dev:
+//	    server: http://localhost:8080
+//	    token_env: ZEUS_DEV_TOKEN
+//
+// Unknown keys are an error.
+type Config struct {
+	DefaultProfile string
+	Profiles       map[string]Profile
+}
+
+// DefaultServer is the Zeus rest api used by profiles without a server.
+const DefaultServer = "https://api.ciscozeus.io"
+
+// Environment variables read by LoadConfig and Config.Profile.
+const (
+	EnvConfig  = "ZEUS_CONFIG"
+	EnvProfile = "ZEUS_PROFILE"
+	EnvServer  = "ZEUS_SERVER"
+	EnvToken   = "ZEUS_TOKEN"
+	EnvBucket  = "ZEUS_BUCKET"
+)
+
+// DefaultConfigPath returns the file named by ZEUS_CONFIG, or else
+// zeus/config.yaml in the user's configuration directory, such as
+// ~/.config/zeus/config.yaml.
+func DefaultConfigPath() string {
+	if path := os.Getenv(EnvConfig); path != "" {
+		return path
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "zeus", "config.yaml")
+}
+
+// LoadConfig reads the config file at path, or DefaultConfigPath if path is
+// empty. A missing default file gives an empty Config, so that profiles can
+// come from the environment alone; a missing file named explicitly is an
+// error.
+func LoadConfig(path string) (*Config, error) {
+	explicit := path != "" || os.Getenv(EnvConfig) != ""
+	if path == "" {
+		path = DefaultConfigPath()
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !explicit && errors.Is(err, os.ErrNotExist) {
+			return &Config{Profiles: map[string]Profile{}}, nil
+		}
+		return nil, err
+	}
+	config, err := ParseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return config, nil
+}
+
+// ParseConfig parses the content of a config file. See Config.
+func ParseConfig(data []byte) (*Config, error) {
+	var file struct {
+		DefaultProfile string                 `yaml:"default_profile"`
+		Profiles       map[string]profileFile `yaml:"profiles"`
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	config := &Config{
+		DefaultProfile: file.DefaultProfile,
+		Profiles:       make(map[string]Profile, len(file.Profiles)),
+	}
+	for name, fields := range file.Profiles {
+		if name == "" {
+			return nil, errors.New("profile without a name")
+		}
+		profile, err := fields.profile(name)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %v", name, err)
+		}
+		config.Profiles[name] = profile
+	}
+	return config, nil
+}
+
+// profileFile is a profile as written in a config file.
+type profileFile struct {
+	Server        string `yaml:"server"`
+	Token         string `yaml:"token"`
+	TokenEnv      string `yaml:"token_env"`
+	TokenFile     string `yaml:"token_file"`
+	Bucket        string `yaml:"bucket"`
+	Timeout       string `yaml:"timeout"`
+	UserAgent     string `yaml:"user_agent"`
+	RetryAttempts int    `yaml:"retry_attempts"`
+}
+
+func (fields profileFile) profile(name string) (Profile, error) {
+	profile := Profile{
+		Name:          name,
+		Server:        fields.Server,
+		Token:         fields.Token,
+		TokenEnv:      fields.TokenEnv,
+		TokenFile:     fields.TokenFile,
+		Bucket:        fields.Bucket,
+		UserAgent:     fields.UserAgent,
+		RetryAttempts: fields.RetryAttempts,
+	}
+	if fields.Timeout != "" {
+		timeout, err := time.ParseDuration(fields.Timeout)
+		if err != nil {
+			return Profile{}, fmt.Errorf("timeout: %v", err)
+		}
+		profile.Timeout = timeout
+	}
+	if fields.RetryAttempts < 0 {
+		return Profile{}, errors.New("retry_attempts: expected a non-negative integer")
+	}
+	return profile, nil
+}
+
+// Names returns the names of the profiles, sorted.
+func (config *Config) Names() []string {
+	names := make([]string, 0, len(config.Profiles))
+	for name := range config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Profile returns the profile called name, or if name is empty, the one
+// named by ZEUS_PROFILE, default_profile or "default". ZEUS_SERVER,
+// ZEUS_TOKEN and ZEUS_BUCKET override its fields. Naming a profile which
+// doesn't exist is an error, but a missing "default" profile is empty, so
+// that the environment alone can configure a client.
+func (config *Config) Profile(name string) (Profile, error) {
+	if name == "" {
+		name = os.Getenv(EnvProfile)
+	}
+	if name == "" {
+		name = config.DefaultProfile
+	}
+	if name == "" {
+		name = "default"
+	}
+	profile, ok := config.Profiles[name]
+	if !ok {
+		if name != "default" {
+			return Profile{}, fmt.Errorf("no profile %q", name)
+		}
+		profile.Name = name
+	}
+	if server := os.Getenv(EnvServer); server != "" {
+		profile.Server = server
+	}
+	if token := os.Getenv(EnvToken); token != "" {
+		profile.Token = token
+	}
+	if bucket := os.Getenv(EnvBucket); bucket != "" {
+		profile.Bucket = bucket
+	}
+	return profile, nil
+}
+
+// ResolveToken returns Token, or else the value of the environment
+// variable TokenEnv, or else the content of TokenFile, in which a leading
+// "~/" stands for the home directory.
+func (profile Profile) ResolveToken() (string, error) {
+	if profile.Token != "" {
+		return profile.Token, nil
+	}
+	if profile.TokenEnv != "" {
+		if token := os.Getenv(profile.TokenEnv); token != "" {
+			return token, nil
+		}
+		if profile.TokenFile == "" {
+			return "", fmt.Errorf("profile %s: %s is not set", profile.Name,
+				profile.TokenEnv)
+		}
+	}
+	if profile.TokenFile != "" {
+		path := profile.TokenFile
+		if strings.HasPrefix(path, "~/") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", err
+			}
+			path = filepath.Join(home, path[2:])
+		}
+		token, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("profile %s: %v", profile.Name, err)
+		}
+		return strings.TrimSpace(string(token)), nil
+	}
+	return "", fmt.Errorf("profile %s has no token", profile.Name)
+}
+
+// Options returns the client options set by the profile.
+func (profile Profile) Options() []Option {
+	var opts []Option
+	if profile.Bucket != "" {
+		opts = append(opts, WithBucket(profile.Bucket))
+	}
+	if profile.Timeout > 0 {
+		opts = append(opts, WithTimeout(profile.Timeout))
+	}
+	if profile.UserAgent != "" {
+		opts = append(opts, WithUserAgent(profile.UserAgent))
+	}
+	if profile.RetryAttempts > 0 {
+		opts = append(opts, WithRetry(RetryPolicy{MaxAttempts: profile.RetryAttempts}))
+	}
+	return opts
+}
+
+// NewClient returns a client for the profile, connecting to DefaultServer
+// if it has no server. opts are applied after the options of the profile.
+func (profile Profile) NewClient(opts ...Option) (*Zeus, error) {
+	token, err := profile.ResolveToken()
+	if err != nil {
+		return nil, err
+	}
+	server := profile.Server
+	if server == "" {
+		server = DefaultServer
+	}
+	return NewClient(server, token, append(profile.Options(), opts...)...)
+}
+
+// NewClientFromProfile loads the default config file and returns a client
+// for the profile called name, as selected by Config.Profile.
+func NewClientFromProfile(name string, opts ...Option) (*Zeus, error) {
+	config, err := LoadConfig("")
+	if err != nil {
+		return nil, err
+	}
+	profile, err := config.Profile(name)
+	if err != nil {
+		return nil, err
+	}
+	return profile.NewClient(opts...)
+}
@@ -0,0 +1,207 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testConfig = `
+# Zeus profiles
+default_profile: prod
+profiles:
+  prod:
+    server: https://zeus.example.com # production
+    token_file: "%s"
+    bucket: org1/bucket1
+    timeout: 30s
+    user_agent: 'svc#1'
+    retry_attempts: 5
+  dev env:
+    server: http://localhost:8080
+    token_env: ZEUS_TEST_DEV_TOKEN
+`
+
+// clearProfileEnv unsets the environment variables read by profiles.
+func clearProfileEnv(t *testing.T) {
+	for _, key := range []string{EnvConfig, EnvProfile, EnvServer, EnvToken,
+		EnvBucket, "ZEUS_TEST_DEV_TOKEN"} {
+		t.Setenv(key, "")
+	}
+}
+
+func writeTestConfig(t *testing.T) (dir, path string) {
+	dir = t.TempDir()
+	tokenPath := filepath.Join(dir, "token")
+	os.WriteFile(tokenPath, []byte("file-token\n"), 0600)
+	path = filepath.Join(dir, "config.yaml")
+	config := strings.Replace(testConfig, "%s", tokenPath, 1)
+	os.WriteFile(path, []byte(config), 0600)
+	return dir, path
+}
+
+func TestParseConfig(t *testing.T) {
+	_, path := writeTestConfig(t)
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal("failed to load config:", err)
+	}
+	if config.DefaultProfile != "prod" {
+		t.Error("unexpected default profile", config.DefaultProfile)
+	}
+	if names := config.Names(); !reflect.DeepEqual(names, []string{"dev env", "prod"}) {
+		t.Error("unexpected profiles", names)
+	}
+	prod := config.Profiles["prod"]
+	expected := Profile{
+		Name:          "prod",
+		Server:        "https://zeus.example.com",
+		TokenFile:     prod.TokenFile,
+		Bucket:        "org1/bucket1",
+		Timeout:       30 * time.Second,
+		UserAgent:     "svc#1",
+		RetryAttempts: 5,
+	}
+	if prod != expected || prod.TokenFile == "" {
+		t.Errorf("expected %+v, got %+v", expected, prod)
+	}
+
+	for _, invalid := range []string{
+		"server: x",
+		"profiles:\n  a:\n    unknown: 1",
+		"profiles:\n  a:\n    timeout: soon",
+		"profiles:\n  a:\n    retry_attempts: \"3\"",
+		"profiles:\n  a:\n    retry_attempts: -1",
+		"profiles:\n  a:\n    server: [x]",
+		"profiles:\n  a:\n    server: \"x",
+		"profiles:\n  a: {}\n  a: {}",
+		"profiles:\n  \"\": {}",
+		"other: {}",
+	} {
+		if _, err := ParseConfig([]byte(invalid)); err == nil {
+			t.Errorf("%q: should fail", invalid)
+		}
+	}
+	_, err = ParseConfig([]byte("\nprofiles:\n  a:\n    bogus: 1"))
+	if err == nil || !strings.Contains(err.Error(), "line 4") {
+		t.Error("errors should give the line number:", err)
+	}
+	if config, err := ParseConfig(nil); err != nil || len(config.Profiles) != 0 {
+		t.Error("an empty file should have no profiles:", config, err)
+	}
+}
+
+func TestConfigProfile(t *testing.T) {
+	clearProfileEnv(t)
+	_, path := writeTestConfig(t)
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal("failed to load config:", err)
+	}
+
+	profile, err := config.Profile("")
+	if err != nil || profile.Name != "prod" {
+		t.Fatal("default_profile should be used:", profile, err)
+	}
+	if token, err := profile.ResolveToken(); err != nil || token != "file-token" {
+		t.Error("failed to read the token file:", token, err)
+	}
+
+	t.Setenv(EnvProfile, "dev env")
+	profile, err = config.Profile("")
+	if err != nil || profile.Name != "dev env" {
+		t.Fatal("ZEUS_PROFILE should be used:", profile, err)
+	}
+	if _, err := profile.ResolveToken(); err == nil {
+		t.Error("should fail when the token variable is not set")
+	}
+	t.Setenv("ZEUS_TEST_DEV_TOKEN", "env-token")
+	if token, err := profile.ResolveToken(); err != nil || token != "env-token" {
+		t.Error("failed to read the token variable:", token, err)
+	}
+
+	t.Setenv(EnvServer, "http://override")
+	t.Setenv(EnvToken, "override-token")
+	t.Setenv(EnvBucket, "org2/bucket2")
+	profile, err = config.Profile("prod")
+	if err != nil {
+		t.Fatal("failed to get profile:", err)
+	}
+	if profile.Server != "http://override" || profile.Token != "override-token" ||
+		profile.Bucket != "org2/bucket2" {
+		t.Error("environment should override the profile:", profile)
+	}
+
+	if _, err := config.Profile("missing"); err == nil {
+		t.Error("should fail on a missing profile")
+	}
+	t.Setenv(EnvProfile, "")
+	empty := &Config{}
+	if profile, err := empty.Profile(""); err != nil || profile.Token != "override-token" {
+		t.Error("the environment alone should configure the default profile:",
+			profile, err)
+	}
+}
+
+func TestLoadConfigDefault(t *testing.T) {
+	clearProfileEnv(t)
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	if path := DefaultConfigPath(); path != filepath.Join(dir, "zeus", "config.yaml") {
+		t.Error("unexpected default path", path)
+	}
+	config, err := LoadConfig("")
+	if err != nil || len(config.Profiles) != 0 {
+		t.Error("a missing default config file should be empty:", config, err)
+	}
+	t.Setenv(EnvConfig, filepath.Join(dir, "missing.yaml"))
+	if _, err := LoadConfig(""); err == nil {
+		t.Error("should fail on a missing file named by ZEUS_CONFIG")
+	}
+}
+
+func TestProfileNewClient(t *testing.T) {
+	profile := Profile{
+		Name:          "test",
+		Token:         "goZeus",
+		Bucket:        "org1/bucket1",
+		Timeout:       time.Second,
+		UserAgent:     "svc/1.0",
+		RetryAttempts: 2,
+	}
+	zeus, err := profile.NewClient(WithUserAgent("override/1.0"))
+	if err != nil {
+		t.Fatal("failed to create client:", err)
+	}
+	if zeus.ApiServ != DefaultServer {
+		t.Error("should connect to the default server:", zeus.ApiServ)
+	}
+	if zeus.defaultBucket != "org1/bucket1" || zeus.client.Timeout != time.Second ||
+		zeus.retry == nil || zeus.retry.MaxAttempts != 2 {
+		t.Error("profile options were not applied")
+	}
+	if zeus.userAgent != "override/1.0" {
+		t.Error("options should apply after the profile:", zeus.userAgent)
+	}
+
+	if _, err := (Profile{Name: "empty"}).NewClient(); err == nil {
+		t.Error("should fail without a token")
+	}
+}
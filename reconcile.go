@@ -0,0 +1,343 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// AlertAction is what a plan does to an alert.
+type AlertAction string
+
+// Alert actions.
+const (
+	AlertCreate AlertAction = "create"
+	AlertUpdate AlertAction = "update"
+	AlertDelete AlertAction = "delete"
+)
+
+// AlertChange is a change of an AlertPlan.
+type AlertChange struct {
+	Action AlertAction `json:"action"`
+	Name   string      `json:"name"`
+	// ID is the id of the alert updated or deleted.
+	ID int64 `json:"id,omitempty"`
+	// Fields are the fields an update changes, named as by Zeus.
+	Fields []string `json:"fields,omitempty"`
+	// Desired is the alert created or updated, and Current the alert
+	// updated or deleted, as it is in Zeus.
+	Desired *AlertV2 `json:"desired,omitempty"`
+	Current *AlertV2 `json:"current,omitempty"`
+}
+
+// AlertPlan is the changes turning the alerts of a bucket into the desired
+// ones, ordered by alert name.
+type AlertPlan struct {
+	Changes []AlertChange
+}
+
+// String describes the plan one change per line, such as
+// "+ create cpu-high", "~ update disk-full (7): alert_expression, emails" or
+// "- delete old-alert (3)".
+func (plan AlertPlan) String() string {
+	var text strings.Builder
+	for _, change := range plan.Changes {
+		switch change.Action {
+		case AlertCreate:
+			fmt.Fprintf(&text, "+ create %s\n", change.Name)
+		case AlertUpdate:
+			fmt.Fprintf(&text, "~ update %s (%d): %s\n", change.Name, change.ID,
+				strings.Join(change.Fields, ", "))
+		case AlertDelete:
+			fmt.Fprintf(&text, "- delete %s (%d)\n", change.Name, change.ID)
+		}
+	}
+	return text.String()
+}
+
+// ReconcileConfig sets how Reconcile applies its plan.
+type ReconcileConfig struct {
+	// DryRun only computes the plan.
+	DryRun bool
+	// Prune deletes the alerts which aren't desired. Without it, they are
+	// left alone.
+	Prune bool
+}
+
+// errNotApplied reports a change Zeus replied to without applying it.
+var errNotApplied = errors.New("zeus did not apply the change")
+
+// Reconcile makes the alerts of api match desired, keyed by name: it
+// retrieves them with GetAlerts, plans the changes with PlanAlerts and
+// applies them in order, unless config.DryRun is set. It returns the plan.
+// If a change fails, or Zeus replies without applying it, the error names
+// it and the plan returned only holds the changes before it, which were
+// applied.
+func Reconcile(ctx context.Context, api AlertsAPI, desired []AlertV2,
+	config ReconcileConfig) (AlertPlan, error) {
+	_, current, err := api.GetAlertsCtx(ctx)
+	if err != nil {
+		return AlertPlan{}, err
+	}
+	plan, err := PlanAlerts(desired, current, config.Prune)
+	if err != nil || config.DryRun {
+		return plan, err
+	}
+	for i, change := range plan.Changes {
+		var successful int
+		switch change.Action {
+		case AlertCreate:
+			successful, err = api.PostAlertCtx(ctx, change.Desired.Alert())
+		case AlertUpdate:
+			successful, err = api.PutAlertCtx(ctx, change.ID, change.Desired.Alert())
+		case AlertDelete:
+			successful, err = api.DeleteAlertCtx(ctx, change.ID)
+		}
+		if err == nil && successful == 0 {
+			err = errNotApplied
+		}
+		if err != nil {
+			plan.Changes = plan.Changes[:i]
+			return plan, fmt.Errorf("%s alert %s: %w", change.Action,
+				change.Name, err)
+		}
+	}
+	return plan, nil
+}
+
+// PlanAlerts returns the changes turning current into desired, matching
+// alerts by name. The desired alerts are validated first, and their names
+// must be unique. Fields left empty in a desired alert are not compared,
+// since Zeus can't clear them; expressions are compared in canonical form
+// when they parse, and emails in any order. Among current alerts sharing a
+// name, the one of lowest id is matched. Alerts which aren't matched are
+// deleted if prune is set.
+func PlanAlerts(desired []AlertV2, current []Alert, prune bool) (
+	AlertPlan, error) {
+	wanted := make(map[string]bool, len(desired))
+	for i, alert := range desired {
+		if err := alert.Validate(); err != nil {
+			if alert.Name == "" {
+				return AlertPlan{}, fmt.Errorf("alert %d: %w", i+1, err)
+			}
+			return AlertPlan{}, fmt.Errorf("alert %s: %w", alert.Name, err)
+		}
+		if wanted[alert.Name] {
+			return AlertPlan{}, &ValidationError{Field: "alert_name",
+				Reason: fmt.Sprintf("%q is desired twice", alert.Name)}
+		}
+		wanted[alert.Name] = true
+	}
+
+	existing := make([]AlertV2, 0, len(current))
+	for _, alert := range current {
+		// Only the fields compared matter.
+		alert.Created, alert.Last_updated = "", ""
+		parsed, err := ParseAlert(alert)
+		if err != nil {
+			return AlertPlan{}, fmt.Errorf("alert %d: %w", alert.Id, err)
+		}
+		existing = append(existing, parsed)
+	}
+	sort.SliceStable(existing, func(i, j int) bool {
+		return existing[i].ID < existing[j].ID
+	})
+	byName := make(map[string]*AlertV2, len(existing))
+	var plan AlertPlan
+	for i := range existing {
+		alert := &existing[i]
+		if byName[alert.Name] == nil && wanted[alert.Name] {
+			byName[alert.Name] = alert
+		} else if prune {
+			plan.Changes = append(plan.Changes, AlertChange{Action: AlertDelete,
+				Name: alert.Name, ID: alert.ID, Current: alert})
+		}
+	}
+
+	for _, alert := range desired {
+		match := byName[alert.Name]
+		if match == nil {
+			plan.Changes = append(plan.Changes, AlertChange{Action: AlertCreate,
+				Name: alert.Name, Desired: &alert})
+		} else if fields := alertDiff(alert, *match); len(fields) > 0 {
+			plan.Changes = append(plan.Changes, AlertChange{Action: AlertUpdate,
+				Name: alert.Name, ID: match.ID, Fields: fields, Desired: &alert,
+				Current: match})
+		}
+	}
+	sort.SliceStable(plan.Changes, func(i, j int) bool {
+		if plan.Changes[i].Name != plan.Changes[j].Name {
+			return plan.Changes[i].Name < plan.Changes[j].Name
+		}
+		return plan.Changes[i].ID < plan.Changes[j].ID
+	})
+	return plan, nil
+}
+
+// alertDiff returns the fields set in desired which differ in current.
+func alertDiff(desired, current AlertV2) []string {
+	var fields []string
+	for _, field := range []struct {
+		name             string
+		desired, current string
+	}{
+		{"username", desired.Username, current.Username},
+		{"alerts_type", string(desired.Type), string(current.Type)},
+		{"alert_expression", canonicalExpression(desired.Expression),
+			canonicalExpression(current.Expression)},
+		{"alert_severity", string(desired.Severity), string(current.Severity)},
+		{"metric_name", desired.MetricName, current.MetricName},
+		{"emails", sortedEmails(desired.Emails), sortedEmails(current.Emails)},
+		{"status", string(desired.Status), string(current.Status)},
+	} {
+		if field.desired != "" && field.desired != field.current {
+			fields = append(fields, field.name)
+		}
+	}
+	if desired.Frequency != 0 && desired.Frequency != current.Frequency {
+		fields = append(fields, "frequency")
+	}
+	return fields
+}
+
+func canonicalExpression(expr string) string {
+	if parsed, err := ParseAlertExpression(expr); err == nil {
+		return parsed.String()
+	}
+	return expr
+}
+
+func sortedEmails(emails []string) string {
+	sorted := append([]string(nil), emails...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// LoadAlerts reads desired alerts from JSON or YAML files, for Reconcile,
+// with ParseAlerts. A directory stands for the .json, .yaml and .yml files
+// in it, in name order.
+func LoadAlerts(paths ...string) ([]AlertV2, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		var matches []string
+		for _, pattern := range []string{"*.json", "*.yaml", "*.yml"} {
+			found, err := filepath.Glob(filepath.Join(path, pattern))
+			if err != nil {
+				return nil, err
+			}
+			matches = append(matches, found...)
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+
+	var alerts []AlertV2
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := ParseAlerts(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		alerts = append(alerts, parsed...)
+	}
+	return alerts, nil
+}
+
+// ParseAlerts decodes desired alerts from JSON holding an alert or an array
+// of alerts, encoded as by AlertV2.MarshalJSON:
+//
+//	[{"alert_name": "cpu-high", "alerts_type": "metric",
+//	  "alert_expression": "cpu.value > 20", "metric_name": "cpu.value",
+//	  "emails": ["ops@example.com"], "frequency": "1m"}]
+//
+// or from YAML holding the same fields, as a mapping or a sequence of
+// mappings:
+//
+//	alert_name: cpu-high
+//	alerts_type: metric
+//	alert_expression: cpu.value > 20
+//	emails: [ops@example.com]
+//	frequency: 1m
+//
+// Unknown fields are errors, so that misspelled ones aren't ignored, no
+// alerts is an error, and the alerts are validated.
+func ParseAlerts(data []byte) ([]AlertV2, error) {
+	js := bytes.TrimSpace(data)
+	if !json.Valid(js) {
+		var err error
+		if js, err = yamlToJSON(js); err != nil {
+			return nil, err
+		}
+	}
+	if len(js) == 0 || bytes.Equal(js, []byte("null")) {
+		return nil, errors.New("no alerts defined")
+	}
+	if js[0] != '[' {
+		js = append(append([]byte("["), js...), ']')
+	}
+	decoder := json.NewDecoder(bytes.NewReader(js))
+	decoder.DisallowUnknownFields()
+	var decoded []alertJSON
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, err
+	}
+	if len(decoded) == 0 {
+		return nil, errors.New("no alerts defined")
+	}
+	alerts := make([]AlertV2, len(decoded))
+	for i, alert := range decoded {
+		converted, err := alert.alertV2()
+		if err == nil {
+			err = converted.Validate()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("alert %d: %w", i+1, err)
+		}
+		alerts[i] = converted
+	}
+	return alerts, nil
+}
+
+// yamlToJSON converts a YAML document to JSON. An empty document converts
+// to null.
+func yamlToJSON(data []byte) ([]byte, error) {
+	var value interface{}
+	if err := yaml.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
@@ -0,0 +1,274 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeAlerts keeps alerts in memory, recording the changes made to them.
+type fakeAlerts struct {
+	alerts  []Alert
+	changes []string
+	fail    error
+	// ignorePost makes PostAlert reply without creating the alert.
+	ignorePost bool
+}
+
+func (api *fakeAlerts) PostAlert(alert Alert) (int, error) {
+	return api.PostAlertCtx(context.Background(), alert)
+}
+
+func (api *fakeAlerts) PostAlertCtx(ctx context.Context, alert Alert) (int,
+	error) {
+	if api.fail != nil {
+		return 0, api.fail
+	}
+	if api.ignorePost {
+		return 0, nil
+	}
+	api.changes = append(api.changes, "post "+alert.Alert_name)
+	alert.Id = int64(100 + len(api.changes))
+	api.alerts = append(api.alerts, alert)
+	return 1, nil
+}
+
+func (api *fakeAlerts) GetAlerts() (int, []Alert, error) {
+	return api.GetAlertsCtx(context.Background())
+}
+
+func (api *fakeAlerts) GetAlertsCtx(ctx context.Context) (int, []Alert,
+	error) {
+	return len(api.alerts), append([]Alert(nil), api.alerts...), nil
+}
+
+func (api *fakeAlerts) GetAlert(id int64) (Alert, error) {
+	return api.GetAlertCtx(context.Background(), id)
+}
+
+func (api *fakeAlerts) GetAlertCtx(ctx context.Context, id int64) (Alert,
+	error) {
+	for _, alert := range api.alerts {
+		if alert.Id == id {
+			return alert, nil
+		}
+	}
+	return Alert{}, &APIError{StatusCode: 404}
+}
+
+func (api *fakeAlerts) PutAlert(id int64, alert Alert) (int, error) {
+	return api.PutAlertCtx(context.Background(), id, alert)
+}
+
+func (api *fakeAlerts) PutAlertCtx(ctx context.Context, id int64,
+	alert Alert) (int, error) {
+	api.changes = append(api.changes, "put "+alert.Alert_name)
+	return 1, nil
+}
+
+func (api *fakeAlerts) DeleteAlert(id int64) (int, error) {
+	return api.DeleteAlertCtx(context.Background(), id)
+}
+
+func (api *fakeAlerts) DeleteAlertCtx(ctx context.Context, id int64) (int,
+	error) {
+	api.changes = append(api.changes, "delete "+api.alerts[id-1].Alert_name)
+	return 1, nil
+}
+
+func currentAlerts() []Alert {
+	return []Alert{
+		{Id: 1, Alert_name: "cpu-high", Alert_expression: "cpu.value>20",
+			Alert_severity: "S3", Emails: "b@example.com,a@example.com",
+			Frequency: 60, Created: "2015-04-30 01:04:29"},
+		{Id: 2, Alert_name: "old", Alert_expression: "old.value > 1"},
+		{Id: 3, Alert_name: "cpu-high", Alert_expression: "cpu.value > 20"},
+		{Id: 4, Alert_name: "disk", Alert_expression: "disk.free < 1",
+			Status: "active", Created: "invalid"},
+	}
+}
+
+func desiredAlerts() []AlertV2 {
+	return []AlertV2{
+		{Name: "new", Expression: "new.value > 1"},
+		{Name: "disk", Expression: "disk.free < 1"},
+		{Name: "cpu-high", Expression: "cpu.value > 20", Severity: SeverityS2,
+			Emails:    []string{"a@example.com", "b@example.com"},
+			Frequency: time.Minute},
+	}
+}
+
+func TestPlanAlerts(t *testing.T) {
+	plan, err := PlanAlerts(desiredAlerts(), currentAlerts(), false)
+	if err != nil {
+		t.Fatal("failed to plan:", err)
+	}
+	expected := "~ update cpu-high (1): alert_severity\n+ create new\n"
+	if plan.String() != expected {
+		t.Errorf("expected %q, got %q", expected, plan)
+	}
+	update := plan.Changes[0]
+	if update.Current.Severity != SeverityS3 ||
+		update.Desired.Severity != SeverityS2 {
+		t.Error("wrong update:", update)
+	}
+
+	plan, err = PlanAlerts(desiredAlerts(), currentAlerts(), true)
+	if err != nil {
+		t.Fatal("failed to plan:", err)
+	}
+	expected = "~ update cpu-high (1): alert_severity\n" +
+		"- delete cpu-high (3)\n+ create new\n- delete old (2)\n"
+	if plan.String() != expected {
+		t.Errorf("expected %q, got %q", expected, plan)
+	}
+
+	desired := append(desiredAlerts(), AlertV2{Name: "disk", Expression: "e"})
+	var validationErr *ValidationError
+	if _, err := PlanAlerts(desired, nil, false); !errors.As(err,
+		&validationErr) || validationErr.Field != "alert_name" {
+		t.Error("expected duplicate names to fail, got", err)
+	}
+	desired = append(desiredAlerts(), AlertV2{Name: "bad", Expression: "e",
+		Frequency: -time.Second})
+	if _, err := PlanAlerts(desired, nil, false); !errors.As(err,
+		&validationErr) || validationErr.Field != "frequency" ||
+		!strings.HasPrefix(err.Error(), "alert bad: ") {
+		t.Error("expected an invalid alert to fail, got", err)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+	api := &fakeAlerts{alerts: currentAlerts()}
+	config := ReconcileConfig{DryRun: true, Prune: true}
+	plan, err := Reconcile(ctx, api, desiredAlerts(), config)
+	if err != nil || len(plan.Changes) != 4 || len(api.changes) != 0 {
+		t.Fatalf("a dry run should change nothing: %v, %v", plan, err)
+	}
+
+	config.DryRun = false
+	if _, err := Reconcile(ctx, api, desiredAlerts(), config); err != nil {
+		t.Fatal("failed to reconcile:", err)
+	}
+	expected := []string{"put cpu-high", "delete cpu-high", "post new",
+		"delete old"}
+	if !reflect.DeepEqual(api.changes, expected) {
+		t.Errorf("expected %v, got %v", expected, api.changes)
+	}
+
+	api = &fakeAlerts{fail: &APIError{StatusCode: 400}}
+	_, err = Reconcile(ctx, api, desiredAlerts(), config)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) ||
+		!strings.HasPrefix(err.Error(), "create alert cpu-high: ") {
+		t.Error("expected the failed change to be named, got", err)
+	}
+
+	// Only the changes made before the failure are returned.
+	api = &fakeAlerts{alerts: currentAlerts(), fail: &APIError{StatusCode: 400}}
+	plan, err = Reconcile(ctx, api, desiredAlerts(), config)
+	if !strings.HasPrefix(err.Error(), "create alert new: ") ||
+		len(plan.Changes) != 2 || len(api.changes) != 2 {
+		t.Errorf("expected 2 applied changes, got %v, %v", plan, err)
+	}
+
+	// A change Zeus didn't apply fails too.
+	api = &fakeAlerts{alerts: currentAlerts(), ignorePost: true}
+	plan, err = Reconcile(ctx, api, desiredAlerts(), config)
+	if err == nil || !strings.HasPrefix(err.Error(), "create alert new: ") ||
+		len(plan.Changes) != 2 {
+		t.Errorf("expected the unapplied create to fail, got %v, %v", plan, err)
+	}
+}
+
+func TestLoadAlerts(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	write("a.json", `[{"alert_name": "cpu-high", "alert_expression":
+		"cpu.value > 20", "alerts_type": "metric", "metric_name": "cpu.value",
+		"frequency": "1m"}, {"alert_name": "disk", "alert_expression": "e"}]`)
+	write("b.json", `{"alert_name": "mem", "alert_expression": "e",
+		"emails": ["ops@example.com"]}`)
+	write("c.yml", `# Disk alerts.
+- alert_name: disk-full
+  alert_expression: disk.used > 0.9
+  emails: [ops@example.com, dev@example.com]
+  frequency: 300
+`)
+	write("README.md", "not an alert")
+
+	alerts, err := LoadAlerts(dir)
+	if err != nil {
+		t.Fatal("failed to load:", err)
+	}
+	var names []string
+	for _, alert := range alerts {
+		names = append(names, alert.Name)
+	}
+	if !reflect.DeepEqual(names,
+		[]string{"cpu-high", "disk", "mem", "disk-full"}) ||
+		alerts[0].Frequency != time.Minute ||
+		alerts[2].Emails[0] != "ops@example.com" ||
+		alerts[3].Frequency != 5*time.Minute || len(alerts[3].Emails) != 2 {
+		t.Errorf("wrong alerts: %+v", alerts)
+	}
+
+	typo := write("typo.txt", `{"alert_name": "n", "alert_expresion": "e"}`)
+	if _, err := LoadAlerts(typo); err == nil ||
+		!strings.Contains(err.Error(), "alert_expresion") {
+		t.Error("expected an unknown field to fail, got", err)
+	}
+	invalid := write("invalid.txt", `[{"alert_name": "n",
+		"alert_expression": "e"}, {"alert_name": "n"}]`)
+	var validationErr *ValidationError
+	if _, err := LoadAlerts(invalid); !errors.As(err, &validationErr) ||
+		!strings.HasPrefix(err.Error(), invalid+": alert 2: ") {
+		t.Error("expected an invalid alert to fail, got", err)
+	}
+	if _, err := LoadAlerts(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("expected a missing file to fail")
+	}
+	for _, name := range []string{"empty.json", "empty.yaml"} {
+		empty := write(name, "\n")
+		if _, err := LoadAlerts(empty); err == nil ||
+			err.Error() != empty+": no alerts defined" {
+			t.Error("expected no alerts to fail, got", err)
+		}
+	}
+	typo = write("typo.yaml", "alert_name: n\nalert_expresion: e\n")
+	if _, err := LoadAlerts(typo); err == nil ||
+		!strings.Contains(err.Error(), "alert_expresion") {
+		t.Error("expected an unknown YAML field to fail, got", err)
+	}
+	bad := write("bad.yaml", "alert_name: a\nalert_name: b\n")
+	if _, err := LoadAlerts(bad); err == nil ||
+		!strings.HasPrefix(err.Error(), bad+": yaml: ") {
+		t.Error("expected invalid YAML to fail, got", err)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how a client retries requests which failed with a
+// transient error. GET, PUT and DELETE requests are retried; POST requests,
+// which send logs, metrics and alerts, are only retried when RetryPOST is
+// set since Zeus may have stored them already.
+//
+// Zero fields take their value from DefaultRetryPolicy, except Jitter,
+// RetryOn and RetryPOST.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts, including the first one.
+	MaxAttempts int
+	// MinBackoff is the delay before the first retry. It is multiplied by
+	// Multiplier, which is at least 1, for every following retry, up to
+	// MaxBackoff.
+	MinBackoff, MaxBackoff time.Duration
+	Multiplier             float64
+	// MaxRetryAfter is the longest wait asked for by a Retry-After header
+	// which is honored. When the server asks for a longer one, the request
+	// fails with its *APIError instead of blocking.
+	MaxRetryAfter time.Duration
+	// Jitter randomly shortens every delay by up to this fraction, e.g. 0.2
+	// waits between 80% and 100% of the backoff.
+	Jitter float64
+	// RetryableStatuses are the response statuses which are retried.
+	RetryableStatuses []int
+	// RetryOn decides whether an error which is not an *APIError, e.g. a
+	// failed connection, is retried. By default connection errors,
+	// connection resets and unexpected EOFs are retried.
+	RetryOn func(err error) bool
+	// RetryPOST enables retries of POST requests.
+	RetryPOST bool
+}
+
+// DefaultRetryPolicy holds the defaults of RetryPolicy.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	MinBackoff:  100 * time.Millisecond,
+	MaxBackoff:  5 * time.Second,
+	Multiplier:  2,
+	// MaxRetryAfter is longer than MaxBackoff, since a server asking to wait
+	// knows better than the backoff.
+	MaxRetryAfter: 30 * time.Second,
+	RetryableStatuses: []int{
+		http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	},
+}
+
+// WithRetry makes the client retry requests as described by policy. A
+// Retry-After header in the response takes precedence over the backoff, up
+// to MaxRetryAfter.
+func WithRetry(policy RetryPolicy) Option {
+	return func(zeus *Zeus) error {
+		if policy.MaxAttempts < 0 || policy.MinBackoff < 0 ||
+			policy.MaxBackoff < 0 || policy.Multiplier < 0 ||
+			(policy.Multiplier > 0 && policy.Multiplier < 1) ||
+			policy.Jitter < 0 || policy.Jitter > 1 || policy.MaxRetryAfter < 0 {
+			return errors.New("invalid retry policy")
+		}
+		if policy.MaxAttempts == 0 {
+			policy.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+		}
+		if policy.MinBackoff == 0 {
+			policy.MinBackoff = DefaultRetryPolicy.MinBackoff
+		}
+		if policy.MaxBackoff == 0 {
+			policy.MaxBackoff = DefaultRetryPolicy.MaxBackoff
+		}
+		if policy.Multiplier == 0 {
+			policy.Multiplier = DefaultRetryPolicy.Multiplier
+		}
+		if policy.MaxRetryAfter == 0 {
+			policy.MaxRetryAfter = DefaultRetryPolicy.MaxRetryAfter
+		}
+		if policy.RetryableStatuses == nil {
+			policy.RetryableStatuses = DefaultRetryPolicy.RetryableStatuses
+		}
+		if policy.RetryOn == nil {
+			policy.RetryOn = isConnError
+		}
+		zeus.retry = &policy
+		return nil
+	}
+}
+
+func (policy *RetryPolicy) shouldRetry(method string, attempt, status int,
+	retryAfter time.Duration, err error) bool {
+	if policy == nil || err == nil || attempt >= policy.MaxAttempts ||
+		retryAfter > policy.MaxRetryAfter {
+		return false
+	}
+	if method == "POST" && !policy.RetryPOST {
+		return false
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return policy.RetryOn(err)
+	}
+	for _, retryable := range policy.RetryableStatuses {
+		if status == retryable {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the delay before the given retry, attempt being the number
+// of attempts made so far.
+func (policy *RetryPolicy) backoff(attempt int) time.Duration {
+	delay := float64(policy.MinBackoff) *
+		math.Pow(policy.Multiplier, float64(attempt-1))
+	if delay > float64(policy.MaxBackoff) {
+		delay = float64(policy.MaxBackoff)
+	}
+	delay -= delay * policy.Jitter * rand.Float64()
+	return time.Duration(delay)
+}
+
+func (policy *RetryPolicy) wait(ctx context.Context, attempt int,
+	retryAfter time.Duration) error {
+	delay := policy.backoff(attempt)
+	if retryAfter > 0 {
+		delay = retryAfter
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func isConnError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as
+// an HTTP date. It returns 0 when the header is missing or invalid.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
@@ -0,0 +1,241 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flaky returns a server which fails the first failures requests by calling
+// broken, then answers retBody.
+func flaky(failures int32, broken func(w http.ResponseWriter), retBody string) (
+	*httptest.Server, *int32) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&count, 1) <= failures {
+				broken(w)
+				return
+			}
+			fmt.Fprintln(w, retBody)
+		}))
+	return server, &count
+}
+
+func unavailable(w http.ResponseWriter) {
+	w.WriteHeader(503)
+}
+
+func fastRetry(opts ...func(*RetryPolicy)) Option {
+	policy := RetryPolicy{
+		MaxAttempts: 4,
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  5 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(&policy)
+	}
+	return WithRetry(policy)
+}
+
+func TestRetryGet(t *testing.T) {
+	server, count := flaky(2, unavailable, `["cpu"]`)
+	defer server.Close()
+
+	zeus, _ := NewClient(server.URL, "goZeus", fastRetry())
+	names, err := zeus.Bucket("org1/bucket1").GetMetricNames("", 0, 0)
+	if err != nil || len(names) != 1 {
+		t.Error("failed to get metric names:", names, err)
+	}
+	if *count != 3 {
+		t.Errorf("server got %d requests, expected 3", *count)
+	}
+}
+
+func TestRetryGiveUp(t *testing.T) {
+	server, count := flaky(10, unavailable, `["cpu"]`)
+	defer server.Close()
+
+	zeus, _ := NewClient(server.URL, "goZeus", fastRetry())
+	_, err := zeus.Bucket("org1/bucket1").GetMetricNames("", 0, 0)
+	if !IsServerError(err) {
+		t.Error("expected the last 503, got", err)
+	}
+	if *count != 4 {
+		t.Errorf("server got %d requests, expected 4", *count)
+	}
+}
+
+func TestRetryNotRetryable(t *testing.T) {
+	server, count := flaky(1, func(w http.ResponseWriter) {
+		w.WriteHeader(400)
+	}, `["cpu"]`)
+	defer server.Close()
+
+	zeus, _ := NewClient(server.URL, "goZeus", fastRetry())
+	if _, err := zeus.Bucket("org1/bucket1").GetMetricNames("", 0, 0); !IsBadRequest(err) {
+		t.Error("expected bad request, got", err)
+	}
+	if *count != 1 {
+		t.Errorf("server got %d requests, expected 1", *count)
+	}
+}
+
+func TestRetryPost(t *testing.T) {
+	logs := LogList{Name: "syslog", Logs: []Log{Log{"foo": "bar"}}}
+
+	server, count := flaky(1, unavailable, `{"successful": 1}`)
+	zeus, _ := NewClient(server.URL, "goZeus", fastRetry())
+	if _, err := zeus.Bucket("org1/bucket1").PostLogs(logs); !IsServerError(err) {
+		t.Error("POST should not be retried by default, got", err)
+	}
+	if *count != 1 {
+		t.Errorf("server got %d requests, expected 1", *count)
+	}
+	server.Close()
+
+	server, count = flaky(1, unavailable, `{"successful": 1}`)
+	defer server.Close()
+	zeus, _ = NewClient(server.URL, "goZeus", fastRetry(func(policy *RetryPolicy) {
+		policy.RetryPOST = true
+	}))
+	successful, err := zeus.Bucket("org1/bucket1").PostLogs(logs)
+	if err != nil || successful != 1 {
+		t.Error("failed to post logs:", successful, err)
+	}
+	if *count != 2 {
+		t.Errorf("server got %d requests, expected 2", *count)
+	}
+}
+
+func TestRetryConnectionReset(t *testing.T) {
+	server, count := flaky(2, func(w http.ResponseWriter) {
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}, `{"successful": 1}`)
+	defer server.Close()
+
+	zeus, _ := NewClient(server.URL, "goZeus", fastRetry())
+	trigalert, err := zeus.Bucket("org1/bucket1").GetTrigalert()
+	if err != nil || trigalert["successful"] != float64(1) {
+		t.Error("failed to get trigalert:", trigalert, err)
+	}
+	if *count != 3 {
+		t.Errorf("server got %d requests, expected 3", *count)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	server, _ := flaky(1, func(w http.ResponseWriter) {
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(429)
+	}, `["cpu"]`)
+	defer server.Close()
+
+	zeus, _ := NewClient(server.URL, "goZeus", fastRetry())
+	start := time.Now()
+	if _, err := zeus.Bucket("org1/bucket1").GetMetricNames("", 0, 0); err != nil {
+		t.Error("failed to get metric names:", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Retry-After was not honored, retried after %v", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	server, _ = flaky(1, func(w http.ResponseWriter) {
+		w.Header().Set("Retry-After", "20")
+		w.WriteHeader(503)
+	}, `["cpu"]`)
+	defer server.Close()
+	zeus.ApiServ = server.URL
+	_, err := zeus.Bucket("org1/bucket1").GetMetricNamesCtx(ctx, "", 0, 0)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("waiting for a retry should stop with the context, got", err)
+	}
+}
+
+func TestRetryAfterTooLong(t *testing.T) {
+	server, count := flaky(1, func(w http.ResponseWriter) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(429)
+	}, `["cpu"]`)
+	defer server.Close()
+
+	zeus, _ := NewClient(server.URL, "goZeus", fastRetry(func(policy *RetryPolicy) {
+		policy.MaxRetryAfter = 10 * time.Second
+	}))
+	start := time.Now()
+	_, err := zeus.Bucket("org1/bucket1").GetMetricNames("", 0, 0)
+	if !IsRateLimited(err) {
+		t.Error("expected the 429 to be returned, got", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second || *count != 1 {
+		t.Errorf("should not wait for an hour: %d requests in %v", *count,
+			elapsed)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryPolicy{
+		MinBackoff: 100 * time.Millisecond,
+		MaxBackoff: time.Second,
+		Multiplier: 3,
+		Jitter:     0.5,
+	}
+	expected := []time.Duration{100, 300, 900, 1000, 1000}
+	for i, exp := range expected {
+		exp *= time.Millisecond
+		delay := policy.backoff(i + 1)
+		if delay > exp || delay < exp/2 {
+			t.Errorf("backoff(%d)=%v, expected between %v and %v", i+1, delay,
+				exp/2, exp)
+		}
+	}
+
+	for _, invalid := range []RetryPolicy{
+		{Jitter: 2},
+		{MinBackoff: -time.Second},
+		{MaxBackoff: -time.Second},
+		{Multiplier: 0.5},
+		{Multiplier: -2},
+	} {
+		if _, err := NewClient("", "", WithRetry(invalid)); err == nil {
+			t.Errorf("%+v: should fail", invalid)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if delay := parseRetryAfter("3"); delay != 3*time.Second {
+		t.Error("wrong delay for seconds:", delay)
+	}
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if delay := parseRetryAfter(date); delay < 58*time.Second || delay > time.Minute {
+		t.Error("wrong delay for date:", delay)
+	}
+	for _, value := range []string{"", "-1", "soon"} {
+		if delay := parseRetryAfter(value); delay != 0 {
+			t.Errorf("parseRetryAfter(%q)=%v, expected 0", value, delay)
+		}
+	}
+}
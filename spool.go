@@ -0,0 +1,594 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SpoolConfig configures a Spool. Zero fields take their value from
+// DefaultSpoolConfig, except Dir which is required.
+type SpoolConfig struct {
+	// Dir is the directory holding the segment files.
+	Dir string
+	// MaxBytes caps the size of the spool. The oldest segments are evicted
+	// when it is exceeded.
+	MaxBytes int64
+	// SegmentBytes is the size at which a new segment file is started.
+	SegmentBytes int64
+	// RetryInterval is the time between two replays in the background.
+	RetryInterval time.Duration
+	// OnReject, if set, is called with every spooled batch which failed
+	// permanently during replay, e.g. Zeus rejected it with a client error
+	// or the client refused it before sending. Such batches are discarded.
+	OnReject func(logs *LogList, metrics *MetricList, err error)
+}
+
+// DefaultSpoolConfig holds the defaults of SpoolConfig.
+var DefaultSpoolConfig = SpoolConfig{
+	MaxBytes:      64 << 20,
+	SegmentBytes:  4 << 20,
+	RetryInterval: 5 * time.Second,
+}
+
+// SpoolStats counts the batches handled by a Spool.
+type SpoolStats struct {
+	// Spooled is the number of batches written to disk.
+	Spooled int64
+	// Replayed is the number of spooled batches sent to Zeus.
+	Replayed int64
+	// Rejected is the number of spooled batches Zeus rejected.
+	Rejected int64
+	// Evicted is the number of batches lost when segments were evicted.
+	Evicted int64
+	// Corrupted is the number of segments cut short by a bad checksum.
+	Corrupted int64
+	// PendingBytes is the size of the segments waiting to be replayed.
+	PendingBytes int64
+}
+
+// Spool is a write-ahead log on disk for log and metric batches which could
+// not be sent because Zeus was unreachable. Spooled batches are replayed in
+// order, in the background and by Replay, and survive process restarts.
+// A batch may be sent twice if the process stops while sending it.
+//
+// A Spool is safe for concurrent use. Only one Spool may use a directory at
+// a time.
+type Spool struct {
+	api    DataAPI
+	config SpoolConfig
+
+	mu         sync.Mutex
+	segments   []int64 // sequence numbers, oldest first
+	sizes      map[int64]int64
+	records    map[int64]int // records not replayed yet, per segment
+	total      int64
+	active     *os.File
+	activeSeq  int64
+	cursor     spoolCursor
+	closed     bool
+	replayMu   sync.Mutex
+	stop, done chan struct{}
+
+	closeOnce sync.Once
+	closeErr  error
+
+	spooled, replayed, rejected, evicted, corrupted int64
+}
+
+// spoolCursor is the position of the next record to replay.
+type spoolCursor struct {
+	Seq    int64 `json:"seq"`
+	Offset int64 `json:"offset"`
+}
+
+// spoolRecord is a batch as stored on disk. LogList and MetricList don't
+// round-trip through their own JSON encoding, so they are spelled out.
+type spoolRecord struct {
+	Kind    string   `json:"kind"`
+	Name    string   `json:"name"`
+	Columns []string `json:"columns,omitempty"`
+	Logs    []Log    `json:"logs,omitempty"`
+	Metrics []Metric `json:"metrics,omitempty"`
+}
+
+const (
+	spoolHeaderSize = 8
+	spoolSuffix     = ".seg"
+	spoolCursorFile = "cursor"
+)
+
+// ErrSpoolClosed is returned when storing to a closed spool.
+var ErrSpoolClosed = errors.New("spool is closed")
+
+// errCorrupted reports a record with a bad checksum or a torn write.
+var errCorrupted = errors.New("corrupted spool record")
+
+// OpenSpool opens or creates the spool in config.Dir and starts replaying
+// its batches with api in the background.
+func OpenSpool(api DataAPI, config SpoolConfig) (*Spool, error) {
+	if config.Dir == "" {
+		return nil, errors.New("spool directory is required")
+	}
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = DefaultSpoolConfig.MaxBytes
+	}
+	if config.SegmentBytes <= 0 {
+		config.SegmentBytes = DefaultSpoolConfig.SegmentBytes
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = DefaultSpoolConfig.RetryInterval
+	}
+	if err := os.MkdirAll(config.Dir, 0700); err != nil {
+		return nil, err
+	}
+
+	spool := &Spool{
+		api:     api,
+		config:  config,
+		sizes:   make(map[int64]int64),
+		records: make(map[int64]int),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if err := spool.load(); err != nil {
+		return nil, err
+	}
+	// Never append to a segment of a previous run, its tail may be torn.
+	if err := spool.rotate(); err != nil {
+		return nil, err
+	}
+	go spool.run()
+	return spool, nil
+}
+
+// load reads the segments and the cursor left in the directory.
+func (spool *Spool) load() error {
+	js, err := ioutil.ReadFile(filepath.Join(spool.config.Dir, spoolCursorFile))
+	if err == nil {
+		if err := json.Unmarshal(js, &spool.cursor); err != nil {
+			spool.cursor = spoolCursor{}
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	files, err := ioutil.ReadDir(spool.config.Dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), spoolSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseInt(strings.TrimSuffix(file.Name(), spoolSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		if seq < spool.cursor.Seq {
+			// Replayed before the last run stopped.
+			os.Remove(spool.path(seq))
+			continue
+		}
+		spool.segments = append(spool.segments, seq)
+		spool.sizes[seq] = file.Size()
+		spool.total += file.Size()
+		if seq > spool.activeSeq {
+			spool.activeSeq = seq
+		}
+	}
+	sort.Slice(spool.segments, func(i, j int) bool {
+		return spool.segments[i] < spool.segments[j]
+	})
+	if len(spool.segments) > 0 && spool.cursor.Seq < spool.segments[0] {
+		spool.cursor = spoolCursor{Seq: spool.segments[0]}
+	}
+	for _, seq := range spool.segments {
+		records, err := countRecords(spool.path(seq))
+		if err != nil {
+			return err
+		}
+		if seq == spool.cursor.Seq {
+			replayed, err := countRecordsBefore(spool.path(seq), spool.cursor.Offset)
+			if err != nil {
+				return err
+			}
+			records -= replayed
+		}
+		spool.records[seq] = records
+	}
+	return nil
+}
+
+func (spool *Spool) path(seq int64) string {
+	return filepath.Join(spool.config.Dir, fmt.Sprintf("%020d%s", seq, spoolSuffix))
+}
+
+// rotate starts a new active segment. spool.mu must be held.
+func (spool *Spool) rotate() error {
+	if spool.active != nil {
+		if err := spool.active.Close(); err != nil {
+			return err
+		}
+		spool.active = nil
+	}
+	seq := spool.activeSeq + 1
+	file, err := os.OpenFile(spool.path(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	spool.active = file
+	spool.activeSeq = seq
+	spool.segments = append(spool.segments, seq)
+	spool.sizes[seq] = 0
+	spool.records[seq] = 0
+	if len(spool.segments) == 1 {
+		spool.cursor = spoolCursor{Seq: seq}
+	}
+	return nil
+}
+
+// PostLogs sends logs, or spools them if Zeus can't be reached or spooled
+// batches are still waiting, so that batches are sent in order. An error is
+// returned when Zeus rejects logs or they can't be spooled.
+func (spool *Spool) PostLogs(ctx context.Context, logs LogList) error {
+	if spool.Pending() == 0 {
+		_, err := spool.api.PostLogsCtx(ctx, logs)
+		if err == nil || !IsTransient(err) {
+			return err
+		}
+	}
+	return spool.StoreLogs(logs)
+}
+
+// PostMetrics sends metrics, or spools them like PostLogs.
+func (spool *Spool) PostMetrics(ctx context.Context, metrics MetricList) error {
+	if spool.Pending() == 0 {
+		_, err := spool.api.PostMetricsCtx(ctx, metrics)
+		if err == nil || !IsTransient(err) {
+			return err
+		}
+	}
+	return spool.StoreMetrics(metrics)
+}
+
+// StoreLogs writes logs to the spool to be replayed later.
+func (spool *Spool) StoreLogs(logs LogList) error {
+	if len(logs.Name) == 0 || len(logs.Logs) == 0 {
+		return errors.New("logs is empty")
+	}
+	return spool.store(spoolRecord{Kind: "logs", Name: logs.Name, Logs: logs.Logs})
+}
+
+// StoreMetrics writes metrics to the spool to be replayed later.
+func (spool *Spool) StoreMetrics(metrics MetricList) error {
+	if len(metrics.Name) == 0 ||
+		len(metrics.Columns) == 0 ||
+		len(metrics.Metrics) == 0 {
+		return errors.New("metrics is empty")
+	}
+	return spool.store(spoolRecord{Kind: "metrics", Name: metrics.Name,
+		Columns: metrics.Columns, Metrics: metrics.Metrics})
+}
+
+func (spool *Spool) store(record spoolRecord) error {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, spoolHeaderSize, spoolHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	buf = append(buf, payload...)
+
+	spool.mu.Lock()
+	defer spool.mu.Unlock()
+	if spool.closed {
+		return ErrSpoolClosed
+	}
+	if err := spool.write(buf); err != nil {
+		return err
+	}
+	spool.sizes[spool.activeSeq] += int64(len(buf))
+	spool.records[spool.activeSeq]++
+	spool.total += int64(len(buf))
+	atomic.AddInt64(&spool.spooled, 1)
+
+	if spool.sizes[spool.activeSeq] >= spool.config.SegmentBytes {
+		if err := spool.rotate(); err != nil {
+			return err
+		}
+	}
+	spool.evict()
+	return nil
+}
+
+// write appends a record to the active segment. If that fails, the part of
+// the record which was written is truncated, or else the records appended
+// after it would read as corrupted; if the truncation fails too, a new
+// segment is started. spool.mu must be held.
+func (spool *Spool) write(buf []byte) error {
+	_, err := spool.active.Write(buf)
+	if err == nil {
+		err = spool.active.Sync()
+	}
+	if err != nil {
+		if spool.active.Truncate(spool.sizes[spool.activeSeq]) != nil {
+			spool.active.Close()
+			spool.active = nil
+			spool.rotate()
+		}
+		return err
+	}
+	return nil
+}
+
+// evict removes the oldest segments while the spool is too big. The active
+// segment is never evicted. spool.mu must be held.
+func (spool *Spool) evict() {
+	for spool.total > spool.config.MaxBytes && len(spool.segments) > 1 {
+		seq := spool.segments[0]
+		atomic.AddInt64(&spool.evicted, int64(spool.records[seq]))
+		spool.dropSegment(seq)
+	}
+}
+
+// dropSegment deletes the oldest segment and moves the cursor past it.
+// spool.mu must be held.
+func (spool *Spool) dropSegment(seq int64) {
+	os.Remove(spool.path(seq))
+	spool.total -= spool.sizes[seq]
+	delete(spool.sizes, seq)
+	delete(spool.records, seq)
+	spool.segments = spool.segments[1:]
+	if spool.cursor.Seq <= seq {
+		spool.cursor = spoolCursor{Seq: spool.segments[0]}
+		spool.saveCursor()
+	}
+}
+
+func (spool *Spool) saveCursor() error {
+	js, err := json.Marshal(spool.cursor)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(spool.config.Dir, spoolCursorFile+".tmp")
+	if err := ioutil.WriteFile(tmp, js, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(spool.config.Dir, spoolCursorFile))
+}
+
+// Replay sends the spooled batches oldest first. It stops at the first
+// batch which can't be sent yet and returns its error; batches which can
+// never be sent are discarded and reported to OnReject.
+func (spool *Spool) Replay(ctx context.Context) error {
+	spool.replayMu.Lock()
+	defer spool.replayMu.Unlock()
+
+	for {
+		record, next, err := spool.next()
+		if err != nil || record == nil {
+			return err
+		}
+
+		var logs *LogList
+		var metrics *MetricList
+		if record.Kind == "logs" {
+			logs = &LogList{Name: record.Name, Logs: record.Logs}
+			_, err = spool.api.PostLogsCtx(ctx, *logs)
+		} else {
+			metrics = &MetricList{Name: record.Name, Columns: record.Columns,
+				Metrics: record.Metrics}
+			_, err = spool.api.PostMetricsCtx(ctx, *metrics)
+		}
+		if err != nil && (IsTransient(err) || ctx.Err() != nil) {
+			return err
+		}
+		if err != nil {
+			atomic.AddInt64(&spool.rejected, 1)
+			if spool.config.OnReject != nil {
+				spool.config.OnReject(logs, metrics, err)
+			}
+		} else {
+			atomic.AddInt64(&spool.replayed, 1)
+		}
+
+		spool.mu.Lock()
+		// The segment may have been evicted while sending.
+		if spool.cursor.Seq == next.Seq && spool.cursor.Offset < next.Offset {
+			spool.cursor = next
+			spool.records[next.Seq]--
+			err = spool.saveCursor()
+		}
+		spool.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// next reads the record at the cursor, deleting segments which are fully
+// replayed. It returns a nil record when nothing is left, and the position
+// following the record.
+func (spool *Spool) next() (*spoolRecord, spoolCursor, error) {
+	spool.mu.Lock()
+	defer spool.mu.Unlock()
+	for len(spool.segments) > 0 {
+		seq := spool.cursor.Seq
+		if spool.cursor.Offset < spool.sizes[seq] {
+			record, size, err := readRecord(spool.path(seq), spool.cursor.Offset)
+			if err == nil {
+				return record, spoolCursor{Seq: seq, Offset: spool.cursor.Offset + size}, nil
+			}
+			if err != errCorrupted {
+				return nil, spool.cursor, err
+			}
+			atomic.AddInt64(&spool.corrupted, 1)
+		}
+		if seq == spool.activeSeq {
+			if spool.cursor.Offset >= spool.sizes[seq] {
+				return nil, spool.cursor, nil
+			}
+			// Skip the corrupted tail of the active segment.
+			if err := spool.rotate(); err != nil {
+				return nil, spool.cursor, err
+			}
+		}
+		spool.dropSegment(seq)
+	}
+	return nil, spool.cursor, nil
+}
+
+// readRecord reads the record at offset in a segment file and returns it
+// with its size on disk.
+func readRecord(path string, offset int64) (*spoolRecord, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	payload, err := readPayload(file)
+	if err != nil {
+		return nil, 0, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	// Keep numbers in logs as they were sent.
+	decoder.UseNumber()
+	var record spoolRecord
+	if err := decoder.Decode(&record); err != nil {
+		return nil, 0, errCorrupted
+	}
+	return &record, int64(spoolHeaderSize + len(payload)), nil
+}
+
+func readPayload(reader io.Reader) ([]byte, error) {
+	header := make([]byte, spoolHeaderSize)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, errCorrupted
+	}
+	payload := make([]byte, binary.BigEndian.Uint32(header[0:4]))
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, errCorrupted
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, errCorrupted
+	}
+	return payload, nil
+}
+
+// countRecords counts the valid records of a segment file.
+func countRecords(path string) (int, error) {
+	return countRecordsBefore(path, -1)
+}
+
+// countRecordsBefore counts the valid records starting before offset, or
+// all of them if offset is negative.
+func countRecordsBefore(path string, offset int64) (int, error) {
+	js, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	reader := bytes.NewReader(js)
+	count := 0
+	for reader.Len() > 0 {
+		if offset >= 0 && int64(len(js)-reader.Len()) >= offset {
+			break
+		}
+		if _, err := readPayload(reader); err != nil {
+			break
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Pending returns the number of bytes waiting to be replayed.
+func (spool *Spool) Pending() int64 {
+	spool.mu.Lock()
+	defer spool.mu.Unlock()
+	return spool.total - spool.cursor.Offset
+}
+
+// Stats returns the counters of the spool.
+func (spool *Spool) Stats() SpoolStats {
+	return SpoolStats{
+		Spooled:      atomic.LoadInt64(&spool.spooled),
+		Replayed:     atomic.LoadInt64(&spool.replayed),
+		Rejected:     atomic.LoadInt64(&spool.rejected),
+		Evicted:      atomic.LoadInt64(&spool.evicted),
+		Corrupted:    atomic.LoadInt64(&spool.corrupted),
+		PendingBytes: spool.Pending(),
+	}
+}
+
+// Close stops the background replay and closes the spool. Batches left are
+// replayed when the spool is opened again. Calling Close again returns the
+// result of the first call.
+func (spool *Spool) Close() error {
+	spool.closeOnce.Do(func() {
+		spool.closeErr = spool.close()
+	})
+	return spool.closeErr
+}
+
+func (spool *Spool) close() error {
+	close(spool.stop)
+	<-spool.done
+	spool.mu.Lock()
+	defer spool.mu.Unlock()
+	spool.closed = true
+	return spool.active.Close()
+}
+
+func (spool *Spool) run() {
+	defer close(spool.done)
+	ticker := time.NewTicker(spool.config.RetryInterval)
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-spool.stop
+		cancel()
+	}()
+	for {
+		select {
+		case <-ticker.C:
+			spool.Replay(ctx)
+		case <-spool.stop:
+			return
+		}
+	}
+}
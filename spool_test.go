@@ -0,0 +1,416 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// toggle is a server which can be switched down and up. While it is down,
+// connections are closed without an answer. It records the log and metric
+// names posted to it, in order.
+type toggle struct {
+	sync.Mutex
+	down   bool
+	status int
+	names  []string
+}
+
+func newToggle() (*httptest.Server, *toggle) {
+	state := &toggle{status: 200}
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			state.Lock()
+			defer state.Unlock()
+			if state.down {
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+				return
+			}
+			w.WriteHeader(state.status)
+			if state.status != 200 {
+				fmt.Fprintln(w, `{"error": "rejected"}`)
+				return
+			}
+			parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+			state.names = append(state.names, parts[0]+":"+parts[2])
+			fmt.Fprintln(w, `{"successful": 1}`)
+		}))
+	return server, state
+}
+
+func (state *toggle) set(down bool, status int) {
+	state.Lock()
+	state.down = down
+	state.status = status
+	state.Unlock()
+}
+
+func (state *toggle) received() []string {
+	state.Lock()
+	defer state.Unlock()
+	return append([]string(nil), state.names...)
+}
+
+func spoolDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "zeus-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func spoolLogs(name string) LogList {
+	return LogList{Name: name, Logs: []Log{Log{"message": "from " + name}}}
+}
+
+func TestSpoolReplayAfterRestart(t *testing.T) {
+	server, state := newToggle()
+	defer server.Close()
+	dir := spoolDir(t)
+	defer os.RemoveAll(dir)
+
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+	bucket := zeus.Bucket("org1/bucket1")
+	config := SpoolConfig{Dir: dir, RetryInterval: time.Hour}
+	spool, err := OpenSpool(bucket, config)
+	if err != nil {
+		t.Fatal("failed to open spool:", err)
+	}
+
+	state.set(true, 200)
+	ctx := context.Background()
+	if err := spool.PostLogs(ctx, spoolLogs("log1")); err != nil {
+		t.Error("failed to spool logs:", err)
+	}
+	metrics := MetricList{Name: "metric1", Columns: []string{"value"},
+		Metrics: []Metric{Metric{Timestamp: 1430355869.123, Point: []float64{1}}}}
+	if err := spool.PostMetrics(ctx, metrics); err != nil {
+		t.Error("failed to spool metrics:", err)
+	}
+	state.set(false, 200)
+	// Spooled batches are still waiting, so this one is spooled behind them.
+	if err := spool.PostLogs(ctx, spoolLogs("log2")); err != nil {
+		t.Error("failed to spool logs:", err)
+	}
+	if len(state.received()) != 0 {
+		t.Error("batches were sent out of order:", state.received())
+	}
+	if err := spool.Close(); err != nil {
+		t.Fatal("failed to close spool:", err)
+	}
+	if err := spool.Close(); err != nil {
+		t.Error("failed to close spool twice:", err)
+	}
+	if err := spool.StoreLogs(spoolLogs("log3")); err != ErrSpoolClosed {
+		t.Error("expected a closed spool to fail, got", err)
+	}
+	state.set(true, 200)
+
+	// Restart and replay once Zeus is back.
+	spool, err = OpenSpool(bucket, config)
+	if err != nil {
+		t.Fatal("failed to reopen spool:", err)
+	}
+	defer spool.Close()
+	if err := spool.Replay(ctx); err == nil {
+		t.Error("replay should fail while Zeus is down")
+	}
+	state.set(false, 200)
+	if err := spool.Replay(ctx); err != nil {
+		t.Fatal("failed to replay:", err)
+	}
+	expected := []string{"logs:log1", "metrics:metric1", "logs:log2"}
+	if fmt.Sprint(state.received()) != fmt.Sprint(expected) {
+		t.Errorf("replayed %v, expected %v", state.received(), expected)
+	}
+	if stats := spool.Stats(); stats.Replayed != 3 || stats.PendingBytes != 0 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+}
+
+func TestSpoolCursor(t *testing.T) {
+	server, state := newToggle()
+	defer server.Close()
+	dir := spoolDir(t)
+	defer os.RemoveAll(dir)
+
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+	config := SpoolConfig{Dir: dir, RetryInterval: time.Hour}
+	spool, _ := OpenSpool(zeus.Bucket("org1/bucket1"), config)
+	for _, name := range []string{"log1", "log2", "log3"} {
+		spool.StoreLogs(spoolLogs(name))
+	}
+
+	// Let one request through, then go down.
+	var once sync.Once
+	zeus.client = &http.Client{Transport: roundTripFunc(
+		func(r *http.Request) (*http.Response, error) {
+			response, err := http.DefaultTransport.RoundTrip(r)
+			once.Do(func() { state.set(true, 200) })
+			return response, err
+		})}
+	if err := spool.Replay(context.Background()); err == nil {
+		t.Error("replay should stop when Zeus goes down")
+	}
+	spool.Close()
+
+	state.set(false, 200)
+	zeus.client = nil
+	spool, _ = OpenSpool(zeus.Bucket("org1/bucket1"), config)
+	defer spool.Close()
+	if err := spool.Replay(context.Background()); err != nil {
+		t.Fatal("failed to replay:", err)
+	}
+	expected := []string{"logs:log1", "logs:log2", "logs:log3"}
+	if fmt.Sprint(state.received()) != fmt.Sprint(expected) {
+		t.Errorf("replayed %v, expected %v", state.received(), expected)
+	}
+}
+
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestSpoolRejected(t *testing.T) {
+	server, state := newToggle()
+	defer server.Close()
+	dir := spoolDir(t)
+	defer os.RemoveAll(dir)
+
+	var rejected []string
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+	spool, _ := OpenSpool(zeus.Bucket("org1/bucket1"), SpoolConfig{
+		Dir:           dir,
+		RetryInterval: time.Hour,
+		OnReject: func(logs *LogList, metrics *MetricList, err error) {
+			if !IsBadRequest(err) {
+				t.Error("unexpected error:", err)
+			}
+			rejected = append(rejected, logs.Name)
+		},
+	})
+	defer spool.Close()
+
+	state.set(false, 400)
+	if err := spool.PostLogs(context.Background(), spoolLogs("log1")); !IsBadRequest(err) {
+		t.Error("rejected logs should not be spooled, got", err)
+	}
+	spool.StoreLogs(spoolLogs("log2"))
+	if err := spool.Replay(context.Background()); err != nil {
+		t.Error("failed to replay:", err)
+	}
+	if len(rejected) != 1 || rejected[0] != "log2" {
+		t.Error("wrong rejected batches:", rejected)
+	}
+	if stats := spool.Stats(); stats.Rejected != 1 || stats.PendingBytes != 0 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+}
+
+func TestSpoolCorrupted(t *testing.T) {
+	server, state := newToggle()
+	defer server.Close()
+	dir := spoolDir(t)
+	defer os.RemoveAll(dir)
+
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+	config := SpoolConfig{Dir: dir, RetryInterval: time.Hour}
+	spool, _ := OpenSpool(zeus.Bucket("org1/bucket1"), config)
+	spool.StoreLogs(spoolLogs("log1"))
+	spool.StoreLogs(spoolLogs("log2"))
+	path := spool.path(spool.activeSeq)
+	spool.Close()
+
+	// Flip a byte in the second record.
+	js, _ := ioutil.ReadFile(path)
+	js[len(js)-3] ^= 0xff
+	ioutil.WriteFile(path, js, 0600)
+
+	spool, _ = OpenSpool(zeus.Bucket("org1/bucket1"), config)
+	defer spool.Close()
+	spool.StoreLogs(spoolLogs("log3"))
+	if err := spool.Replay(context.Background()); err != nil {
+		t.Fatal("failed to replay:", err)
+	}
+	expected := []string{"logs:log1", "logs:log3"}
+	if fmt.Sprint(state.received()) != fmt.Sprint(expected) {
+		t.Errorf("replayed %v, expected %v", state.received(), expected)
+	}
+	if stats := spool.Stats(); stats.Corrupted != 1 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+}
+
+func TestSpoolFailedWrite(t *testing.T) {
+	server, state := newToggle()
+	defer server.Close()
+	dir := spoolDir(t)
+	defer os.RemoveAll(dir)
+
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+	config := SpoolConfig{Dir: dir, RetryInterval: time.Hour}
+	spool, _ := OpenSpool(zeus.Bucket("org1/bucket1"), config)
+	defer spool.Close()
+	spool.StoreLogs(spoolLogs("log1"))
+
+	// Neither writing nor truncating a read-only file works: the spool
+	// moves on to a new segment.
+	seq := spool.activeSeq
+	spool.active.Close()
+	spool.active, _ = os.Open(spool.path(seq))
+	if err := spool.StoreLogs(spoolLogs("log2")); err == nil {
+		t.Error("expected the write to fail")
+	}
+	if spool.activeSeq == seq {
+		t.Error("a new segment should be started")
+	}
+	if err := spool.StoreLogs(spoolLogs("log3")); err != nil {
+		t.Fatal("failed to spool logs after a failed write:", err)
+	}
+	if err := spool.Replay(context.Background()); err != nil {
+		t.Fatal("failed to replay:", err)
+	}
+	expected := []string{"logs:log1", "logs:log3"}
+	if fmt.Sprint(state.received()) != fmt.Sprint(expected) {
+		t.Errorf("replayed %v, expected %v", state.received(), expected)
+	}
+	if stats := spool.Stats(); stats.Corrupted != 0 || stats.Spooled != 2 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+}
+
+func TestSpoolEviction(t *testing.T) {
+	server, state := newToggle()
+	defer server.Close()
+	dir := spoolDir(t)
+	defer os.RemoveAll(dir)
+
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+	spool, _ := OpenSpool(zeus.Bucket("org1/bucket1"), SpoolConfig{
+		Dir:           dir,
+		MaxBytes:      300,
+		SegmentBytes:  100,
+		RetryInterval: time.Hour,
+	})
+	defer spool.Close()
+	for i := 0; i < 10; i++ {
+		spool.StoreLogs(spoolLogs(fmt.Sprintf("log%d", i)))
+	}
+	if pending := spool.Pending(); pending > 300 {
+		t.Errorf("spool holds %d bytes, expected at most 300", pending)
+	}
+	if err := spool.Replay(context.Background()); err != nil {
+		t.Fatal("failed to replay:", err)
+	}
+	received := state.received()
+	stats := spool.Stats()
+	if stats.Evicted == 0 || int(stats.Evicted)+len(received) != 10 {
+		t.Errorf("wrong stats: %+v, replayed %v", stats, received)
+	}
+	if len(received) == 0 || received[len(received)-1] != "logs:log9" {
+		t.Error("newest batches should be kept:", received)
+	}
+}
+
+func TestSpoolBackground(t *testing.T) {
+	server, state := newToggle()
+	defer server.Close()
+	dir := spoolDir(t)
+	defer os.RemoveAll(dir)
+
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+	spool, _ := OpenSpool(zeus.Bucket("org1/bucket1"), SpoolConfig{
+		Dir:           dir,
+		RetryInterval: 10 * time.Millisecond,
+	})
+	defer spool.Close()
+
+	state.set(true, 200)
+	shipper := NewLogShipper(zeus.Bucket("org1/bucket1"), LogShipperConfig{
+		Spool: spool,
+	})
+	shipper.Send("syslog", Log{"foo": "bar"})
+	shipper.Close(context.Background())
+	if stats := shipper.Stats(); stats.Spooled != 1 || stats.Failed != 0 {
+		t.Errorf("wrong shipper stats: %+v", stats)
+	}
+
+	state.set(false, 200)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(state.received()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if fmt.Sprint(state.received()) != "[logs:syslog]" {
+		t.Error("spooled logs were not replayed:", state.received())
+	}
+}
+
+func TestSpoolInvalid(t *testing.T) {
+	server, state := newToggle()
+	defer server.Close()
+	dir := spoolDir(t)
+	defer os.RemoveAll(dir)
+
+	var rejected []string
+	zeus, _ := NewClient(server.URL, "goZeus",
+		WithFlatten(FlattenConfig{Strict: true}))
+	spool, _ := OpenSpool(zeus.Bucket("org1/bucket1"), SpoolConfig{
+		Dir:           dir,
+		RetryInterval: time.Hour,
+		OnReject: func(logs *LogList, metrics *MetricList, err error) {
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Error("unexpected error:", err)
+			}
+			rejected = append(rejected, logs.Name)
+		},
+	})
+	defer spool.Close()
+
+	nested := LogList{Name: "log1",
+		Logs: []Log{Log{"nested": map[string]interface{}{"foo": "bar"}}}}
+	var validationErr *ValidationError
+	err := spool.PostLogs(context.Background(), nested)
+	if !errors.As(err, &validationErr) || spool.Pending() != 0 {
+		t.Error("invalid logs should not be spooled, got", err)
+	}
+	spool.StoreLogs(nested)
+	spool.StoreLogs(spoolLogs("log2"))
+	if err := spool.Replay(context.Background()); err != nil {
+		t.Fatal("failed to replay:", err)
+	}
+	if fmt.Sprint(rejected) != "[log1]" {
+		t.Error("wrong rejected batches:", rejected)
+	}
+	if fmt.Sprint(state.received()) != "[logs:log2]" {
+		t.Error("batch after the invalid one was not replayed:", state.received())
+	}
+	if spool.Pending() != 0 {
+		t.Error("spool should be empty, holds", spool.Pending())
+	}
+}
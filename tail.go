@@ -0,0 +1,213 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"iter"
+	"math"
+	"sort"
+	"time"
+)
+
+// TailConfig configures TailLogs. Zero fields take their value from
+// DefaultTailConfig.
+type TailConfig struct {
+	// MinInterval is the delay between polls while logs keep arriving.
+	MinInterval time.Duration
+	// MaxInterval is the longest delay between polls, reached by doubling
+	// the delay after every poll without new logs or with a transient error.
+	MaxInterval time.Duration
+	// TimestampField is the field holding the unix time of a log, in
+	// seconds.
+	TimestampField string
+	// OnError, if set, is called with every transient error, after which
+	// the poll is retried.
+	OnError func(err error)
+}
+
+// DefaultTailConfig holds the defaults of TailConfig.
+var DefaultTailConfig = TailConfig{
+	MinInterval:    time.Second,
+	MaxInterval:    30 * time.Second,
+	TimestampField: "timestamp",
+}
+
+// TailLogs follows the logs matching query as they arrive, polling api from
+// the timestamp of the newest log seen so far. Logs at that timestamp are
+// returned again by the next poll and are skipped, so each log is yielded
+// once, ordered by timestamp within a poll. Logs are told apart by content:
+// identical logs at the same timestamp are counted, so that all of them are
+// yielded. Tailing starts at the beginning of query's time range, or now if
+// it has none; its end, limit and order are ignored.
+//
+// Errors for which IsTransient is true, such as timeouts and 5xx responses,
+// are retried; other errors are yielded and end the iteration, which
+// otherwise runs until ctx is done or the loop breaks.
+func TailLogs(ctx context.Context, api LogsAPI, query LogQuery,
+	config TailConfig) iter.Seq2[Log, error] {
+	if config.MinInterval <= 0 {
+		config.MinInterval = DefaultTailConfig.MinInterval
+	}
+	if config.MaxInterval < config.MinInterval {
+		config.MaxInterval = DefaultTailConfig.MaxInterval
+		if config.MaxInterval < config.MinInterval {
+			config.MaxInterval = config.MinInterval
+		}
+	}
+	if config.TimestampField == "" {
+		config.TimestampField = DefaultTailConfig.TimestampField
+	}
+
+	return func(yield func(Log, error) bool) {
+		if err := query.Validate(); err != nil {
+			yield(nil, err)
+			return
+		}
+		tail := &logTail{
+			api:   api,
+			query: query,
+			field: config.TimestampField,
+			seen:  make(map[uint64]seenLog),
+		}
+		if query.from.IsZero() {
+			tail.mark = float64(time.Now().Unix())
+		} else {
+			tail.mark = UnixSeconds(query.from)
+		}
+		tail.query.to = time.Time{}
+		tail.query.limit = 0
+		tail.query.sortField = ""
+
+		interval := config.MinInterval
+		for {
+			logs, err := tail.poll(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil && !IsTransient(err) {
+				yield(nil, err)
+				return
+			}
+			if err != nil && config.OnError != nil {
+				config.OnError(err)
+			}
+			for _, log := range logs {
+				if !yield(log, nil) {
+					return
+				}
+			}
+
+			// A poll which failed on a later page doubles the delay, even
+			// if its first pages yielded logs.
+			if len(logs) > 0 && err == nil {
+				interval = config.MinInterval
+			} else if interval *= 2; interval > config.MaxInterval {
+				interval = config.MaxInterval
+			}
+			timer := time.NewTimer(interval)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+		}
+	}
+}
+
+// logTail holds the state of TailLogs between polls.
+type logTail struct {
+	api   LogsAPI
+	query LogQuery
+	field string
+	// mark is the timestamp of the newest log seen.
+	mark float64
+	// seen holds the hashes of the logs seen at or after the second of
+	// mark.
+	seen map[uint64]seenLog
+}
+
+// seenLog counts the logs with the same hash seen by TailLogs.
+type seenLog struct {
+	timestamp float64
+	count     int
+}
+
+// poll returns the logs which arrived since the last poll, oldest first.
+func (tail *logTail) poll(ctx context.Context) ([]Log, error) {
+	query := tail.query
+	query.from = time.Unix(int64(math.Floor(tail.mark)), 0)
+
+	type entry struct {
+		log       Log
+		timestamp float64
+	}
+	var fresh []entry
+	// counts holds how many times each hash was returned by this poll. Logs
+	// beyond the count seen before are new.
+	counts := make(map[uint64]int)
+	err := scanLogs(ctx, tail.api, query, func(log Log) bool {
+		hash := hashLog(log)
+		counts[hash]++
+		seen, ok := tail.seen[hash]
+		if ok && counts[hash] <= seen.count {
+			return true
+		}
+		timestamp, ok := toFloat(log[tail.field])
+		if !ok {
+			timestamp = tail.mark
+		}
+		if seen.count == 0 {
+			seen.timestamp = timestamp
+		}
+		seen.count++
+		tail.seen[hash] = seen
+		fresh = append(fresh, entry{log, timestamp})
+		return true
+	})
+
+	sort.SliceStable(fresh, func(i, j int) bool {
+		return fresh[i].timestamp < fresh[j].timestamp
+	})
+	logs := make([]Log, len(fresh))
+	for i, entry := range fresh {
+		logs[i] = entry.log
+		// After a failed page, the logs of the pages not retrieved may be
+		// older than those yielded, so the mark stays for the next poll to
+		// find them; the logs yielded are skipped as seen.
+		if err == nil && entry.timestamp > tail.mark {
+			tail.mark = entry.timestamp
+		}
+	}
+	floor := math.Floor(tail.mark)
+	for hash, seen := range tail.seen {
+		if seen.timestamp < floor {
+			delete(tail.seen, hash)
+		}
+	}
+	return logs, err
+}
+
+// hashLog identifies a log by its content. encoding/json sorts map keys, so
+// equal logs have the same hash.
+func hashLog(log Log) uint64 {
+	js, _ := json.Marshal(log)
+	hash := fnv.New64a()
+	hash.Write(js)
+	return hash.Sum64()
+}
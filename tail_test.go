@@ -0,0 +1,218 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tailSource serves its logs with a timestamp at or after the from
+// parameter, a page at a time, failing with the queued statuses first.
+// pageStatuses are only used for the pages after the first.
+type tailSource struct {
+	sync.Mutex
+	logs         []Log
+	statuses     []int
+	pageStatuses []int
+	froms        []string
+}
+
+func newTailSource() (*httptest.Server, *tailSource) {
+	source := &tailSource{}
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			source.Lock()
+			defer source.Unlock()
+			if len(source.statuses) > 0 {
+				w.WriteHeader(source.statuses[0])
+				source.statuses = source.statuses[1:]
+				return
+			}
+			offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+			if offset > 0 && len(source.pageStatuses) > 0 {
+				w.WriteHeader(source.pageStatuses[0])
+				source.pageStatuses = source.pageStatuses[1:]
+				return
+			}
+			from, _ := strconv.ParseFloat(r.URL.Query().Get("from"), 64)
+			source.froms = append(source.froms, r.URL.Query().Get("from"))
+			logs := []Log{}
+			// Newest first, as the order of Zeus is not relied upon.
+			for i := len(source.logs) - 1; i >= 0; i-- {
+				if source.logs[i]["timestamp"].(float64) >= from {
+					logs = append(logs, source.logs[i])
+				}
+			}
+			total := len(logs)
+			if limit, _ := strconv.Atoi(r.URL.Query().Get("limit")); limit > 0 {
+				logs = logs[min(offset, total):min(offset+limit, total)]
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"total": total, "result": logs})
+		}))
+	return server, source
+}
+
+func (source *tailSource) add(logs ...Log) {
+	source.Lock()
+	defer source.Unlock()
+	source.logs = append(source.logs, logs...)
+}
+
+func (source *tailSource) fail(statuses ...int) {
+	source.Lock()
+	defer source.Unlock()
+	source.statuses = append(source.statuses, statuses...)
+}
+
+func TestTailLogs(t *testing.T) {
+	server, source := newTailSource()
+	defer server.Close()
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+	start := time.Unix(1430355860, 0)
+	source.add(
+		Log{"timestamp": 1430355850.0, "message": "too old"},
+		Log{"timestamp": 1430355860.0, "message": "a"},
+		Log{"timestamp": 1430355861.5, "message": "b"},
+		Log{"timestamp": 1430355861.2, "message": "c"},
+	)
+
+	var errs []error
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	logs := TailLogs(ctx, zeus.Bucket("org1/bucket1"),
+		NewLogQuery("syslog").Between(start, time.Time{}),
+		TailConfig{
+			MinInterval: time.Millisecond,
+			MaxInterval: 5 * time.Millisecond,
+			OnError:     func(err error) { errs = append(errs, err) },
+		})
+
+	var messages []string
+	for log, err := range logs {
+		if err != nil {
+			t.Fatal("failed to tail:", err)
+		}
+		messages = append(messages, log["message"].(string))
+		switch len(messages) {
+		case 3:
+			// Same second as the newest log, twice, and a newer one.
+			source.fail(503)
+			source.add(
+				Log{"timestamp": 1430355861.7, "message": "d"},
+				Log{"timestamp": 1430355861.7, "message": "d"},
+				Log{"timestamp": 1430355863.0, "message": "e"},
+			)
+		}
+		if len(messages) == 6 {
+			break
+		}
+	}
+	expected := []string{"a", "c", "b", "d", "d", "e"}
+	if len(messages) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, messages)
+	}
+	for i := range expected {
+		if messages[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, messages)
+		}
+	}
+	if len(errs) != 1 || !IsServerError(errs[0]) {
+		t.Error("expected one transient error, got", errs)
+	}
+	source.Lock()
+	if source.froms[0] != "1430355860" || source.froms[len(source.froms)-1] != "1430355861" {
+		t.Error("wrong high-water marks:", source.froms)
+	}
+	source.Unlock()
+}
+
+func TestTailLogsFailedPage(t *testing.T) {
+	server, source := newTailSource()
+	defer server.Close()
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+	source.add(
+		Log{"timestamp": 1430355860.0, "message": "a"},
+		Log{"timestamp": 1430355861.0, "message": "b"},
+		Log{"timestamp": 1430355862.0, "message": "c"},
+		Log{"timestamp": 1430355863.0, "message": "d"},
+	)
+	// The second page, holding the oldest logs, fails once.
+	source.pageStatuses = []int{503}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	counts := make(map[string]int)
+	var yielded int
+	for log, err := range TailLogs(ctx, zeus.Bucket("org1/bucket1"),
+		NewLogQuery("syslog").Between(time.Unix(1430355860, 0), time.Time{}).
+			PageSize(2),
+		TailConfig{MinInterval: time.Millisecond, MaxInterval: time.Millisecond}) {
+		if err != nil {
+			t.Fatal("failed to tail:", err)
+		}
+		counts[log["message"].(string)]++
+		if yielded++; yielded == 4 {
+			break
+		}
+	}
+	for _, message := range []string{"a", "b", "c", "d"} {
+		if counts[message] != 1 {
+			t.Errorf("expected %s to be yielded once, got %v", message, counts)
+		}
+	}
+}
+
+func TestTailLogsErrors(t *testing.T) {
+	server, source := newTailSource()
+	defer server.Close()
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+	bucket := zeus.Bucket("org1/bucket1")
+	config := TailConfig{MinInterval: time.Millisecond}
+
+	source.fail(401)
+	for _, err := range TailLogs(context.Background(), bucket,
+		NewLogQuery("syslog"), config) {
+		if !IsUnauthorized(err) {
+			t.Error("expected an unauthorized error, got", err)
+		}
+	}
+
+	// Not retried, as it fails the same way every time.
+	var calls int
+	empty := &Zeus{ApiServ: server.URL}
+	for _, err := range TailLogs(context.Background(),
+		empty.Bucket("org1/bucket1"), NewLogQuery("syslog"), config) {
+		if calls++; err == nil || IsTransient(err) {
+			t.Error("expected a permanent error, got", err)
+		}
+	}
+	if calls != 1 {
+		t.Error("expected one error, got", calls)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	for log, err := range TailLogs(ctx, bucket, NewLogQuery("syslog"), config) {
+		t.Error("expected no logs, got", log, err)
+	}
+}
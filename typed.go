@@ -0,0 +1,508 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MarshalLog converts a struct, or a pointer to one, into a Log. Fields are
+// named by their `zeus:"name"` tag, or by their Go name without one:
+//
+//	type Request struct {
+//		Path     string        `zeus:"path"`
+//		Status   int           `zeus:"status"`
+//		Duration time.Duration `zeus:"duration_ns"`
+//		Time     time.Time     `zeus:"timestamp,unix"`
+//		User     string        `zeus:"user,omitempty"`
+//		Internal string        `zeus:"-"`
+//	}
+//
+// Strings and numbers are kept, booleans become "true" or "false", times
+// are formatted with time.RFC3339Nano, or as unix seconds with the "unix"
+// option, and encoding.TextMarshaler values are converted to text. Fields
+// of embedded structs are promoted and fields of other struct fields are
+// prefixed with the field's name and a ".". With "omitempty", zero values
+// and nil pointers are left out. Other types, such as slices and maps,
+// return a *ValidationError since Zeus doesn't accept nested values, as do
+// pointers leading back to a struct being marshalled.
+func MarshalLog(v interface{}) (Log, error) {
+	value := reflect.ValueOf(v)
+	visiting := make(map[visit]bool)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil, errors.New("cannot marshal nil into a Log")
+		}
+		visiting[visit{value.Pointer(), value.Type()}] = true
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot marshal %s into a Log", value.Type())
+	}
+	log := make(Log)
+	if err := marshalStruct(log, "", value, visiting); err != nil {
+		return nil, err
+	}
+	return log, nil
+}
+
+// UnmarshalLog stores the values of log in the struct pointed to by v,
+// following the rules of MarshalLog. Fields missing from log are left
+// untouched and keys without a field are ignored.
+func UnmarshalLog(log Log, v interface{}) error {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Ptr || value.IsNil() ||
+		value.Elem().Kind() != reflect.Struct {
+		return errors.New("UnmarshalLog needs a non-nil pointer to a struct")
+	}
+	return unmarshalStruct(log, "", value.Elem())
+}
+
+// PostTyped converts items with MarshalLog and sends them under logName
+// with api.
+func PostTyped[T any](ctx context.Context, api LogsAPI, logName string,
+	items []T) (successful int, err error) {
+	logs := LogList{Name: logName, Logs: make([]Log, len(items))}
+	for i, item := range items {
+		if logs.Logs[i], err = MarshalLog(item); err != nil {
+			return 0, err
+		}
+	}
+	return api.PostLogsCtx(ctx, logs)
+}
+
+// GetLogsAs retrieves logs with the GetLogs of api and converts them with
+// UnmarshalLog. GetLogs decodes numbers as float64, so integers beyond 2^53
+// may not be exact.
+func GetLogsAs[T any](ctx context.Context, api LogsAPI, logName, field,
+	pattern string, from, to int64, offset, limit int) (
+	total int, items []T, err error) {
+	total, logs, err := api.GetLogsCtx(ctx, logName, field, pattern, from, to,
+		offset, limit)
+	if err != nil {
+		return 0, nil, err
+	}
+	items = make([]T, len(logs.Logs))
+	for i, log := range logs.Logs {
+		if err := UnmarshalLog(log, &items[i]); err != nil {
+			return 0, nil, err
+		}
+	}
+	return total, items, nil
+}
+
+type fieldTag struct {
+	name      string
+	omitEmpty bool
+	unix      bool
+}
+
+// parseTag returns the tag of a field, or false if it is skipped.
+func parseTag(field reflect.StructField) (fieldTag, bool) {
+	if field.PkgPath != "" && !field.Anonymous {
+		return fieldTag{}, false
+	}
+	tag := field.Tag.Get("zeus")
+	if tag == "-" {
+		return fieldTag{}, false
+	}
+	parts := strings.Split(tag, ",")
+	result := fieldTag{name: parts[0]}
+	for _, opt := range parts[1:] {
+		switch opt {
+		case "omitempty":
+			result.omitEmpty = true
+		case "unix":
+			result.unix = true
+		}
+	}
+	return result, true
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// isLeaf reports whether values of typ are stored in a single key.
+func isLeaf(typ reflect.Type) bool {
+	return typ == timeType || typ.Implements(textMarshalerType) ||
+		reflect.PtrTo(typ).Implements(textUnmarshalerType) ||
+		typ.Kind() != reflect.Struct
+}
+
+// visit is a pointer followed by marshalStruct. The type tells a struct from
+// its first field, which has the same address.
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+// marshalStruct stores the fields of value in log. visiting holds the
+// pointers followed to reach value, to detect cycles.
+func marshalStruct(log Log, prefix string, value reflect.Value,
+	visiting map[visit]bool) error {
+	typ := value.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag, ok := parseTag(field)
+		if !ok {
+			continue
+		}
+		fieldValue := value.Field(i)
+		if tag.omitEmpty && fieldValue.IsZero() {
+			continue
+		}
+		var followed []visit
+		for fieldValue.Kind() == reflect.Ptr {
+			if fieldValue.IsNil() {
+				break
+			}
+			followed = append(followed, visit{fieldValue.Pointer(), fieldValue.Type()})
+			fieldValue = fieldValue.Elem()
+		}
+		if fieldValue.Kind() == reflect.Ptr {
+			// A nil pointer without omitempty.
+			continue
+		}
+
+		if fieldValue.Kind() == reflect.Struct && !isLeaf(fieldValue.Type()) {
+			nested := prefix
+			if !field.Anonymous || tag.name != "" {
+				nested += fieldName(field, tag) + "."
+			}
+			for _, pointer := range followed {
+				if visiting[pointer] {
+					return &ValidationError{Field: prefix + fieldName(field, tag),
+						Reason: "cyclic pointer"}
+				}
+				visiting[pointer] = true
+			}
+			err := marshalStruct(log, nested, fieldValue, visiting)
+			for _, pointer := range followed {
+				delete(visiting, pointer)
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			// Unexported embedded non-struct.
+			continue
+		}
+
+		key := prefix + fieldName(field, tag)
+		converted, err := marshalValue(key, fieldValue, tag)
+		if err != nil {
+			return err
+		}
+		log[key] = converted
+	}
+	return nil
+}
+
+func fieldName(field reflect.StructField, tag fieldTag) string {
+	if tag.name != "" {
+		return tag.name
+	}
+	return field.Name
+}
+
+func marshalValue(key string, value reflect.Value, tag fieldTag) (interface{}, error) {
+	if value.Type() == timeType {
+		t := value.Interface().(time.Time)
+		if tag.unix {
+			// UnixNano overflows outside of the years 1678 to 2262.
+			return float64(t.Unix()) + float64(t.Nanosecond())/1e9, nil
+		}
+		return t.Format(time.RFC3339Nano), nil
+	}
+	if value.Type().Implements(textMarshalerType) {
+		text, err := value.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return nil, &ValidationError{Field: key, Reason: err.Error()}
+		}
+		return string(text), nil
+	}
+	switch value.Kind() {
+	case reflect.String:
+		return value.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		return value.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), nil
+	}
+	return nil, &ValidationError{Field: key,
+		Reason: fmt.Sprintf("%s is not a string or a number", value.Type())}
+}
+
+func unmarshalStruct(log Log, prefix string, value reflect.Value) error {
+	typ := value.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag, ok := parseTag(field)
+		if !ok {
+			continue
+		}
+		fieldValue := value.Field(i)
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		if fieldType.Kind() == reflect.Struct && !isLeaf(fieldType) {
+			nested := prefix
+			if !field.Anonymous || tag.name != "" {
+				nested += fieldName(field, tag) + "."
+			}
+			if !hasPrefix(log, nested) {
+				continue
+			}
+			if fieldValue.Kind() == reflect.Ptr && fieldValue.IsNil() &&
+				!fieldValue.CanSet() {
+				// As encoding/json, which can't allocate it either.
+				return &ValidationError{Field: field.Name, Reason: fmt.Sprintf(
+					"cannot set embedded pointer to unexported %s", fieldType)}
+			}
+			if err := unmarshalStruct(log, nested, allocate(fieldValue)); err != nil {
+				return err
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+
+		key := prefix + fieldName(field, tag)
+		raw, ok := log[key]
+		if !ok || raw == nil {
+			continue
+		}
+		if err := unmarshalValue(key, raw, allocate(fieldValue)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasPrefix(log Log, prefix string) bool {
+	for key := range log {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// allocate follows pointers, allocating nil ones, down to a settable value.
+func allocate(value reflect.Value) reflect.Value {
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+		value = value.Elem()
+	}
+	return value
+}
+
+func unmarshalValue(key string, raw interface{}, value reflect.Value) error {
+	invalid := func() error {
+		return &ValidationError{Field: key,
+			Reason: fmt.Sprintf("cannot store %v in %s", raw, value.Type())}
+	}
+
+	if value.Type() == timeType {
+		var t time.Time
+		if str, ok := raw.(string); ok {
+			var err error
+			if t, err = time.Parse(time.RFC3339Nano, str); err != nil {
+				return invalid()
+			}
+		} else if seconds, ok := toFloat(raw); ok {
+			sec, frac := math.Modf(seconds)
+			t = time.Unix(int64(sec), int64(frac*1e9))
+		} else {
+			return invalid()
+		}
+		value.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if reflect.PtrTo(value.Type()).Implements(textUnmarshalerType) {
+		str, ok := raw.(string)
+		if !ok {
+			return invalid()
+		}
+		err := value.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(str))
+		if err != nil {
+			return &ValidationError{Field: key, Reason: err.Error()}
+		}
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		switch v := raw.(type) {
+		case string:
+			value.SetString(v)
+		case json.Number:
+			value.SetString(v.String())
+		default:
+			if f, ok := toFloat(raw); ok {
+				value.SetString(strconv.FormatFloat(f, 'f', -1, 64))
+			} else {
+				return invalid()
+			}
+		}
+	case reflect.Bool:
+		switch v := raw.(type) {
+		case bool:
+			value.SetBool(v)
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return invalid()
+			}
+			value.SetBool(b)
+		default:
+			return invalid()
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := toInt(raw)
+		if !ok || value.OverflowInt(n) {
+			return invalid()
+		}
+		value.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		n, ok := toUint(raw)
+		if !ok || value.OverflowUint(n) {
+			return invalid()
+		}
+		value.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, ok := toFloat(raw)
+		if !ok || value.OverflowFloat(f) {
+			return invalid()
+		}
+		value.SetFloat(f)
+	default:
+		return invalid()
+	}
+	return nil
+}
+
+// toInt converts a whole number decoded from JSON, or given in a Log, to
+// int64. Integers and json.Number are converted without going through
+// float64, which only holds integers up to 2^53 exactly.
+func toInt(raw interface{}) (int64, bool) {
+	switch v := raw.(type) {
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case int32:
+		return int64(v), true
+	case uint, uint64, uint32:
+		n, ok := toUint(v)
+		return int64(n), ok && n <= math.MaxInt64
+	case json.Number:
+		if n, err := strconv.ParseInt(v.String(), 10, 64); err == nil {
+			return n, true
+		}
+	case string:
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n, true
+		}
+	}
+	f, ok := toFloat(raw)
+	if !ok || f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+// toUint is like toInt for unsigned integers.
+func toUint(raw interface{}) (uint64, bool) {
+	switch v := raw.(type) {
+	case uint:
+		return uint64(v), true
+	case uint64:
+		return v, true
+	case uint32:
+		return uint64(v), true
+	case int, int64, int32:
+		n, ok := toInt(v)
+		return uint64(n), ok && n >= 0
+	case json.Number:
+		if n, err := strconv.ParseUint(v.String(), 10, 64); err == nil {
+			return n, true
+		}
+	case string:
+		if n, err := strconv.ParseUint(v, 10, 64); err == nil {
+			return n, true
+		}
+	}
+	f, ok := toFloat(raw)
+	if !ok || f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 {
+		return 0, false
+	}
+	return uint64(f), true
+}
+
+// toFloat converts a number decoded from JSON, or given in a Log, to
+// float64. Numeric strings are accepted too.
+func toFloat(raw interface{}) (float64, bool) {
+	switch v := raw.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
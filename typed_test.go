@@ -0,0 +1,246 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type typedHost struct {
+	Name string `zeus:"name"`
+	IP   net.IP `zeus:"ip,omitempty"`
+}
+
+type typedBase struct {
+	Service string `zeus:"service"`
+}
+
+type typedRequest struct {
+	typedBase
+	Path     string        `zeus:"path"`
+	Status   int           `zeus:"status"`
+	Bytes    uint32        `zeus:"bytes"`
+	Latency  float64       `zeus:"latency"`
+	Duration time.Duration `zeus:"duration_ns"`
+	Cached   bool          `zeus:"cached"`
+	Time     time.Time     `zeus:"timestamp,unix"`
+	Created  time.Time     `zeus:"created"`
+	Host     typedHost     `zeus:"host"`
+	User     *string       `zeus:"user,omitempty"`
+	Note     string        `zeus:"note,omitempty"`
+	Secret   string        `zeus:"-"`
+	Untagged string
+	internal string
+}
+
+func TestMarshalLog(t *testing.T) {
+	user := "alice"
+	request := typedRequest{
+		typedBase: typedBase{Service: "api"},
+		Path:      "/v1/logs",
+		Status:    201,
+		Bytes:     512,
+		Latency:   0.25,
+		Duration:  1500 * time.Millisecond,
+		Cached:    true,
+		Time:      time.Unix(1430000000, 500000000),
+		Created:   time.Date(2015, 4, 30, 1, 2, 3, 0, time.UTC),
+		Host:      typedHost{Name: "web1", IP: net.ParseIP("10.0.0.1")},
+		User:      &user,
+		Secret:    "hidden",
+		Untagged:  "kept",
+		internal:  "ignored",
+	}
+	log, err := MarshalLog(&request)
+	if err != nil {
+		t.Fatal("failed to marshal:", err)
+	}
+	expected := Log{
+		"service":     "api",
+		"path":        "/v1/logs",
+		"status":      int64(201),
+		"bytes":       uint64(512),
+		"latency":     0.25,
+		"duration_ns": int64(1500 * time.Millisecond),
+		"cached":      "true",
+		"timestamp":   1430000000.5,
+		"created":     "2015-04-30T01:02:03Z",
+		"host.name":   "web1",
+		"host.ip":     "10.0.0.1",
+		"user":        "alice",
+		"Untagged":    "kept",
+	}
+	if !reflect.DeepEqual(log, expected) {
+		t.Errorf("expected %v, got %v", expected, log)
+	}
+
+	// Round trip through JSON, as GetLogs does.
+	js, _ := json.Marshal(log)
+	var decodedLog Log
+	json.Unmarshal(js, &decodedLog)
+	var decoded typedRequest
+	if err := UnmarshalLog(decodedLog, &decoded); err != nil {
+		t.Fatal("failed to unmarshal:", err)
+	}
+	request.Secret, request.internal = "", ""
+	if !decoded.Time.Equal(request.Time) {
+		t.Errorf("expected time %v, got %v", request.Time, decoded.Time)
+	}
+	decoded.Time = request.Time
+	if !reflect.DeepEqual(decoded, request) {
+		t.Errorf("expected %+v, got %+v", request, decoded)
+	}
+}
+
+func TestMarshalLogErrors(t *testing.T) {
+	var validationErr *ValidationError
+	_, err := MarshalLog(struct {
+		Tags []string `zeus:"tags"`
+	}{})
+	if !errors.As(err, &validationErr) || validationErr.Field != "tags" {
+		t.Error("expected a validation error on tags, got", err)
+	}
+	if _, err := MarshalLog(42); err == nil {
+		t.Error("expected an error marshaling an int")
+	}
+	if _, err := MarshalLog((*typedRequest)(nil)); err == nil {
+		t.Error("expected an error marshaling nil")
+	}
+
+	node := &typedNode{Name: "a", Next: &typedNode{Name: "b"}}
+	node.Next.Next = node
+	_, err = MarshalLog(node)
+	if !errors.As(err, &validationErr) || validationErr.Field != "next.next" {
+		t.Error("expected a validation error on the cycle, got", err)
+	}
+	shared := &typedInner{A: "x"}
+	log, err := MarshalLog(struct {
+		First  *typedInner `zeus:"first"`
+		Second *typedInner `zeus:"second"`
+	}{shared, shared})
+	if err != nil || log["first.a"] != "x" || log["second.a"] != "x" {
+		t.Error("a pointer seen twice without a cycle should be kept:", log, err)
+	}
+
+	var request typedRequest
+	if err := UnmarshalLog(Log{}, request); err == nil {
+		t.Error("expected an error unmarshaling into a non-pointer")
+	}
+	for key, value := range map[string]interface{}{
+		"status":  1.5,
+		"bytes":   -1.0,
+		"cached":  "maybe",
+		"created": "yesterday",
+		"path":    true,
+	} {
+		err := UnmarshalLog(Log{key: value}, &request)
+		if !errors.As(err, &validationErr) || validationErr.Field != key {
+			t.Errorf("expected a validation error on %s, got %v", key, err)
+		}
+	}
+}
+
+type typedInner struct {
+	A string `zeus:"a"`
+}
+
+type typedNode struct {
+	Name string     `zeus:"name"`
+	Next *typedNode `zeus:"next,omitempty"`
+}
+
+func TestMarshalLogUnixTime(t *testing.T) {
+	for _, when := range []time.Time{{}, time.Date(2500, 1, 1, 0, 0, 0, 0, time.UTC)} {
+		log, err := MarshalLog(struct {
+			Time time.Time `zeus:"time,unix"`
+		}{when})
+		if err != nil || log["time"] != float64(when.Unix()) {
+			t.Errorf("%v: expected %d, got %v, %v", when, when.Unix(), log["time"], err)
+		}
+	}
+}
+
+func TestUnmarshalLogEdgeCases(t *testing.T) {
+	var embedded struct {
+		*typedInner
+		B string `zeus:"b"`
+	}
+	var validationErr *ValidationError
+	err := UnmarshalLog(Log{"a": "x", "b": "y"}, &embedded)
+	if !errors.As(err, &validationErr) || validationErr.Field != "typedInner" {
+		t.Error("expected a validation error on the embedded pointer, got", err)
+	}
+
+	var ids struct {
+		Signed   int64  `zeus:"signed"`
+		Unsigned uint64 `zeus:"unsigned"`
+	}
+	log := Log{"signed": json.Number("9007199254740993"),
+		"unsigned": json.Number("18446744073709551615")}
+	if err := UnmarshalLog(log, &ids); err != nil {
+		t.Fatal("failed to unmarshal:", err)
+	}
+	if ids.Signed != 9007199254740993 || ids.Unsigned != 18446744073709551615 {
+		t.Errorf("integers lost precision: %+v", ids)
+	}
+	if err := UnmarshalLog(Log{"signed": int64(-1 << 62)}, &ids); err != nil ||
+		ids.Signed != -1<<62 {
+		t.Error("failed to unmarshal an int64:", ids.Signed, err)
+	}
+	if err := UnmarshalLog(Log{"unsigned": -1}, &ids); err == nil {
+		t.Error("expected a negative unsigned to fail")
+	}
+}
+
+func TestPostTypedAndGetLogsAs(t *testing.T) {
+	server, sink := newLogSink()
+	defer server.Close()
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+	bucket := zeus.Bucket("org1/bucket1")
+
+	items := []typedHost{{Name: "web1"}, {Name: "web2", IP: net.ParseIP("::1")}}
+	successful, err := PostTyped(context.Background(), bucket, "hosts", items)
+	if err != nil || successful != 2 {
+		t.Fatal("failed to post:", successful, err)
+	}
+	if got := sink.logs["hosts"]; len(got) != 2 || got[1]["ip"] != "::1" {
+		t.Error("wrong logs posted:", got)
+	}
+
+	getServer := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"total": 7, "result": [{"name": "web1", "ip": "10.0.0.1"}, {"name": "web2"}]}`)
+		}))
+	defer getServer.Close()
+	zeus.ApiServ = getServer.URL
+	total, hosts, err := GetLogsAs[typedHost](context.Background(), bucket,
+		"hosts", "", "", 0, 0, 0, 0)
+	if err != nil {
+		t.Fatal("failed to get:", err)
+	}
+	if total != 7 || len(hosts) != 2 || hosts[0].Name != "web1" ||
+		!hosts[0].IP.Equal(net.ParseIP("10.0.0.1")) || hosts[1].IP != nil {
+		t.Error("wrong hosts:", total, hosts)
+	}
+}
@@ -16,10 +16,11 @@
 package zeus
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -81,6 +82,7 @@ func setAlertToUrlValues(alert Alert, data *url.Values) (errString string) {
 // Log contains properties of a log in a key-value way
 // Note that Zeus doesn't support nested json, the value has to be string or
 // number.
+// Use Flatten, or the WithFlatten option, to convert nested values.
 type Log map[string]interface{}
 
 // A collection of logs.
@@ -95,9 +97,40 @@ func (lst LogList) MarshalJSON() ([]byte, error) {
 
 // Metric contains two properties of a metric: timestamp of a metric, and
 // values of the metric point, which are different dimensions of a data point.
+// Missing, if set, marks the values of Point which are absent: they are left
+// out when sending, and their value in Point is ignored.
 type Metric struct {
 	Timestamp float64   `json:"timestamp,omitempty"`
 	Point     []float64 `json:"point"`
+	Missing   []bool    `json:"missing,omitempty"`
+}
+
+// Value returns the value of the column idx and whether it is present.
+func (metric Metric) Value(idx int) (float64, bool) {
+	if idx < 0 || idx >= len(metric.Point) || metric.IsMissing(idx) {
+		return 0, false
+	}
+	return metric.Point[idx], true
+}
+
+// IsMissing reports whether the value of the column idx is absent.
+func (metric Metric) IsMissing(idx int) bool {
+	return idx < len(metric.Missing) && metric.Missing[idx]
+}
+
+// SetMissing marks the value of the column idx as absent. It does nothing
+// when Point has no column idx.
+func (metric *Metric) SetMissing(idx int) {
+	if idx < 0 || idx >= len(metric.Point) {
+		return
+	}
+	if len(metric.Missing) < len(metric.Point) {
+		missing := make([]bool, len(metric.Point))
+		copy(missing, metric.Missing)
+		metric.Missing = missing
+	}
+	metric.Missing[idx] = true
+	metric.Point[idx] = 0
 }
 
 // A collection of metrics.
@@ -110,12 +143,15 @@ type MetricList struct {
 func (lst MetricList) MarshalJSON() ([]byte, error) {
 	js := []byte("[")
 	for i, m := range lst.Metrics {
-		if len(m.Point) != len(lst.Columns) {
+		if len(m.Point) != len(lst.Columns) ||
+			(m.Missing != nil && len(m.Missing) != len(lst.Columns)) {
 			return []byte{}, errors.New("field missing")
 		}
 		p := make(map[string]float64)
 		for idx, col := range lst.Columns {
-			p[col] = m.Point[idx]
+			if !m.IsMissing(idx) {
+				p[col] = m.Point[idx]
+			}
 		}
 		j, err := json.Marshal(p)
 		if err != nil {
@@ -135,45 +171,96 @@ func (lst MetricList) MarshalJSON() ([]byte, error) {
 	return js, nil
 }
 
-func (lst *MetricList) UnmarshalJSON(js []byte) (err error) {
-	if len(js) <= 2 {
-		return
+// UnmarshalJSON decodes a series as returned by GetMetricValues, either a
+// single object or an array of them, of which only the first is kept. The
+// "time" column, if any, becomes the Timestamp of each Metric. Null values
+// and values missing at the end of a point are marked in Missing.
+func (lst *MetricList) UnmarshalJSON(js []byte) error {
+	js = bytes.TrimSpace(js)
+	if len(js) > 0 && js[0] == '[' {
+		var series []json.RawMessage
+		if err := json.Unmarshal(js, &series); err != nil {
+			return err
+		}
+		if len(series) == 0 {
+			return nil
+		}
+		js = series[0]
 	}
-	var l []map[string]interface{}
-	if err := json.Unmarshal(js, &l); err != nil {
-		return err
+	if bytes.Equal(js, []byte("null")) {
+		return nil
 	}
-	l0 := l[0]
-	if _, ok := l0["name"]; ok == true {
-		lst.Name = l0["name"].(string)
+
+	var series struct {
+		Name    string       `json:"name"`
+		Columns []string     `json:"columns"`
+		Points  [][]*float64 `json:"points"`
+	}
+	if err := json.Unmarshal(js, &series); err != nil {
+		return fmt.Errorf("invalid metric series: %v", err)
 	}
-	if _, ok := l0["columns"]; ok == true {
-		cols := l0["columns"].([]interface{})
-		lst.Columns = make([]string, 0, len(cols))
-		for _, val := range cols[1:] {
-			lst.Columns = append(lst.Columns, val.(string))
+	timeCol := -1
+	columns := make([]string, 0, len(series.Columns))
+	for idx, col := range series.Columns {
+		if col == "time" && timeCol < 0 {
+			timeCol = idx
+		} else {
+			columns = append(columns, col)
 		}
 	}
-	if _, ok := l0["points"]; ok == true {
-		points := l0["points"].([]interface{})
-		lst.Metrics = make([]Metric, 0, len(points))
-		for _, point := range points {
-			p := point.([]interface{})
-			m := Metric{Timestamp: p[0].(float64)}
-			m.Point = make([]float64, 0, len(p)-1)
-			for _, val := range p[1:] {
-				m.Point = append(m.Point, val.(float64))
+
+	metrics := make([]Metric, 0, len(series.Points))
+	for i, point := range series.Points {
+		if len(point) > len(series.Columns) {
+			return fmt.Errorf("invalid metric series %q: point %d has %d values for %d columns",
+				series.Name, i, len(point), len(series.Columns))
+		}
+		m := Metric{Point: make([]float64, len(columns))}
+		col := 0
+		for idx := range series.Columns {
+			var val *float64
+			if idx < len(point) {
+				val = point[idx]
 			}
-			lst.Metrics = append(lst.Metrics, m)
+			if idx == timeCol {
+				if val != nil {
+					m.Timestamp = *val
+				}
+				continue
+			}
+			if val != nil {
+				m.Point[col] = *val
+			} else {
+				m.SetMissing(col)
+			}
+			col++
 		}
+		metrics = append(metrics, m)
 	}
-	return
+
+	lst.Name = series.Name
+	lst.Columns = columns
+	lst.Metrics = metrics
+	return nil
 }
 
 // Zeus implements functions to send/receive log, send/receive metrics.
-// Constructing Zeus requires URL of Zeus rest api and user token.
+// Constructing Zeus requires URL of Zeus rest api and user token, either as a
+// struct literal or with NewClient, which also accepts options.
+// OrganizationAndBucket is the bucket of the calls made on Zeus itself, or
+// the default bucket set with WithBucket when it is empty; the chained
+// zeus.bucket() API sets it on a copy. Use Bucket to get a handle on another
+// bucket.
 type Zeus struct {
 	ApiServ, OrganizationAndBucket, Token string
+
+	client        *http.Client
+	userAgent     string
+	header        http.Header
+	defaultBucket string
+	retry         *RetryPolicy
+	partial       *PartialFailurePolicy
+	flatten       *FlattenConfig
 }
 
 type postResponse struct {
@@ -186,170 +273,143 @@ func buildUrl(urls ...string) string {
 	return strings.Join(urls, "/") + "/"
 }
 
-func (zeus *Zeus) bucket(organization_and_bucket string) *Zeus {
-	zeus.OrganizationAndBucket = organization_and_bucket
-	return zeus
-}
-
-func (zeus *Zeus) request(method, urlStr string, data *url.Values) (
-	responseBody []byte, responseStatus int, err error) {
-	if zeus.OrganizationAndBucket == "" {
-		fmt.Println("Error: Please set bucket's name. ex) zeus.bucket(\"org1/bucket1\").GetLogs()")
-		return []byte{}, 0, err
-	}
-	organizationAndBucket := zeus.OrganizationAndBucket
-	zeus.OrganizationAndBucket = ""
-
-	if data == nil {
-		data = &url.Values{}
-	}
-	body := strings.NewReader(data.Encode())
-
-	var request *http.Request
-	if method == "GET" {
-		request, err = http.NewRequest("GET", urlStr+"?"+data.Encode(), nil)
-	} else if method == "POST" {
-		request, err = http.NewRequest("POST", urlStr, body)
-	} else if method == "PUT" {
-		request, err = http.NewRequest("PUT", urlStr, body)
-		request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	} else if method == "DELETE" {
-		request, err = http.NewRequest("DELETE", urlStr, body)
-	}
-	if err != nil {
-		return []byte{}, 0, err
-	}
-	request.Header.Add("Authorization", "Bearer "+zeus.Token)
-	request.Header.Add("Bucket-Name", organizationAndBucket)
-
-	response, err := http.DefaultClient.Do(request)
-	if err != nil {
-		return []byte{}, 0, err
-	}
-
-	responseBody, err = ioutil.ReadAll(response.Body)
-	if err != nil {
-		return []byte{}, 0, err
-	}
-
-	responseStatus = response.StatusCode
-	response.Body.Close()
-	return
-}
-
 // PostAlert sends a alert.
 // It returns number of successfully sent logs or an error.
-func (zeus *Zeus) PostAlert(alert Alert) (successful int, err error) {
-	if len(zeus.Token) == 0 {
+func (bucket *Bucket) PostAlert(alert Alert) (successful int, err error) {
+	return bucket.PostAlertCtx(context.Background(), alert)
+}
+
+// PostAlertCtx is like PostAlert but carries ctx into the HTTP request.
+func (bucket *Bucket) PostAlertCtx(ctx context.Context, alert Alert) (
+	successful int, err error) {
+	if len(bucket.zeus.Token) == 0 {
 		return 0, errors.New("API token is empty")
 	}
-	urlStr := buildUrl(zeus.ApiServ, "alerts", zeus.Token)
+	urlStr := buildUrl(bucket.zeus.ApiServ, "alerts", bucket.zeus.Token)
 
 	data := make(url.Values)
 	errString := setAlertToUrlValues(alert, &data)
 	if errString != "" {
-		return 0, err
+		return 0, errors.New(errString)
 	}
 
-	_, status, err := zeus.request("POST", urlStr, &data)
+	body, status, err := bucket.request(ctx, "POST", urlStr, &data)
 	if err != nil {
 		return 0, err
 	}
-	if status == 201 {
-		successful = 1
+	if status != 201 {
+		return 0, newAPIError("POST", urlStr, bucket.zeus.Token, status, body)
 	}
-
-	return
+	return 1, nil
 }
 
 // GetAlerts returns list of alert
-func (zeus *Zeus) GetAlerts() (total int, alerts []Alert, err error) {
-	if len(zeus.Token) == 0 {
+func (bucket *Bucket) GetAlerts() (total int, alerts []Alert, err error) {
+	return bucket.GetAlertsCtx(context.Background())
+}
+
+// GetAlertsCtx is like GetAlerts but carries ctx into the HTTP request.
+func (bucket *Bucket) GetAlertsCtx(ctx context.Context) (total int,
+	alerts []Alert, err error) {
+	if len(bucket.zeus.Token) == 0 {
 		return 0, []Alert{}, errors.New("API token is empty")
 	}
-	urlStr := buildUrl(zeus.ApiServ, "alerts", zeus.Token)
+	urlStr := buildUrl(bucket.zeus.ApiServ, "alerts", bucket.zeus.Token)
 	data := make(url.Values)
 
-	body, status, err := zeus.request("GET", urlStr, &data)
+	body, status, err := bucket.request(ctx, "GET", urlStr, &data)
 	if err != nil {
 		return 0, []Alert{}, err
 	}
 
-	if status == 200 {
-		if err := json.Unmarshal(body, &alerts); err != nil {
-			return 0, []Alert{}, err
-		}
-		total = len(alerts)
-	} else if status == 400 {
-		return 0, []Alert{}, errors.New("Bad request")
+	if status != 200 {
+		return 0, []Alert{}, newAPIError("GET", urlStr, bucket.zeus.Token, status, body)
+	}
+	if err := json.Unmarshal(body, &alerts); err != nil {
+		return 0, []Alert{}, err
 	}
+	total = len(alerts)
 	return
 }
 
 // PutAlert update alert which is specified with id
-func (zeus *Zeus) PutAlert(id int64, alert Alert) (successful int, err error) {
-	if len(zeus.Token) == 0 {
+func (bucket *Bucket) PutAlert(id int64, alert Alert) (successful int, err error) {
+	return bucket.PutAlertCtx(context.Background(), id, alert)
+}
+
+// PutAlertCtx is like PutAlert but carries ctx into the HTTP request.
+func (bucket *Bucket) PutAlertCtx(ctx context.Context, id int64, alert Alert) (
+	successful int, err error) {
+	if len(bucket.zeus.Token) == 0 {
 		return 0, errors.New("API token is empty")
 	}
-	urlStr := buildUrl(zeus.ApiServ, "alerts", zeus.Token, strconv.FormatInt(id, 10))
+	urlStr := buildUrl(bucket.zeus.ApiServ, "alerts", bucket.zeus.Token, strconv.FormatInt(id, 10))
 
 	data := make(url.Values)
 	errString := setAlertToUrlValues(alert, &data)
 	if errString != "" {
-		return 0, err
+		return 0, errors.New(errString)
 	}
 
-	_, status, err := zeus.request("PUT", urlStr, &data)
+	body, status, err := bucket.request(ctx, "PUT", urlStr, &data)
 	if err != nil {
 		return 0, err
 	}
-	if status == 200 {
-		successful = 1
+	if status != 200 {
+		return 0, newAPIError("PUT", urlStr, bucket.zeus.Token, status, body)
 	}
-
-	return
+	return 1, nil
 }
 
 // GetAlert returns a alert by id
-func (zeus *Zeus) GetAlert(id int64) (alert Alert, err error) {
-	if len(zeus.Token) == 0 {
+func (bucket *Bucket) GetAlert(id int64) (alert Alert, err error) {
+	return bucket.GetAlertCtx(context.Background(), id)
+}
+
+// GetAlertCtx is like GetAlert but carries ctx into the HTTP request.
+func (bucket *Bucket) GetAlertCtx(ctx context.Context, id int64) (alert Alert, err error) {
+	if len(bucket.zeus.Token) == 0 {
 		return Alert{}, errors.New("API token is empty")
 	}
-	urlStr := buildUrl(zeus.ApiServ, "alerts", zeus.Token, strconv.FormatInt(id, 10))
+	urlStr := buildUrl(bucket.zeus.ApiServ, "alerts", bucket.zeus.Token, strconv.FormatInt(id, 10))
 
 	data := make(url.Values)
-	body, status, err := zeus.request("GET", urlStr, &data)
+	body, status, err := bucket.request(ctx, "GET", urlStr, &data)
 	if err != nil {
 		return Alert{}, err
 	}
 
-	if status == 200 {
-		if err := json.Unmarshal(body, &alert); err != nil {
-			return Alert{}, err
-		}
-	} else if status == 400 {
-		return Alert{}, errors.New("Bad request")
+	if status != 200 {
+		return Alert{}, newAPIError("GET", urlStr, bucket.zeus.Token, status, body)
+	}
+	if err := json.Unmarshal(body, &alert); err != nil {
+		return Alert{}, err
 	}
 	return
 }
 
 // DeleteAlert delete a alert which is specified with id
-func (zeus *Zeus) DeleteAlert(id int64) (successful int, err error) {
-	if len(zeus.Token) == 0 {
+func (bucket *Bucket) DeleteAlert(id int64) (successful int, err error) {
+	return bucket.DeleteAlertCtx(context.Background(), id)
+}
+
+// DeleteAlertCtx is like DeleteAlert but carries ctx into the HTTP request.
+func (bucket *Bucket) DeleteAlertCtx(ctx context.Context, id int64) (
+	successful int, err error) {
+	if len(bucket.zeus.Token) == 0 {
 		return 0, errors.New("API token is empty")
 	}
-	urlStr := buildUrl(zeus.ApiServ, "alerts", zeus.Token, strconv.FormatInt(id, 10))
+	urlStr := buildUrl(bucket.zeus.ApiServ, "alerts", bucket.zeus.Token, strconv.FormatInt(id, 10))
 	data := make(url.Values)
 
-	_, status, err := zeus.request("DELETE", urlStr, &data)
+	body, status, err := bucket.request(ctx, "DELETE", urlStr, &data)
 	if err != nil {
 		return 0, err
 	}
-	if status == 204 {
-		successful = 1
+	if status != 204 {
+		return 0, newAPIError("DELETE", urlStr, bucket.zeus.Token, status, body)
 	}
-
-	return
+	return 1, nil
 }
 
 // GetLogs returns a list of logs that math given constrains. logName is the
@@ -359,12 +419,19 @@ func (zeus *Zeus) DeleteAlert(id int64) (successful int, err error) {
 // If the returned  total larger than the length of return log list, don't
 // worry, limit(10 by default) controls the up limit of number of logs
 // returned. Please use offset and limit to get the rest logs.
-func (zeus *Zeus) GetLogs(logName, field, pattern string, from, to int64,
+func (bucket *Bucket) GetLogs(logName, field, pattern string, from, to int64,
 	offset, limit int) (total int, logs LogList, err error) {
-	if len(zeus.Token) == 0 {
+	return bucket.GetLogsCtx(context.Background(), logName, field, pattern,
+		from, to, offset, limit)
+}
+
+// GetLogsCtx is like GetLogs but carries ctx into the HTTP request.
+func (bucket *Bucket) GetLogsCtx(ctx context.Context, logName, field,
+	pattern string, from, to int64, offset, limit int) (total int, logs LogList, err error) {
+	if len(bucket.zeus.Token) == 0 {
 		return 0, LogList{}, errors.New("API token is empty")
 	}
-	urlStr := buildUrl(zeus.ApiServ, "logs", zeus.Token)
+	urlStr := buildUrl(bucket.zeus.ApiServ, "logs", bucket.zeus.Token)
 	data := make(url.Values)
 	if len(logName) > 0 {
 		data.Add("log_name", logName)
@@ -390,106 +457,142 @@ func (zeus *Zeus) GetLogs(logName, field, pattern string, from, to int64,
 		data.Add("limit", strconv.Itoa(limit))
 	}
 
-	body, status, err := zeus.request("GET", urlStr, &data)
+	body, status, err := bucket.request(ctx, "GET", urlStr, &data)
 	if err != nil {
 		return 0, LogList{}, err
 	}
 
-	if status == 200 {
-		type Resp struct {
-			Total  int   `json:"total"`
-			Result []Log `json:"result"`
-		}
-		var resp Resp
-		if err := json.Unmarshal(body, &resp); err != nil {
-			return 0, LogList{}, err
-		}
-		total = resp.Total
-		logs.Name = logName
-		logs.Logs = resp.Result
-	} else if status == 400 {
-		return 0, LogList{}, errors.New("Bad request")
+	if status != 200 {
+		return 0, LogList{}, newAPIError("GET", urlStr, bucket.zeus.Token, status, body)
+	}
+	type Resp struct {
+		Total  int   `json:"total"`
+		Result []Log `json:"result"`
 	}
+	var resp Resp
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return 0, LogList{}, err
+	}
+	total = resp.Total
+	logs.Name = logName
+	logs.Logs = resp.Result
 	return
 }
 
 // PostLogs sends a list of logs under given log name. It returns number of
-// successfully sent logs or an error.
-func (zeus *Zeus) PostLogs(logs LogList) (successful int, err error) {
+// successfully sent logs or an error. Use PostLogsResult to learn about logs
+// the server rejected.
+func (bucket *Bucket) PostLogs(logs LogList) (successful int, err error) {
+	return bucket.PostLogsCtx(context.Background(), logs)
+}
+
+// PostLogsCtx is like PostLogs but carries ctx into the HTTP request.
+func (bucket *Bucket) PostLogsCtx(ctx context.Context, logs LogList) (
+	successful int, err error) {
+	result, err := bucket.PostLogsResult(ctx, logs)
+	return result.Successful, err
+}
+
+// postLogs sends logs once and returns what the server reported.
+func (bucket *Bucket) postLogs(ctx context.Context, logs LogList) (
+	result PostResult, err error) {
 	if len(logs.Name) == 0 || len(logs.Logs) == 0 {
-		return 0, errors.New("logs is empty")
+		return PostResult{}, errors.New("logs is empty")
 	}
-	if len(zeus.Token) == 0 {
-		return 0, errors.New("API token is empty")
+	if len(bucket.zeus.Token) == 0 {
+		return PostResult{}, errors.New("API token is empty")
 	}
-	urlStr := buildUrl(zeus.ApiServ, "logs", zeus.Token, logs.Name)
+	urlStr := buildUrl(bucket.zeus.ApiServ, "logs", bucket.zeus.Token, logs.Name)
 
+	if bucket.zeus.flatten != nil {
+		if logs, err = logs.Flatten(*bucket.zeus.flatten); err != nil {
+			return PostResult{}, err
+		}
+	}
 	jsonStr, err := json.Marshal(logs)
 	if err != nil {
-		return 0, err
+		return PostResult{}, err
 	}
 	data := url.Values{"logs": {string(jsonStr)}}
 
-	body, status, err := zeus.request("POST", urlStr, &data)
+	body, status, err := bucket.request(ctx, "POST", urlStr, &data)
 	if err != nil {
-		return 0, err
+		return PostResult{}, err
+	}
+	if status != 200 {
+		return PostResult{}, newAPIError("POST", urlStr, bucket.zeus.Token,
+			status, body)
 	}
-
 	var resp postResponse
 	if err := json.Unmarshal(body, &resp); err != nil {
-		return 0, err
-	}
-	if status == 200 {
-		successful = resp.Successful
-	} else {
-		return 0, errors.New(resp.Error)
+		return PostResult{}, err
 	}
-	return
+	return resp.result(len(logs.Logs)), nil
 }
 
-// PostMetric sends a list of points under the given metricName.
-func (zeus *Zeus) PostMetrics(metrics MetricList) (
+// PostMetric sends a list of points under the given metricName. Use
+// PostMetricsResult to learn about points the server rejected.
+func (bucket *Bucket) PostMetrics(metrics MetricList) (
 	successful int, err error) {
+	return bucket.PostMetricsCtx(context.Background(), metrics)
+}
+
+// PostMetricsCtx is like PostMetrics but carries ctx into the HTTP request.
+func (bucket *Bucket) PostMetricsCtx(ctx context.Context, metrics MetricList) (
+	successful int, err error) {
+	result, err := bucket.PostMetricsResult(ctx, metrics)
+	return result.Successful, err
+}
+
+// postMetrics sends metrics once and returns what the server reported.
+func (bucket *Bucket) postMetrics(ctx context.Context, metrics MetricList) (
+	result PostResult, err error) {
 	if len(metrics.Name) == 0 ||
 		len(metrics.Columns) == 0 ||
 		len(metrics.Metrics) == 0 {
-		return 0, errors.New("metrics is empty")
+		return PostResult{}, errors.New("metrics is empty")
 	}
-	if len(zeus.Token) == 0 {
-		return 0, errors.New("API token is empty")
+	if len(bucket.zeus.Token) == 0 {
+		return PostResult{}, errors.New("API token is empty")
 	}
-	urlStr := buildUrl(zeus.ApiServ, "metrics", zeus.Token, metrics.Name)
+	urlStr := buildUrl(bucket.zeus.ApiServ, "metrics", bucket.zeus.Token, metrics.Name)
 
 	jsonStr, err := json.Marshal(metrics)
 	if err != nil {
-		return 0, err
+		return PostResult{}, err
 	}
 	data := url.Values{"metrics": {string(jsonStr)}}
 
-	body, status, err := zeus.request("POST", urlStr, &data)
+	body, status, err := bucket.request(ctx, "POST", urlStr, &data)
 	if err != nil {
-		return 0, err
+		return PostResult{}, err
+	}
+	if status != 200 {
+		return PostResult{}, newAPIError("POST", urlStr, bucket.zeus.Token,
+			status, body)
 	}
 	var resp postResponse
 	if err := json.Unmarshal(body, &resp); err != nil {
-		return 0, err
+		return PostResult{}, err
 	}
-	if status == 200 {
-		successful = resp.Successful
-	} else {
-		return 0, errors.New(resp.Error)
-	}
-	return
+	return resp.result(len(metrics.Metrics)), nil
 }
 
 // GetMetricNames returns less than limit of metric names that match regular
 // expression metricName.
-func (zeus *Zeus) GetMetricNames(metricName string, offset, limit int) (
+func (bucket *Bucket) GetMetricNames(metricName string, offset, limit int) (
 	names []string, err error) {
-	if len(zeus.Token) == 0 {
+	return bucket.GetMetricNamesCtx(context.Background(), metricName, offset, limit)
+}
+
+// GetMetricNamesCtx is like GetMetricNames but carries ctx into the HTTP
+// request.
+func (bucket *Bucket) GetMetricNamesCtx(ctx context.Context, metricName string,
+	offset, limit int) (names []string, err error) {
+	if len(bucket.zeus.Token) == 0 {
 		return []string{}, errors.New("API token is empty")
 	}
-	urlStr := buildUrl(zeus.ApiServ, "metrics", zeus.Token, "_names")
+	urlStr := buildUrl(bucket.zeus.ApiServ, "metrics", bucket.zeus.Token, "_names")
 	data := make(url.Values)
 	if len(metricName) > 0 {
 		data.Add("metric_name", metricName)
@@ -501,14 +604,15 @@ func (zeus *Zeus) GetMetricNames(metricName string, offset, limit int) (
 		data.Add("limit", strconv.Itoa(limit))
 	}
 
-	body, status, err := zeus.request("GET", urlStr, &data)
+	body, status, err := bucket.request(ctx, "GET", urlStr, &data)
 	if err != nil {
 		return []string{}, err
 	}
-	if status == 200 {
-		if err := json.Unmarshal(body, &names); err != nil {
-			return []string{}, err
-		}
+	if status != 200 {
+		return []string{}, newAPIError("GET", urlStr, bucket.zeus.Token, status, body)
+	}
+	if err := json.Unmarshal(body, &names); err != nil {
+		return []string{}, err
 	}
 	return
 }
@@ -518,14 +622,45 @@ func (zeus *Zeus) GetMetricNames(metricName string, offset, limit int) (
 // than to. Values can be aggreated by a function(count, min, max, sum, mean,
 // mode, median). Values can also be gouped by a group_interval or filtered by
 // filter_condition(value > 0), if value for one field is missing, it'll be
-// set to 0.
-func (zeus *Zeus) GetMetricValues(metricName string, aggregator string,
+// marked in Metric.Missing.
+func (bucket *Bucket) GetMetricValues(metricName string, aggregator string,
 	aggregatorCol, groupInterval string, from, to float64, filterCondition string,
 	offset, limit int) (metrics MetricList, err error) {
-	if len(zeus.Token) == 0 {
-		return MetricList{}, errors.New("API token is empty")
+	return bucket.GetMetricValuesCtx(context.Background(), metricName, aggregator,
+		aggregatorCol, groupInterval, from, to, filterCondition, offset, limit)
+}
+
+// GetMetricValuesCtx is like GetMetricValues but carries ctx into the HTTP
+// request.
+func (bucket *Bucket) GetMetricValuesCtx(ctx context.Context, metricName string,
+	aggregator string, aggregatorCol, groupInterval string, from, to float64,
+	filterCondition string, offset, limit int) (metrics MetricList, err error) {
+	series, err := bucket.GetMetricSeriesCtx(ctx, metricName, aggregator,
+		aggregatorCol, groupInterval, from, to, filterCondition, offset, limit)
+	if err != nil || len(series) == 0 {
+		return MetricList{}, err
+	}
+	return series[0], nil
+}
+
+// GetMetricSeries is like GetMetricValues but returns every series of the
+// response, such as the groups of a grouped query, instead of the first.
+func (bucket *Bucket) GetMetricSeries(metricName string, aggregator string,
+	aggregatorCol, groupInterval string, from, to float64, filterCondition string,
+	offset, limit int) ([]MetricList, error) {
+	return bucket.GetMetricSeriesCtx(context.Background(), metricName, aggregator,
+		aggregatorCol, groupInterval, from, to, filterCondition, offset, limit)
+}
+
+// GetMetricSeriesCtx is like GetMetricSeries but carries ctx into the HTTP
+// request.
+func (bucket *Bucket) GetMetricSeriesCtx(ctx context.Context, metricName string,
+	aggregator string, aggregatorCol, groupInterval string, from, to float64,
+	filterCondition string, offset, limit int) (series []MetricList, err error) {
+	if len(bucket.zeus.Token) == 0 {
+		return nil, errors.New("API token is empty")
 	}
-	urlStr := buildUrl(zeus.ApiServ, "metrics", zeus.Token, "_values")
+	urlStr := buildUrl(bucket.zeus.ApiServ, "metrics", bucket.zeus.Token, "_values")
 	data := make(url.Values)
 	if len(metricName) > 0 {
 		data.Add("metric_name", metricName)
@@ -549,94 +684,112 @@ func (zeus *Zeus) GetMetricValues(metricName string, aggregator string,
 		data.Add("filter_condition", filterCondition)
 	}
 	if offset > 0 {
-		data.Add("offset", strconv.Itoa(limit))
+		data.Add("offset", strconv.Itoa(offset))
 	}
 	if limit > 0 {
 		data.Add("limit", strconv.Itoa(limit))
 	}
 
-	body, status, err := zeus.request("GET", urlStr, &data)
+	body, status, err := bucket.request(ctx, "GET", urlStr, &data)
 	if err != nil {
-		return MetricList{}, err
+		return nil, err
 	}
-	if status == 200 {
-		if err := json.Unmarshal(body, &metrics); err != nil {
-			return MetricList{}, err
-		}
+	if status != 200 {
+		return nil, newAPIError("GET", urlStr, bucket.zeus.Token, status, body)
+	}
+	if err := json.Unmarshal(body, &series); err != nil {
+		return nil, err
 	}
 	return
 }
 
 // DeleteMetrics deletes one entire series by the given metric name.
-func (zeus *Zeus) DeleteMetrics(metricName string) (bool, error) {
+func (bucket *Bucket) DeleteMetrics(metricName string) (bool, error) {
+	return bucket.DeleteMetricsCtx(context.Background(), metricName)
+}
+
+// DeleteMetricsCtx is like DeleteMetrics but carries ctx into the HTTP request.
+func (bucket *Bucket) DeleteMetricsCtx(ctx context.Context, metricName string) (bool, error) {
 	if len(metricName) == 0 {
 		return false, errors.New("metric_name is required")
 	}
-	if len(zeus.Token) == 0 {
+	if len(bucket.zeus.Token) == 0 {
 		return false, errors.New("API token is empty")
 	}
-	urlStr := buildUrl(zeus.ApiServ, "metrics", zeus.Token, metricName)
+	urlStr := buildUrl(bucket.zeus.ApiServ, "metrics", bucket.zeus.Token, metricName)
 	data := url.Values{}
 
-	body, status, err := zeus.request("DELETE", urlStr, &data)
+	body, status, err := bucket.request(ctx, "DELETE", urlStr, &data)
 	if err != nil {
 		return false, err
 	}
 
-	if status == 200 {
-		var resp []string
-		if err := json.Unmarshal(body, &resp); err != nil {
-			return false, err
-		}
-		if resp[0] == "Metric deletion successful" {
-			return true, nil
-		}
+	if status != 200 {
+		return false, newAPIError("DELETE", urlStr, bucket.zeus.Token, status, body)
 	}
-	return false, nil
+	var resp []string
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return false, err
+	}
+	if len(resp) == 0 || resp[0] != "Metric deletion successful" {
+		return false, newAPIError("DELETE", urlStr, bucket.zeus.Token, status, body)
+	}
+	return true, nil
 }
 
 // GetTrigalert returns a trigalert
-func (zeus *Zeus) GetTrigalert() (trigalert map[string]interface{}, err error) {
-	if len(zeus.Token) == 0 {
+func (bucket *Bucket) GetTrigalert() (trigalert map[string]interface{}, err error) {
+	return bucket.GetTrigalertCtx(context.Background())
+}
+
+// GetTrigalertCtx is like GetTrigalert but carries ctx into the HTTP request.
+func (bucket *Bucket) GetTrigalertCtx(ctx context.Context) (
+	trigalert map[string]interface{}, err error) {
+	if len(bucket.zeus.Token) == 0 {
 		return map[string]interface{}{}, errors.New("API token is empty")
 	}
-	urlStr := buildUrl(zeus.ApiServ, "trigalerts", zeus.Token)
+	urlStr := buildUrl(bucket.zeus.ApiServ, "trigalerts", bucket.zeus.Token)
 
 	data := make(url.Values)
-	body, status, err := zeus.request("GET", urlStr, &data)
+	body, status, err := bucket.request(ctx, "GET", urlStr, &data)
 	if err != nil {
 		return map[string]interface{}{}, err
 	}
 
-	if status == 200 {
-		if err := json.Unmarshal(body, &trigalert); err != nil {
-			return map[string]interface{}{}, err
-		}
-	} else if status == 400 {
-		return map[string]interface{}{}, errors.New("Bad request")
+	if status != 200 {
+		return map[string]interface{}{}, newAPIError("GET", urlStr, bucket.zeus.Token, status, body)
+	}
+	if err := json.Unmarshal(body, &trigalert); err != nil {
+		return map[string]interface{}{}, err
 	}
 	return
 }
 
 // GetTrigalert returns a trigalert of last24
-func (zeus *Zeus) GetTrigalertLast24() (trigalert map[string]interface{}, err error) {
-	if len(zeus.Token) == 0 {
+func (bucket *Bucket) GetTrigalertLast24() (trigalert map[string]interface{}, err error) {
+	return bucket.GetTrigalertLast24Ctx(context.Background())
+}
+
+// GetTrigalertLast24Ctx is like GetTrigalertLast24 but carries ctx into the
+// HTTP request.
+func (bucket *Bucket) GetTrigalertLast24Ctx(ctx context.Context) (
+	trigalert map[string]interface{}, err error) {
+	if len(bucket.zeus.Token) == 0 {
 		return map[string]interface{}{}, errors.New("API token is empty")
 	}
-	urlStr := buildUrl(zeus.ApiServ, "trigalerts", zeus.Token, "last24")
+	urlStr := buildUrl(bucket.zeus.ApiServ, "trigalerts", bucket.zeus.Token, "last24")
 
 	data := make(url.Values)
-	body, status, err := zeus.request("GET", urlStr, &data)
+	body, status, err := bucket.request(ctx, "GET", urlStr, &data)
 	if err != nil {
 		return map[string]interface{}{}, err
 	}
 
-	if status == 200 {
-		if err := json.Unmarshal(body, &trigalert); err != nil {
-			return map[string]interface{}{}, err
-		}
-	} else if status == 400 {
-		return map[string]interface{}{}, errors.New("Bad request")
+	if status != 200 {
+		return map[string]interface{}{}, newAPIError("GET", urlStr, bucket.zeus.Token, status, body)
+	}
+	if err := json.Unmarshal(body, &trigalert); err != nil {
+		return map[string]interface{}{}, err
 	}
 	return
 }
@@ -15,13 +15,16 @@
 package zeus
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
 	"regexp"
 	"strconv"
 	"testing"
@@ -114,7 +117,7 @@ func TestPostAlert(t *testing.T) {
 	zeus.Token = token
 
 	_, err = zeus.bucket(bucket_name).PostAlert(Alert{})
-	if err != nil {
+	if err == nil {
 		t.Error("should fail on empty alert")
 	}
 
@@ -193,7 +196,7 @@ func TestPutAlert(t *testing.T) {
 	zeus.Token = token
 
 	_, err = zeus.bucket(bucket_name).PutAlert(1, Alert{})
-	if err != nil {
+	if err == nil {
 		t.Error("should fail on empty alert")
 	}
 
@@ -457,6 +460,126 @@ func TestGetMetricValues(t *testing.T) {
 	}
 }
 
+func TestMetricListUnmarshalJSON(t *testing.T) {
+	var metrics MetricList
+	js := `{"name": "cpu", "columns": ["host_id", "time", "load"],
+		"points": [[1, 1430355869.5, null], [2, null], [3]]}`
+	if err := json.Unmarshal([]byte(js), &metrics); err != nil {
+		t.Fatal("failed to unmarshal:", err)
+	}
+	expected := MetricList{
+		Name:    "cpu",
+		Columns: []string{"host_id", "load"},
+		Metrics: []Metric{
+			{Timestamp: 1430355869.5, Point: []float64{1, 0}, Missing: []bool{false, true}},
+			{Point: []float64{2, 0}, Missing: []bool{false, true}},
+			{Point: []float64{3, 0}, Missing: []bool{false, true}},
+		},
+	}
+	if !reflect.DeepEqual(metrics, expected) {
+		t.Errorf("expected %#v, got %#v", expected, metrics)
+	}
+	if _, ok := metrics.Metrics[0].Value(1); ok {
+		t.Error("null value should be missing")
+	}
+	if value, ok := metrics.Metrics[0].Value(0); !ok || value != 1 {
+		t.Error("expected value 1, got", value, ok)
+	}
+
+	for _, js := range []string{
+		`[]`, `null`, `[null]`,
+	} {
+		metrics = MetricList{}
+		if err := json.Unmarshal([]byte(js), &metrics); err != nil || metrics.Name != "" {
+			t.Errorf("%s: expected an empty list, got %#v, %v", js, metrics, err)
+		}
+	}
+
+	for _, js := range []string{
+		`[{"name": 1}]`,
+		`[{"columns": "time"}]`,
+		`[{"columns": ["time"], "points": [[1, 2]]}]`,
+		`[{"columns": ["time", "a"], "points": [[1, "2"]]}]`,
+		`[{"points": [1]}]`,
+		`["series"]`,
+		`{`,
+	} {
+		if err := json.Unmarshal([]byte(js), &metrics); err == nil {
+			t.Errorf("%s: expected an error", js)
+		}
+	}
+}
+
+func TestMetricListMarshalMissing(t *testing.T) {
+	metric := Metric{Timestamp: 1430355869, Point: []float64{1, 2, 0}}
+	metric.SetMissing(1)
+	metric.SetMissing(3)
+	metric.SetMissing(-1)
+	if len(metric.Missing) != 3 || !metric.IsMissing(1) || metric.IsMissing(3) {
+		t.Error("wrong missing values:", metric.Missing)
+	}
+	metrics := MetricList{
+		Name:    "cpu",
+		Columns: []string{"user", "system", "idle"},
+		Metrics: []Metric{metric},
+	}
+	js, err := json.Marshal(metrics)
+	if err != nil {
+		t.Fatal("failed to marshal:", err)
+	}
+	if string(js) != `[{"point":{"idle":0,"user":1},"timestamp":1430355869.000}]` {
+		t.Error("missing value should be left out, got", string(js))
+	}
+
+	metrics.Metrics[0].Missing = []bool{true}
+	if _, err := json.Marshal(metrics); err == nil {
+		t.Error("should fail on a mask which doesn't match the columns")
+	}
+}
+
+func TestGetMetricSeries(t *testing.T) {
+	retBody := `[{"name": "cpu", "columns": ["time", "max"], "points": [[1, 10]]},
+		{"name": "cpu", "columns": ["time", "max"], "points": [[1, 20], [2, null]]}]`
+	server, zeus, bucket_name := mock("/metrics/goZeus/_values/", &url.Values{}, 200, retBody)
+	defer server.Close()
+
+	series, err := zeus.bucket(bucket_name).GetMetricSeries("", "", "", "", 0, 0, "", 0, 0)
+	if err != nil {
+		t.Fatal("failed to get metric series:", err)
+	}
+	if len(series) != 2 || len(series[1].Metrics) != 2 ||
+		series[1].Metrics[0].Point[0] != 20 {
+		t.Errorf("wrong series: %#v", series)
+	}
+}
+
+func FuzzMetricListUnmarshalJSON(f *testing.F) {
+	f.Add([]byte(`[{"points": [[1430355869.123,144740003,20.0]],"name": "Jon.Snow","columns": ["time","sequence_number","age"]}]`))
+	f.Add([]byte(`{"name": "cpu", "columns": ["a", "time"], "points": [[null, 1], []]}`))
+	f.Add([]byte(`[{"columns": [null], "points": [[null]]}, {}]`))
+	f.Add([]byte(`[[]]`))
+	f.Fuzz(func(t *testing.T, js []byte) {
+		check := func(metrics MetricList) {
+			for _, m := range metrics.Metrics {
+				if len(m.Point) != len(metrics.Columns) {
+					t.Errorf("point of %d values for %d columns", len(m.Point),
+						len(metrics.Columns))
+				}
+			}
+		}
+		var metrics MetricList
+		if err := json.Unmarshal(js, &metrics); err == nil {
+			check(metrics)
+		}
+		var series []MetricList
+		if err := json.Unmarshal(js, &series); err == nil {
+			for _, metrics := range series {
+				check(metrics)
+			}
+		}
+	})
+}
+
 func TestDeleteMetrics(t *testing.T) {
 	metricName := randString(5)
 	param := url.Values{}
@@ -527,3 +650,79 @@ func TestZeusGetTrigalertLast24(t *testing.T) {
 		t.Error("Retrieved trigalert_last24 is wrong:", trigalert)
 	}
 }
+
+func stall() (*httptest.Server, chan struct{}) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}))
+	return server, release
+}
+
+func TestContextDeadline(t *testing.T) {
+	server, release := stall()
+	defer server.Close()
+	defer close(release)
+
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+	bucket := zeus.Bucket("org1/bucket1")
+	logs := LogList{Name: "syslog", Logs: []Log{Log{"foo": "bar"}}}
+
+	calls := map[string]func(ctx context.Context) error{
+		"PostLogsCtx": func(ctx context.Context) error {
+			_, err := bucket.PostLogsCtx(ctx, logs)
+			return err
+		},
+		"GetLogsCtx": func(ctx context.Context) error {
+			_, _, err := bucket.GetLogsCtx(ctx, "syslog", "", "", 0, 0, 0, 0)
+			return err
+		},
+		"GetMetricValuesCtx": func(ctx context.Context) error {
+			_, err := bucket.GetMetricValuesCtx(ctx, "cpu", "", "", "", 0, 0, "", 0, 0)
+			return err
+		},
+		"DeleteAlertCtx": func(ctx context.Context) error {
+			_, err := bucket.DeleteAlertCtx(ctx, 1)
+			return err
+		},
+		"GetTrigalertCtx": func(ctx context.Context) error {
+			_, err := zeus.bucket("org1/bucket1").GetTrigalertCtx(ctx)
+			return err
+		},
+	}
+	for name, call := range calls {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		start := time.Now()
+		err := call(ctx)
+		cancel()
+		if err == nil {
+			t.Errorf("%s: should fail when the deadline is exceeded", name)
+		} else if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: expected deadline exceeded, got %v", name, err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s: returned after %v", name, elapsed)
+		}
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	server, release := stall()
+	defer server.Close()
+	defer close(release)
+
+	zeus := &Zeus{ApiServ: server.URL, Token: "goZeus"}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	_, _, err := zeus.Bucket("org1/bucket1").GetAlertsCtx(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Error("expected canceled request, got", err)
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeustest
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/CiscoZeus/go-zeusclient"
+)
+
+// Trigalert records that an alert was triggered, as returned by
+// GetTrigalert in the "result" list.
+type Trigalert struct {
+	AlertID   int64   `json:"alert_id"`
+	AlertName string  `json:"alert_name"`
+	Value     float64 `json:"value"`
+	// Timestamp is the unix time of the trigger, in seconds.
+	Timestamp float64 `json:"timestamp"`
+}
+
+// AddAlert stores alert in bucket, as if it had been posted, and returns
+// its id.
+func (server *Server) AddAlert(bucket string, alert zeus.Alert) int64 {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return server.addAlert(server.bucket(bucket), alert)
+}
+
+func (server *Server) addAlert(data *bucketData, alert zeus.Alert) int64 {
+	server.lastID++
+	alert.Id = server.lastID
+	alert.Created = server.Now().UTC().Format(time.RFC3339)
+	alert.Last_updated = alert.Created
+	data.alerts[alert.Id] = alert
+	return alert.Id
+}
+
+// Alerts returns the alerts of bucket, ordered by id.
+func (server *Server) Alerts(bucket string) []zeus.Alert {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return sortedAlerts(server.bucket(bucket))
+}
+
+func sortedAlerts(data *bucketData) []zeus.Alert {
+	alerts := make([]zeus.Alert, 0, len(data.alerts))
+	for _, alert := range data.alerts {
+		alerts = append(alerts, alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].Id < alerts[j].Id })
+	return alerts
+}
+
+// TriggerAlert records that the alert id of bucket was triggered by value
+// at the given time, or now if it is zero.
+func (server *Server) TriggerAlert(bucket string, id int64, value float64,
+	at time.Time) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if at.IsZero() {
+		at = server.Now()
+	}
+	data := server.bucket(bucket)
+	data.trigalerts = append(data.trigalerts, Trigalert{
+		AlertID:   id,
+		AlertName: data.alerts[id].Alert_name,
+		Value:     value,
+		Timestamp: float64(at.UnixNano()) / 1e9,
+	})
+}
+
+func serveAlerts(server *Server, req *request) (int, interface{}) {
+	if len(req.path) == 0 {
+		switch req.method {
+		case "GET":
+			return http.StatusOK, sortedAlerts(req.bucket)
+		case "POST":
+			alert := zeus.Alert{Token: req.token}
+			if err := updateAlert(&alert, req.form); err != "" {
+				return http.StatusBadRequest, errorBody(err)
+			}
+			id := server.addAlert(req.bucket, alert)
+			return http.StatusCreated, req.bucket.alerts[id]
+		}
+		return http.StatusNotFound, errorBody("not found")
+	}
+
+	id, err := strconv.ParseInt(req.path[0], 10, 64)
+	alert, ok := req.bucket.alerts[id]
+	if err != nil || len(req.path) != 1 || !ok {
+		return http.StatusNotFound, errorBody("alert not found")
+	}
+	switch req.method {
+	case "GET":
+		return http.StatusOK, alert
+	case "PUT":
+		if err := updateAlert(&alert, req.form); err != "" {
+			return http.StatusBadRequest, errorBody(err)
+		}
+		alert.Last_updated = server.Now().UTC().Format(time.RFC3339)
+		req.bucket.alerts[id] = alert
+		return http.StatusOK, alert
+	case "DELETE":
+		delete(req.bucket.alerts, id)
+		return http.StatusNoContent, nil
+	}
+	return http.StatusNotFound, errorBody("not found")
+}
+
+// updateAlert sets the fields of alert given in form, and checks that the
+// required ones are set. It returns the reason the alert is invalid, if so.
+func updateAlert(alert *zeus.Alert, form url.Values) string {
+	fields := map[string]*string{
+		"alert_name":       &alert.Alert_name,
+		"username":         &alert.Username,
+		"alerts_type":      &alert.Alerts_type,
+		"alert_expression": &alert.Alert_expression,
+		"alert_severity":   &alert.Alert_severity,
+		"metric_name":      &alert.Metric_name,
+		"emails":           &alert.Emails,
+		"status":           &alert.Status,
+	}
+	for key, field := range fields {
+		if value, ok := form[key]; ok {
+			*field = value[0]
+		}
+	}
+	if raw := form.Get("frequency"); raw != "" {
+		frequency, err := strconv.ParseFloat(raw, 64)
+		if err != nil || frequency <= 0 {
+			return "invalid frequency"
+		}
+		alert.Frequency = frequency
+	}
+	if alert.Alert_name == "" {
+		return "alert_name is required"
+	}
+	if alert.Alert_expression == "" {
+		return "alert_expression is required"
+	}
+	return ""
+}
+
+func serveTrigalerts(server *Server, req *request) (int, interface{}) {
+	if req.method != "GET" || len(req.path) > 1 ||
+		(len(req.path) == 1 && req.path[0] != "last24") {
+		return http.StatusNotFound, errorBody("not found")
+	}
+	var since float64
+	if len(req.path) == 1 {
+		since = server.now() - (24 * time.Hour).Seconds()
+	}
+	result := []Trigalert{}
+	for _, trigalert := range req.bucket.trigalerts {
+		if trigalert.Timestamp >= since {
+			result = append(result, trigalert)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Timestamp > result[j].Timestamp
+	})
+	return http.StatusOK, map[string]interface{}{
+		"total":  len(result),
+		"result": result,
+	}
+}
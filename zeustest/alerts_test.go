@@ -0,0 +1,80 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeustest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CiscoZeus/go-zeusclient"
+)
+
+func TestServerAlerts(t *testing.T) {
+	server, bucket := newBucket(t)
+	now := time.Unix(1430355869, 0)
+	server.Now = func() time.Time { return now }
+
+	alert := zeus.Alert{
+		Alert_name:       "hot",
+		Alert_expression: "cpu.temp > 80",
+		Metric_name:      "cpu",
+		Frequency:        60,
+	}
+	if suc, err := bucket.PostAlert(alert); err != nil || suc != 1 {
+		t.Fatal("failed to post alert:", suc, err)
+	}
+	if _, err := bucket.PostAlert(zeus.Alert{Alert_name: "x",
+		Alert_expression: "a > 1", Frequency: -1}); err != nil {
+		t.Fatal("the client should not send a negative frequency:", err)
+	}
+	total, alerts, err := bucket.GetAlerts()
+	if err != nil || total != 2 || alerts[0].Id != 1 || alerts[0].Token != "goZeus" ||
+		alerts[0].Created != "2015-04-30T01:04:29Z" {
+		t.Fatal("unexpected alerts:", alerts, err)
+	}
+
+	alert.Alert_severity = "high"
+	if suc, err := bucket.PutAlert(1, alert); err != nil || suc != 1 {
+		t.Error("failed to update alert:", suc, err)
+	}
+	got, err := bucket.GetAlert(1)
+	if err != nil || got.Alert_severity != "high" || got.Frequency != 60 {
+		t.Error("alert was not updated:", got, err)
+	}
+	if _, err := bucket.GetAlert(7); !zeus.IsNotFound(err) {
+		t.Error("should not find a missing alert:", err)
+	}
+	if suc, err := bucket.DeleteAlert(2); err != nil || suc != 1 {
+		t.Error("failed to delete alert:", suc, err)
+	}
+	if alerts := server.Alerts("org1/bucket1"); len(alerts) != 1 {
+		t.Error("unexpected alerts", alerts)
+	}
+
+	server.TriggerAlert("org1/bucket1", 1, 90, now.Add(-48*time.Hour))
+	server.TriggerAlert("org1/bucket1", 1, 95, time.Time{})
+	trigalert, err := bucket.GetTrigalert()
+	if err != nil || trigalert["total"] != 2.0 {
+		t.Error("unexpected trigalerts:", trigalert, err)
+	}
+	trigalert, err = bucket.GetTrigalertLast24()
+	if err != nil || trigalert["total"] != 1.0 {
+		t.Fatal("unexpected trigalerts of the last 24 hours:", trigalert, err)
+	}
+	last := trigalert["result"].([]interface{})[0].(map[string]interface{})
+	if last["alert_name"] != "hot" || last["value"] != 95.0 {
+		t.Error("unexpected trigalert", last)
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeustest
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// condition is a parsed filter_condition.
+type condition interface {
+	match(values map[string]float64) bool
+}
+
+// comparison compares a column with a number. A point without the column
+// doesn't match.
+type comparison struct {
+	column string
+	op     string
+	value  float64
+}
+
+func (cmp comparison) match(values map[string]float64) bool {
+	value, ok := values[cmp.column]
+	if !ok {
+		return false
+	}
+	switch cmp.op {
+	case "=", "==":
+		return value == cmp.value
+	case "!=", "<>":
+		return value != cmp.value
+	case ">":
+		return value > cmp.value
+	case ">=":
+		return value >= cmp.value
+	case "<":
+		return value < cmp.value
+	}
+	return value <= cmp.value
+}
+
+// junction is the "and" or "or" of conditions.
+type junction struct {
+	and        bool
+	conditions []condition
+}
+
+func (j junction) match(values map[string]float64) bool {
+	for _, cond := range j.conditions {
+		if cond.match(values) != j.and {
+			return !j.and
+		}
+	}
+	return j.and
+}
+
+// parseCondition parses a filter_condition such as
+// "age > 10 and (height <= 2 or weight != 0)".
+func parseCondition(raw string) (condition, error) {
+	parser := &conditionParser{tokens: tokenize(raw)}
+	cond, err := parser.or()
+	if err == nil && parser.pos < len(parser.tokens) {
+		err = fmt.Errorf("unexpected %q", parser.tokens[parser.pos])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter_condition %q: %v", raw, err)
+	}
+	return cond, nil
+}
+
+// tokenize splits a condition into words, numbers, operators and
+// parentheses.
+func tokenize(raw string) []string {
+	var tokens []string
+	for i := 0; i < len(raw); {
+		c := rune(raw[i])
+		start := i
+		switch {
+		case unicode.IsSpace(c):
+			i++
+			continue
+		case c == '(' || c == ')':
+			i++
+		case strings.ContainsRune("=!<>", c):
+			for i < len(raw) && strings.ContainsRune("=!<>", rune(raw[i])) {
+				i++
+			}
+		default:
+			for i < len(raw) && !unicode.IsSpace(rune(raw[i])) &&
+				!strings.ContainsRune("()=!<>", rune(raw[i])) {
+				i++
+			}
+		}
+		tokens = append(tokens, raw[start:i])
+	}
+	return tokens
+}
+
+type conditionParser struct {
+	tokens []string
+	pos    int
+}
+
+func (parser *conditionParser) next() string {
+	if parser.pos >= len(parser.tokens) {
+		return ""
+	}
+	token := parser.tokens[parser.pos]
+	parser.pos++
+	return token
+}
+
+func (parser *conditionParser) accept(keyword string) bool {
+	if parser.pos < len(parser.tokens) &&
+		strings.EqualFold(parser.tokens[parser.pos], keyword) {
+		parser.pos++
+		return true
+	}
+	return false
+}
+
+func (parser *conditionParser) or() (condition, error) {
+	return parser.junction("or", false, parser.and)
+}
+
+func (parser *conditionParser) and() (condition, error) {
+	return parser.junction("and", true, parser.operand)
+}
+
+func (parser *conditionParser) junction(keyword string, and bool,
+	operand func() (condition, error)) (condition, error) {
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	j := junction{and: and, conditions: []condition{first}}
+	for parser.accept(keyword) {
+		cond, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		j.conditions = append(j.conditions, cond)
+	}
+	if len(j.conditions) == 1 {
+		return first, nil
+	}
+	return j, nil
+}
+
+func (parser *conditionParser) operand() (condition, error) {
+	if parser.accept("(") {
+		cond, err := parser.or()
+		if err != nil {
+			return nil, err
+		}
+		if !parser.accept(")") {
+			return nil, errors.New("missing )")
+		}
+		return cond, nil
+	}
+	column := parser.next()
+	if column == "" || strings.ContainsAny(column, "()=!<>") {
+		return nil, fmt.Errorf("expected a column, got %q", column)
+	}
+	op := parser.next()
+	switch op {
+	case "=", "==", "!=", "<>", ">", ">=", "<", "<=":
+	default:
+		return nil, fmt.Errorf("unknown operator %q", op)
+	}
+	raw := parser.next()
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return nil, fmt.Errorf("expected a number, got %q", raw)
+	}
+	return comparison{column, op, value}, nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeustest
+
+import (
+	"testing"
+)
+
+func TestParseCondition(t *testing.T) {
+	values := map[string]float64{"age": 20, "height": 1.5}
+	for raw, expected := range map[string]bool{
+		"age > 10":                                true,
+		"age>=20 AND height<1":                    false,
+		"age = 1 or height == 1.5":                true,
+		"age != 20 or (height <> 2 and age < 30)": true,
+		"weight <= 0":                             false,
+		"age > -5":                                true,
+	} {
+		cond, err := parseCondition(raw)
+		if err != nil {
+			t.Errorf("%q: %v", raw, err)
+			continue
+		}
+		if got := cond.match(values); got != expected {
+			t.Errorf("%q: expected %v, got %v", raw, expected, got)
+		}
+	}
+	for _, invalid := range []string{"", "age", "age >", "age > x", "age ~ 1",
+		"(age > 1", "age > 1 )", "age > 1 and"} {
+		if _, err := parseCondition(invalid); err == nil {
+			t.Errorf("%q: should fail", invalid)
+		}
+	}
+}
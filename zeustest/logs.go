@@ -0,0 +1,215 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeustest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/CiscoZeus/go-zeusclient"
+)
+
+// AddLogs stores logs in bucket, as if they had been posted.
+func (server *Server) AddLogs(bucket string, logs zeus.LogList) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	data := server.bucket(bucket)
+	for _, log := range logs.Logs {
+		data.logs[logs.Name] = append(data.logs[logs.Name], server.stamp(log))
+	}
+}
+
+// Logs returns the logs called logName stored in bucket, in the order they
+// were received.
+func (server *Server) Logs(bucket, logName string) []zeus.Log {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	stored := server.bucket(bucket).logs[logName]
+	logs := make([]zeus.Log, len(stored))
+	for i, log := range stored {
+		logs[i] = copyLog(log)
+	}
+	return logs
+}
+
+// stamp returns a copy of log with a "timestamp" field, set to the time of
+// the server if the log has none.
+func (server *Server) stamp(log zeus.Log) zeus.Log {
+	log = copyLog(log)
+	if _, ok := log["timestamp"]; !ok {
+		log["timestamp"] = server.now()
+	}
+	return log
+}
+
+func copyLog(log zeus.Log) zeus.Log {
+	copied := make(zeus.Log, len(log))
+	for key, value := range log {
+		copied[key] = value
+	}
+	return copied
+}
+
+func serveLogs(server *Server, req *request) (int, interface{}) {
+	switch {
+	case req.method == "POST" && len(req.path) == 1:
+		return server.postLogs(req)
+	case req.method == "GET" && len(req.path) == 0:
+		return server.getLogs(req)
+	}
+	return http.StatusNotFound, errorBody("not found")
+}
+
+// postLogs stores the logs of the request. Logs holding nested values are
+// rejected, as Zeus doesn't support them.
+func (server *Server) postLogs(req *request) (int, interface{}) {
+	var logs []json.RawMessage
+	if err := json.Unmarshal([]byte(req.form.Get("logs")), &logs); err != nil {
+		return http.StatusBadRequest, errorBody("invalid logs: " + err.Error())
+	}
+	var resp postResponse
+	for _, raw := range logs {
+		var log zeus.Log
+		if err := json.Unmarshal(raw, &log); err != nil || log == nil || nested(log) {
+			resp.Failed++
+			continue
+		}
+		name := req.path[0]
+		req.bucket.logs[name] = append(req.bucket.logs[name], server.stamp(log))
+		resp.Successful++
+	}
+	if resp.Failed > 0 {
+		resp.Error = fmt.Sprintf("%d logs have nested or invalid values", resp.Failed)
+	}
+	return http.StatusOK, resp
+}
+
+func nested(log zeus.Log) bool {
+	for _, value := range log {
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			return true
+		}
+	}
+	return false
+}
+
+// getLogs returns the logs matching the parameters of the request, in the
+// order they were received.
+func (server *Server) getLogs(req *request) (int, interface{}) {
+	name := req.form.Get("log_name")
+	if name == "" {
+		return http.StatusBadRequest, errorBody("log_name is required")
+	}
+	field := req.form.Get("attribute_name")
+	var pattern *regexp.Regexp
+	if raw := req.form.Get("pattern"); raw != "" {
+		pattern = compileGlob(raw)
+	}
+	from, err := floatParam(req.form, "from", 0)
+	if err != nil {
+		return http.StatusBadRequest, errorBody(err.Error())
+	}
+	to, err := floatParam(req.form, "to", 0)
+	if err != nil {
+		return http.StatusBadRequest, errorBody(err.Error())
+	}
+	offset, err := intParam(req.form, "offset", 0)
+	if err != nil {
+		return http.StatusBadRequest, errorBody(err.Error())
+	}
+	limit, err := intParam(req.form, "limit", DefaultLogLimit)
+	if err != nil {
+		return http.StatusBadRequest, errorBody(err.Error())
+	}
+
+	matches := []zeus.Log{}
+	for _, log := range req.bucket.logs[name] {
+		timestamp, _ := toFloat(log["timestamp"])
+		if (from > 0 && timestamp < from) || (to > 0 && timestamp > to) {
+			continue
+		}
+		if pattern != nil && !matchLog(log, field, pattern) {
+			continue
+		}
+		matches = append(matches, log)
+	}
+	start, end := window(len(matches), offset, limit)
+	return http.StatusOK, map[string]interface{}{
+		"total":  len(matches),
+		"result": matches[start:end],
+	}
+}
+
+// matchLog reports whether field of log, or any field if it is empty,
+// matches pattern.
+func matchLog(log zeus.Log, field string, pattern *regexp.Regexp) bool {
+	if field != "" {
+		value, ok := log[field]
+		return ok && pattern.MatchString(text(value))
+	}
+	for _, value := range log {
+		if pattern.MatchString(text(value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// toFloat returns the value of a field of a log, if it is a number.
+func toFloat(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func text(value interface{}) string {
+	if str, ok := value.(string); ok {
+		return str
+	}
+	return fmt.Sprint(value)
+}
+
+// compileGlob turns a pattern with "*" and "?" wildcards into a regexp.
+func compileGlob(pattern string) *regexp.Regexp {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String())
+}
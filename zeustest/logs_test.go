@@ -0,0 +1,76 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeustest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/CiscoZeus/go-zeusclient"
+)
+
+func TestServerLogs(t *testing.T) {
+	server, bucket := newBucket(t)
+	server.Now = func() time.Time { return time.Unix(1500, 0) }
+
+	logs := zeus.LogList{Name: "syslog", Logs: []zeus.Log{
+		{"message": "disk full", "timestamp": 1000.0},
+		{"message": "disk ok", "timestamp": 2000.0},
+		{"message": "cpu hot"},
+	}}
+	if suc, err := bucket.PostLogs(logs); err != nil || suc != 3 {
+		t.Fatal("failed to post logs:", suc, err)
+	}
+	result, err := bucket.PostLogsResult(context.Background(), zeus.LogList{
+		Name: "syslog", Logs: []zeus.Log{{"nested": map[string]interface{}{"a": 1}}}})
+	if err != nil || result.Failed != 1 {
+		t.Error("nested logs should be rejected:", result, err)
+	}
+	if stored := server.Logs("org1/bucket1", "syslog"); len(stored) != 3 ||
+		stored[2]["timestamp"] != 1500.0 {
+		t.Error("unexpected stored logs", stored)
+	}
+
+	total, list, err := bucket.GetLogs("syslog", "message", "disk*", 0, 0, 0, 0)
+	if err != nil || total != 2 || len(list.Logs) != 2 {
+		t.Error("failed to match a pattern:", total, list, err)
+	}
+	total, list, err = bucket.GetLogs("syslog", "", "", 1200, 2000, 0, 0)
+	if err != nil || total != 2 || list.Logs[0]["message"] != "disk ok" {
+		t.Error("failed to select a time range:", total, list, err)
+	}
+	total, list, err = bucket.GetLogs("syslog", "", "", 0, 0, 1, 1)
+	if err != nil || total != 3 || len(list.Logs) != 1 || list.Logs[0]["message"] != "disk ok" {
+		t.Error("failed to page:", total, list, err)
+	}
+
+	server.AddLogs("org1/bucket1", zeus.LogList{Name: "syslog",
+		Logs: make([]zeus.Log, 15)})
+	_, list, _ = bucket.GetLogs("syslog", "", "", 0, 0, 0, 0)
+	if len(list.Logs) != DefaultLogLimit {
+		t.Error("unexpected default limit", len(list.Logs))
+	}
+	var count int
+	for _, err := range bucket.Logs(context.Background(), zeus.NewLogQuery("syslog")) {
+		if err != nil {
+			t.Fatal("failed to iterate:", err)
+		}
+		count++
+	}
+	if count != 18 {
+		t.Error("unexpected number of logs", count)
+	}
+}
@@ -0,0 +1,424 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeustest
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/CiscoZeus/go-zeusclient"
+)
+
+// series holds the points of a metric.
+type series struct {
+	// columns are in the order they were first received.
+	columns []string
+	points  []point
+}
+
+// point is a metric point, holding only the values it was sent with.
+type point struct {
+	time   float64
+	values map[string]float64
+}
+
+func (series *series) add(p point) {
+	for _, col := range sortedKeys(p.values) {
+		if !contains(series.columns, col) {
+			series.columns = append(series.columns, col)
+		}
+	}
+	series.points = append(series.points, p)
+}
+
+func sortedKeys(values map[string]float64) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(list []string, item string) bool {
+	for _, element := range list {
+		if element == item {
+			return true
+		}
+	}
+	return false
+}
+
+// AddMetrics stores metrics in bucket, as if they had been posted.
+func (server *Server) AddMetrics(bucket string, metrics zeus.MetricList) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	data := server.bucket(bucket)
+	for _, metric := range metrics.Metrics {
+		p := point{time: metric.Timestamp, values: make(map[string]float64)}
+		if p.time == 0 {
+			p.time = server.now()
+		}
+		for idx, col := range metrics.Columns {
+			if value, ok := metric.Value(idx); ok {
+				p.values[col] = value
+			}
+		}
+		server.series(data, metrics.Name).add(p)
+	}
+}
+
+// Metrics returns the points of metricName stored in bucket, in the order
+// they were received. Values a point was sent without are marked missing.
+func (server *Server) Metrics(bucket, metricName string) zeus.MetricList {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	metrics := zeus.MetricList{Name: metricName}
+	stored, ok := server.bucket(bucket).metrics[metricName]
+	if !ok {
+		return metrics
+	}
+	metrics.Columns = append([]string(nil), stored.columns...)
+	for _, p := range stored.points {
+		metric := zeus.Metric{Timestamp: p.time,
+			Point: make([]float64, len(stored.columns))}
+		for idx, col := range stored.columns {
+			if value, ok := p.values[col]; ok {
+				metric.Point[idx] = value
+			} else {
+				metric.SetMissing(idx)
+			}
+		}
+		metrics.Metrics = append(metrics.Metrics, metric)
+	}
+	return metrics
+}
+
+// series returns the series called name, creating it if needed.
+func (server *Server) series(data *bucketData, name string) *series {
+	stored, ok := data.metrics[name]
+	if !ok {
+		stored = &series{}
+		data.metrics[name] = stored
+	}
+	return stored
+}
+
+func serveMetrics(server *Server, req *request) (int, interface{}) {
+	if len(req.path) != 1 {
+		return http.StatusNotFound, errorBody("not found")
+	}
+	switch name := req.path[0]; {
+	case req.method == "GET" && name == "_names":
+		return getMetricNames(req)
+	case req.method == "GET" && name == "_values":
+		return getMetricValues(req)
+	case req.method == "POST":
+		return server.postMetrics(req, name)
+	case req.method == "DELETE":
+		if _, ok := req.bucket.metrics[name]; !ok {
+			return http.StatusNotFound, errorBody("metric not found")
+		}
+		delete(req.bucket.metrics, name)
+		return http.StatusOK, []string{"Metric deletion successful"}
+	}
+	return http.StatusNotFound, errorBody("not found")
+}
+
+// postMetrics stores the points of the request. Points without values are
+// rejected.
+func (server *Server) postMetrics(req *request, name string) (int, interface{}) {
+	var points []json.RawMessage
+	if err := json.Unmarshal([]byte(req.form.Get("metrics")), &points); err != nil {
+		return http.StatusBadRequest, errorBody("invalid metrics: " + err.Error())
+	}
+	var resp postResponse
+	for _, raw := range points {
+		var posted struct {
+			Point     map[string]float64 `json:"point"`
+			Timestamp float64            `json:"timestamp"`
+		}
+		if err := json.Unmarshal(raw, &posted); err != nil || len(posted.Point) == 0 {
+			resp.Failed++
+			continue
+		}
+		if posted.Timestamp == 0 {
+			posted.Timestamp = server.now()
+		}
+		server.series(req.bucket, name).add(point{posted.Timestamp, posted.Point})
+		resp.Successful++
+	}
+	if resp.Failed > 0 {
+		resp.Error = strconv.Itoa(resp.Failed) + " points have no or invalid values"
+	}
+	return http.StatusOK, resp
+}
+
+// getMetricNames returns the sorted names of the metrics matching the
+// metric_name regular expression.
+func getMetricNames(req *request) (int, interface{}) {
+	pattern, err := regexp.Compile(req.form.Get("metric_name"))
+	if err != nil {
+		return http.StatusBadRequest, errorBody("invalid metric_name: " + err.Error())
+	}
+	offset, err := intParam(req.form, "offset", 0)
+	if err != nil {
+		return http.StatusBadRequest, errorBody(err.Error())
+	}
+	limit, err := intParam(req.form, "limit", 0)
+	if err != nil {
+		return http.StatusBadRequest, errorBody(err.Error())
+	}
+	names := []string{}
+	for name := range req.bucket.metrics {
+		if pattern.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	start, end := window(len(names), offset, limit)
+	return http.StatusOK, names[start:end]
+}
+
+// seriesResponse is a series in the response to a query of values.
+type seriesResponse struct {
+	Name    string           `json:"name"`
+	Columns []string         `json:"columns"`
+	Points  [][]*json.Number `json:"points"`
+}
+
+// getMetricValues returns the points of a metric, newest first, filtered,
+// aggregated and grouped as the request asks.
+func getMetricValues(req *request) (int, interface{}) {
+	query, err := parseValuesQuery(req)
+	if err != nil {
+		return http.StatusBadRequest, errorBody(err.Error())
+	}
+	stored, ok := req.bucket.metrics[query.name]
+	if !ok {
+		return http.StatusOK, []seriesResponse{}
+	}
+	if query.column != "" && !contains(stored.columns, query.column) {
+		return http.StatusBadRequest, errorBody("unknown aggregator_column " +
+			query.column)
+	}
+
+	var selected []point
+	for _, p := range stored.points {
+		if (query.from > 0 && p.time < query.from) || (query.to > 0 && p.time > query.to) {
+			continue
+		}
+		if query.filter != nil && !query.filter.match(p.values) {
+			continue
+		}
+		selected = append(selected, p)
+	}
+	sort.SliceStable(selected, func(i, j int) bool {
+		return selected[i].time > selected[j].time
+	})
+
+	resp := seriesResponse{Name: query.name, Points: [][]*json.Number{}}
+	if query.aggregator == "" {
+		resp.Columns = append([]string{"time"}, stored.columns...)
+		for _, p := range selected {
+			row := []*json.Number{number(p.time)}
+			for _, col := range stored.columns {
+				if value, ok := p.values[col]; ok {
+					row = append(row, number(value))
+				} else {
+					row = append(row, nil)
+				}
+			}
+			resp.Points = append(resp.Points, row)
+		}
+	} else {
+		resp.Columns = []string{"time", query.aggregator}
+		for _, group := range query.groups(selected) {
+			resp.Points = append(resp.Points, []*json.Number{number(group.time),
+				aggregate(query.aggregator, group.values)})
+		}
+	}
+	start, end := window(len(resp.Points), query.offset, query.limit)
+	resp.Points = resp.Points[start:end]
+	return http.StatusOK, []seriesResponse{resp}
+}
+
+// valuesQuery holds the parameters of a query of values.
+type valuesQuery struct {
+	name               string
+	aggregator, column string
+	interval           float64
+	from, to           float64
+	filter             condition
+	offset, limit      int
+}
+
+func parseValuesQuery(req *request) (query valuesQuery, err error) {
+	form := req.form
+	query.name = form.Get("metric_name")
+	if query.name == "" {
+		return query, errors.New("metric_name is required")
+	}
+	query.aggregator = form.Get("aggregator_function")
+	query.column = form.Get("aggregator_column")
+	if query.aggregator != "" {
+		if _, ok := aggregators[query.aggregator]; !ok {
+			return query, errors.New("unknown aggregator_function " + query.aggregator)
+		}
+		if query.column == "" {
+			return query, errors.New("aggregator_column is required")
+		}
+	}
+	if raw := form.Get("group_interval"); raw != "" {
+		if query.aggregator == "" {
+			return query, errors.New("group_interval needs an aggregator_function")
+		}
+		if query.interval, err = parseInterval(raw); err != nil {
+			return query, err
+		}
+	}
+	if query.from, err = floatParam(form, "from", 0); err != nil {
+		return query, err
+	}
+	if query.to, err = floatParam(form, "to", 0); err != nil {
+		return query, err
+	}
+	if raw := form.Get("filter_condition"); raw != "" {
+		if query.filter, err = parseCondition(raw); err != nil {
+			return query, err
+		}
+	}
+	if query.offset, err = intParam(form, "offset", 0); err != nil {
+		return query, err
+	}
+	query.limit, err = intParam(form, "limit", 0)
+	return query, err
+}
+
+// parseInterval parses a group_interval such as "30s" or "2h" into seconds.
+func parseInterval(raw string) (float64, error) {
+	units := map[byte]time.Duration{
+		's': time.Second,
+		'm': time.Minute,
+		'h': time.Hour,
+		'd': 24 * time.Hour,
+		'w': 7 * 24 * time.Hour,
+	}
+	unit, ok := units[raw[len(raw)-1]]
+	n, err := strconv.Atoi(raw[:len(raw)-1])
+	if !ok || err != nil || n <= 0 {
+		return 0, errors.New("invalid group_interval " + raw)
+	}
+	return (time.Duration(n) * unit).Seconds(), nil
+}
+
+// group is the values of the aggregated column in a window of time.
+type group struct {
+	time   float64
+	values []float64
+}
+
+// groups splits points, sorted newest first, into windows of the group
+// interval, or a single window starting at from without interval. Windows
+// without points are left out.
+func (query valuesQuery) groups(points []point) []group {
+	var groups []group
+	for _, p := range points {
+		start := query.from
+		if query.interval > 0 {
+			start = math.Floor(p.time/query.interval) * query.interval
+		}
+		if len(groups) == 0 || groups[len(groups)-1].time != start {
+			groups = append(groups, group{time: start})
+		}
+		if value, ok := p.values[query.column]; ok {
+			last := &groups[len(groups)-1]
+			last.values = append(last.values, value)
+		}
+	}
+	return groups
+}
+
+// aggregators compute an aggregator_function over values, of which there
+// is at least one.
+var aggregators = map[string]func(values []float64) float64{
+	"count": func(values []float64) float64 { return float64(len(values)) },
+	"min": func(values []float64) float64 {
+		sort.Float64s(values)
+		return values[0]
+	},
+	"max": func(values []float64) float64 {
+		sort.Float64s(values)
+		return values[len(values)-1]
+	},
+	"sum": sum,
+	"mean": func(values []float64) float64 {
+		return sum(values) / float64(len(values))
+	},
+	"mode": func(values []float64) float64 {
+		sort.Float64s(values)
+		mode, best := values[0], 0
+		for start := 0; start < len(values); {
+			end := start
+			for end < len(values) && values[end] == values[start] {
+				end++
+			}
+			if end-start > best {
+				mode, best = values[start], end-start
+			}
+			start = end
+		}
+		return mode
+	},
+	"median": func(values []float64) float64 {
+		sort.Float64s(values)
+		mid := len(values) / 2
+		if len(values)%2 == 0 {
+			return (values[mid-1] + values[mid]) / 2
+		}
+		return values[mid]
+	},
+}
+
+func sum(values []float64) float64 {
+	total := 0.0
+	for _, value := range values {
+		total += value
+	}
+	return total
+}
+
+// aggregate applies aggregator to values. Without values, the result is
+// null, or 0 for count.
+func aggregate(aggregator string, values []float64) *json.Number {
+	if len(values) == 0 {
+		if aggregator == "count" {
+			return number(0)
+		}
+		return nil
+	}
+	return number(aggregators[aggregator](values))
+}
+
+func number(value float64) *json.Number {
+	n := json.Number(strconv.FormatFloat(value, 'f', -1, 64))
+	return &n
+}
@@ -0,0 +1,117 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeustest
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/CiscoZeus/go-zeusclient"
+)
+
+func TestServerMetrics(t *testing.T) {
+	server, bucket := newBucket(t)
+	metrics := zeus.MetricList{
+		Name:    "cpu",
+		Columns: []string{"load", "temp"},
+		Metrics: []zeus.Metric{
+			{Timestamp: 100, Point: []float64{1, 40}},
+			{Timestamp: 130, Point: []float64{3, 50}},
+			{Timestamp: 160, Point: []float64{5, 0}, Missing: []bool{false, true}},
+			{Timestamp: 250, Point: []float64{8, 70}},
+		},
+	}
+	if suc, err := bucket.PostMetrics(metrics); err != nil || suc != 4 {
+		t.Fatal("failed to post metrics:", suc, err)
+	}
+	if stored := server.Metrics("org1/bucket1", "cpu"); !reflect.DeepEqual(stored, metrics) {
+		t.Errorf("expected %+v, got %+v", metrics, stored)
+	}
+	server.AddMetrics("org1/bucket1", zeus.MetricList{Name: "mem",
+		Columns: []string{"used"}, Metrics: []zeus.Metric{{Point: []float64{1}}}})
+
+	names, err := bucket.GetMetricNames("^c", 0, 0)
+	if err != nil || !reflect.DeepEqual(names, []string{"cpu"}) {
+		t.Error("failed to match names:", names, err)
+	}
+	names, err = bucket.GetMetricNames("", 1, 1)
+	if err != nil || !reflect.DeepEqual(names, []string{"mem"}) {
+		t.Error("failed to page names:", names, err)
+	}
+
+	values, err := bucket.GetMetricValues("cpu", "", "", "", 120, 200, "", 0, 0)
+	if err != nil {
+		t.Fatal("failed to get values:", err)
+	}
+	expected := zeus.MetricList{Name: "cpu", Columns: []string{"load", "temp"},
+		Metrics: []zeus.Metric{
+			{Timestamp: 160, Point: []float64{5, 0}, Missing: []bool{false, true}},
+			{Timestamp: 130, Point: []float64{3, 50}},
+		}}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %+v, got %+v", expected, values)
+	}
+	columns, err := bucket.MetricColumns(context.Background(), "cpu")
+	if err != nil || !reflect.DeepEqual(columns, []string{"load", "temp"}) {
+		t.Error("failed to get columns:", columns, err)
+	}
+
+	query := zeus.NewMetricQuery("cpu").Aggregate(zeus.Mean, "load").
+		GroupBy(time.Minute).Where(zeus.Col("temp").Ge(40))
+	values, err = bucket.QueryMetrics(context.Background(), query)
+	if err != nil {
+		t.Fatal("failed to query:", err)
+	}
+	expected = zeus.MetricList{Name: "cpu", Columns: []string{"mean"},
+		Metrics: []zeus.Metric{
+			{Timestamp: 240, Point: []float64{8}},
+			{Timestamp: 120, Point: []float64{3}},
+			{Timestamp: 60, Point: []float64{1}},
+		}}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %+v, got %+v", expected, values)
+	}
+	for aggregator, want := range map[zeus.Aggregator]float64{
+		zeus.Count: 4, zeus.Min: 1, zeus.Max: 8, zeus.Sum: 17, zeus.Median: 4,
+	} {
+		values, err := bucket.QueryMetrics(context.Background(),
+			zeus.NewMetricQuery("cpu").Aggregate(aggregator, "load"))
+		if err != nil || len(values.Metrics) != 1 || values.Metrics[0].Point[0] != want {
+			t.Errorf("%s: expected %v, got %+v, %v", aggregator, want, values, err)
+		}
+	}
+
+	if _, err := bucket.GetMetricValues("cpu", "mean", "load", "", 0, 0,
+		"load >", 0, 0); !zeus.IsBadRequest(err) {
+		t.Error("should reject an invalid filter:", err)
+	}
+	if _, err := bucket.GetMetricValues("cpu", "mean", "", "", 0, 0,
+		"", 0, 0); !zeus.IsBadRequest(err) {
+		t.Error("should require an aggregator column:", err)
+	}
+
+	if ok, err := bucket.DeleteMetrics("cpu"); err != nil || !ok {
+		t.Error("failed to delete:", ok, err)
+	}
+	if _, err := bucket.DeleteMetrics("cpu"); !zeus.IsNotFound(err) {
+		t.Error("should not find a deleted metric:", err)
+	}
+	values, err = bucket.GetMetricValues("cpu", "", "", "", 0, 0, "", 0, 0)
+	if err != nil || len(values.Metrics) != 0 {
+		t.Error("a deleted metric should have no values:", values, err)
+	}
+}
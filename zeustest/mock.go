@@ -0,0 +1,350 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeustest
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/CiscoZeus/go-zeusclient"
+)
+
+// ErrNotScripted is returned by the methods of Mock whose response wasn't
+// scripted.
+var ErrNotScripted = errors.New("zeustest: call not scripted")
+
+// Call is a call received by a Mock. Method is the name of the method
+// without its Ctx or Result suffix, and Args its arguments without the
+// context.
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+// Mock implements zeus.API without a server. Every call is recorded, then
+// answered by the function of the matching field, which scripts the
+// response:
+//
+//	mock := &zeustest.Mock{
+//		PostLogsFunc: func(ctx context.Context, logs zeus.LogList) (
+//			zeus.PostResult, error) {
+//			return zeus.PostResult{Successful: len(logs.Logs)}, nil
+//		},
+//	}
+//
+// A method whose field is nil returns ErrNotScripted. The plain, Ctx and
+// Result variants of a method share a field, and the non-Ctx ones pass
+// context.Background(). GetMetricValues returns the first series of
+// GetMetricSeriesFunc. A Mock is safe for concurrent use, provided its
+// fields aren't changed during calls.
+type Mock struct {
+	GetLogsFunc func(ctx context.Context, logName, field, pattern string,
+		from, to int64, offset, limit int) (int, zeus.LogList, error)
+	PostLogsFunc    func(ctx context.Context, logs zeus.LogList) (zeus.PostResult, error)
+	PostMetricsFunc func(ctx context.Context, metrics zeus.MetricList) (
+		zeus.PostResult, error)
+	GetMetricNamesFunc func(ctx context.Context, metricName string, offset,
+		limit int) ([]string, error)
+	GetMetricSeriesFunc func(ctx context.Context, metricName, aggregator,
+		aggregatorCol, groupInterval string, from, to float64,
+		filterCondition string, offset, limit int) ([]zeus.MetricList, error)
+	DeleteMetricsFunc      func(ctx context.Context, metricName string) (bool, error)
+	PostAlertFunc          func(ctx context.Context, alert zeus.Alert) (int, error)
+	GetAlertsFunc          func(ctx context.Context) (int, []zeus.Alert, error)
+	GetAlertFunc           func(ctx context.Context, id int64) (zeus.Alert, error)
+	PutAlertFunc           func(ctx context.Context, id int64, alert zeus.Alert) (int, error)
+	DeleteAlertFunc        func(ctx context.Context, id int64) (int, error)
+	GetTrigalertFunc       func(ctx context.Context) (map[string]interface{}, error)
+	GetTrigalertLast24Func func(ctx context.Context) (map[string]interface{},
+		error)
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+var _ zeus.API = (*Mock)(nil)
+
+func (mock *Mock) record(method string, args ...interface{}) {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	mock.calls = append(mock.calls, Call{Method: method, Args: args})
+}
+
+// Calls returns the calls received, in order, optionally only those of the
+// given methods.
+func (mock *Mock) Calls(methods ...string) []Call {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	var calls []Call
+	for _, call := range mock.calls {
+		if len(methods) == 0 || contains(methods, call.Method) {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Reset forgets the calls received.
+func (mock *Mock) Reset() {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	mock.calls = nil
+}
+
+// GetLogs records the call and answers it with GetLogsFunc.
+func (mock *Mock) GetLogs(logName, field, pattern string, from, to int64,
+	offset, limit int) (total int, logs zeus.LogList, err error) {
+	return mock.GetLogsCtx(context.Background(), logName, field, pattern, from,
+		to, offset, limit)
+}
+
+// GetLogsCtx is like GetLogs but passes ctx on.
+func (mock *Mock) GetLogsCtx(ctx context.Context, logName, field,
+	pattern string, from, to int64, offset, limit int) (total int,
+	logs zeus.LogList, err error) {
+	mock.record("GetLogs", logName, field, pattern, from, to, offset, limit)
+	if mock.GetLogsFunc == nil {
+		return 0, zeus.LogList{}, ErrNotScripted
+	}
+	return mock.GetLogsFunc(ctx, logName, field, pattern, from, to, offset, limit)
+}
+
+// PostLogs records the call and answers it with PostLogsFunc.
+func (mock *Mock) PostLogs(logs zeus.LogList) (successful int, err error) {
+	return mock.PostLogsCtx(context.Background(), logs)
+}
+
+// PostLogsCtx is like PostLogs but passes ctx on.
+func (mock *Mock) PostLogsCtx(ctx context.Context, logs zeus.LogList) (
+	successful int, err error) {
+	result, err := mock.PostLogsResult(ctx, logs)
+	return result.Successful, err
+}
+
+// PostLogsResult records the call and answers it with PostLogsFunc.
+func (mock *Mock) PostLogsResult(ctx context.Context, logs zeus.LogList) (
+	zeus.PostResult, error) {
+	mock.record("PostLogs", logs)
+	if mock.PostLogsFunc == nil {
+		return zeus.PostResult{}, ErrNotScripted
+	}
+	return mock.PostLogsFunc(ctx, logs)
+}
+
+// PostMetrics records the call and answers it with PostMetricsFunc.
+func (mock *Mock) PostMetrics(metrics zeus.MetricList) (successful int, err error) {
+	return mock.PostMetricsCtx(context.Background(), metrics)
+}
+
+// PostMetricsCtx is like PostMetrics but passes ctx on.
+func (mock *Mock) PostMetricsCtx(ctx context.Context, metrics zeus.MetricList) (
+	successful int, err error) {
+	result, err := mock.PostMetricsResult(ctx, metrics)
+	return result.Successful, err
+}
+
+// PostMetricsResult records the call and answers it with PostMetricsFunc.
+func (mock *Mock) PostMetricsResult(ctx context.Context,
+	metrics zeus.MetricList) (zeus.PostResult, error) {
+	mock.record("PostMetrics", metrics)
+	if mock.PostMetricsFunc == nil {
+		return zeus.PostResult{}, ErrNotScripted
+	}
+	return mock.PostMetricsFunc(ctx, metrics)
+}
+
+// GetMetricNames records the call and answers it with GetMetricNamesFunc.
+func (mock *Mock) GetMetricNames(metricName string, offset, limit int) (
+	names []string, err error) {
+	return mock.GetMetricNamesCtx(context.Background(), metricName, offset, limit)
+}
+
+// GetMetricNamesCtx is like GetMetricNames but passes ctx on.
+func (mock *Mock) GetMetricNamesCtx(ctx context.Context, metricName string,
+	offset, limit int) (names []string, err error) {
+	mock.record("GetMetricNames", metricName, offset, limit)
+	if mock.GetMetricNamesFunc == nil {
+		return nil, ErrNotScripted
+	}
+	return mock.GetMetricNamesFunc(ctx, metricName, offset, limit)
+}
+
+// GetMetricValues records the call and answers it with the first series
+// returned by GetMetricSeriesFunc.
+func (mock *Mock) GetMetricValues(metricName string, aggregator string,
+	aggregatorCol, groupInterval string, from, to float64,
+	filterCondition string, offset, limit int) (metrics zeus.MetricList,
+	err error) {
+	return mock.GetMetricValuesCtx(context.Background(), metricName, aggregator,
+		aggregatorCol, groupInterval, from, to, filterCondition, offset, limit)
+}
+
+// GetMetricValuesCtx is like GetMetricValues but passes ctx on.
+func (mock *Mock) GetMetricValuesCtx(ctx context.Context, metricName string,
+	aggregator string, aggregatorCol, groupInterval string, from, to float64,
+	filterCondition string, offset, limit int) (metrics zeus.MetricList,
+	err error) {
+	series, err := mock.GetMetricSeriesCtx(ctx, metricName, aggregator,
+		aggregatorCol, groupInterval, from, to, filterCondition, offset, limit)
+	if err != nil || len(series) == 0 {
+		return zeus.MetricList{}, err
+	}
+	return series[0], nil
+}
+
+// GetMetricSeries records the call and answers it with GetMetricSeriesFunc.
+func (mock *Mock) GetMetricSeries(metricName string, aggregator string,
+	aggregatorCol, groupInterval string, from, to float64,
+	filterCondition string, offset, limit int) ([]zeus.MetricList, error) {
+	return mock.GetMetricSeriesCtx(context.Background(), metricName, aggregator,
+		aggregatorCol, groupInterval, from, to, filterCondition, offset, limit)
+}
+
+// GetMetricSeriesCtx is like GetMetricSeries but passes ctx on.
+func (mock *Mock) GetMetricSeriesCtx(ctx context.Context, metricName string,
+	aggregator string, aggregatorCol, groupInterval string, from, to float64,
+	filterCondition string, offset, limit int) (series []zeus.MetricList,
+	err error) {
+	mock.record("GetMetricSeries", metricName, aggregator, aggregatorCol,
+		groupInterval, from, to, filterCondition, offset, limit)
+	if mock.GetMetricSeriesFunc == nil {
+		return nil, ErrNotScripted
+	}
+	return mock.GetMetricSeriesFunc(ctx, metricName, aggregator, aggregatorCol,
+		groupInterval, from, to, filterCondition, offset, limit)
+}
+
+// DeleteMetrics records the call and answers it with DeleteMetricsFunc.
+func (mock *Mock) DeleteMetrics(metricName string) (bool, error) {
+	return mock.DeleteMetricsCtx(context.Background(), metricName)
+}
+
+// DeleteMetricsCtx is like DeleteMetrics but passes ctx on.
+func (mock *Mock) DeleteMetricsCtx(ctx context.Context, metricName string) (
+	bool, error) {
+	mock.record("DeleteMetrics", metricName)
+	if mock.DeleteMetricsFunc == nil {
+		return false, ErrNotScripted
+	}
+	return mock.DeleteMetricsFunc(ctx, metricName)
+}
+
+// PostAlert records the call and answers it with PostAlertFunc.
+func (mock *Mock) PostAlert(alert zeus.Alert) (successful int, err error) {
+	return mock.PostAlertCtx(context.Background(), alert)
+}
+
+// PostAlertCtx is like PostAlert but passes ctx on.
+func (mock *Mock) PostAlertCtx(ctx context.Context, alert zeus.Alert) (
+	successful int, err error) {
+	mock.record("PostAlert", alert)
+	if mock.PostAlertFunc == nil {
+		return 0, ErrNotScripted
+	}
+	return mock.PostAlertFunc(ctx, alert)
+}
+
+// GetAlerts records the call and answers it with GetAlertsFunc.
+func (mock *Mock) GetAlerts() (total int, alerts []zeus.Alert, err error) {
+	return mock.GetAlertsCtx(context.Background())
+}
+
+// GetAlertsCtx is like GetAlerts but passes ctx on.
+func (mock *Mock) GetAlertsCtx(ctx context.Context) (total int,
+	alerts []zeus.Alert, err error) {
+	mock.record("GetAlerts")
+	if mock.GetAlertsFunc == nil {
+		return 0, nil, ErrNotScripted
+	}
+	return mock.GetAlertsFunc(ctx)
+}
+
+// GetAlert records the call and answers it with GetAlertFunc.
+func (mock *Mock) GetAlert(id int64) (alert zeus.Alert, err error) {
+	return mock.GetAlertCtx(context.Background(), id)
+}
+
+// GetAlertCtx is like GetAlert but passes ctx on.
+func (mock *Mock) GetAlertCtx(ctx context.Context, id int64) (alert zeus.Alert,
+	err error) {
+	mock.record("GetAlert", id)
+	if mock.GetAlertFunc == nil {
+		return zeus.Alert{}, ErrNotScripted
+	}
+	return mock.GetAlertFunc(ctx, id)
+}
+
+// PutAlert records the call and answers it with PutAlertFunc.
+func (mock *Mock) PutAlert(id int64, alert zeus.Alert) (successful int, err error) {
+	return mock.PutAlertCtx(context.Background(), id, alert)
+}
+
+// PutAlertCtx is like PutAlert but passes ctx on.
+func (mock *Mock) PutAlertCtx(ctx context.Context, id int64, alert zeus.Alert) (
+	successful int, err error) {
+	mock.record("PutAlert", id, alert)
+	if mock.PutAlertFunc == nil {
+		return 0, ErrNotScripted
+	}
+	return mock.PutAlertFunc(ctx, id, alert)
+}
+
+// DeleteAlert records the call and answers it with DeleteAlertFunc.
+func (mock *Mock) DeleteAlert(id int64) (successful int, err error) {
+	return mock.DeleteAlertCtx(context.Background(), id)
+}
+
+// DeleteAlertCtx is like DeleteAlert but passes ctx on.
+func (mock *Mock) DeleteAlertCtx(ctx context.Context, id int64) (
+	successful int, err error) {
+	mock.record("DeleteAlert", id)
+	if mock.DeleteAlertFunc == nil {
+		return 0, ErrNotScripted
+	}
+	return mock.DeleteAlertFunc(ctx, id)
+}
+
+// GetTrigalert records the call and answers it with GetTrigalertFunc.
+func (mock *Mock) GetTrigalert() (trigalert map[string]interface{}, err error) {
+	return mock.GetTrigalertCtx(context.Background())
+}
+
+// GetTrigalertCtx is like GetTrigalert but passes ctx on.
+func (mock *Mock) GetTrigalertCtx(ctx context.Context) (
+	trigalert map[string]interface{}, err error) {
+	mock.record("GetTrigalert")
+	if mock.GetTrigalertFunc == nil {
+		return nil, ErrNotScripted
+	}
+	return mock.GetTrigalertFunc(ctx)
+}
+
+// GetTrigalertLast24 records the call and answers it with
+// GetTrigalertLast24Func.
+func (mock *Mock) GetTrigalertLast24() (trigalert map[string]interface{},
+	err error) {
+	return mock.GetTrigalertLast24Ctx(context.Background())
+}
+
+// GetTrigalertLast24Ctx is like GetTrigalertLast24 but passes ctx on.
+func (mock *Mock) GetTrigalertLast24Ctx(ctx context.Context) (
+	trigalert map[string]interface{}, err error) {
+	mock.record("GetTrigalertLast24")
+	if mock.GetTrigalertLast24Func == nil {
+		return nil, ErrNotScripted
+	}
+	return mock.GetTrigalertLast24Func(ctx)
+}
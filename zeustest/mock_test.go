@@ -0,0 +1,118 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeustest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/CiscoZeus/go-zeusclient"
+)
+
+// shipErrors is code under test depending on the client through an
+// interface.
+func shipErrors(api zeus.LogsAPI, messages ...string) (int, error) {
+	logs := zeus.LogList{Name: "errors"}
+	for _, message := range messages {
+		logs.Logs = append(logs.Logs, zeus.Log{"message": message})
+	}
+	return api.PostLogs(logs)
+}
+
+func TestMock(t *testing.T) {
+	mock := &Mock{
+		PostLogsFunc: func(ctx context.Context, logs zeus.LogList) (
+			zeus.PostResult, error) {
+			return zeus.PostResult{Successful: len(logs.Logs)}, nil
+		},
+	}
+	if suc, err := shipErrors(mock, "a", "b"); err != nil || suc != 2 {
+		t.Error("unexpected result:", suc, err)
+	}
+	expected := []Call{{Method: "PostLogs", Args: []interface{}{zeus.LogList{
+		Name: "errors", Logs: []zeus.Log{{"message": "a"}, {"message": "b"}}}}}}
+	if calls := mock.Calls(); !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected %+v, got %+v", expected, calls)
+	}
+
+	if _, _, err := mock.GetAlerts(); err != ErrNotScripted {
+		t.Error("unscripted calls should fail:", err)
+	}
+	failure := errors.New("boom")
+	mock.GetMetricSeriesFunc = func(ctx context.Context, metricName, aggregator,
+		aggregatorCol, groupInterval string, from, to float64,
+		filterCondition string, offset, limit int) ([]zeus.MetricList, error) {
+		if len(mock.Calls("GetMetricSeries")) == 1 {
+			return nil, failure
+		}
+		return []zeus.MetricList{{Name: metricName}, {Name: "other"}}, nil
+	}
+	if _, err := mock.GetMetricValues("cpu", "", "", "", 0, 0, "", 0, 0); err != failure {
+		t.Error("the first call should fail:", err)
+	}
+	metrics, err := mock.GetMetricValuesCtx(context.Background(), "cpu", "mean",
+		"load", "1m", 1, 2, "", 0, 10)
+	if err != nil || metrics.Name != "cpu" {
+		t.Error("the second call should return the first series:", metrics, err)
+	}
+	calls := mock.Calls("GetMetricSeries")
+	if len(calls) != 2 || calls[1].Args[1] != "mean" || calls[1].Args[8] != 10 {
+		t.Error("unexpected calls", calls)
+	}
+	if len(mock.Calls("GetAlerts", "PostLogs")) != 2 {
+		t.Error("calls should be filtered by method")
+	}
+	mock.Reset()
+	if len(mock.Calls()) != 0 {
+		t.Error("calls should be forgotten")
+	}
+}
+
+func TestMockHelpers(t *testing.T) {
+	mock := &Mock{
+		GetLogsFunc: func(ctx context.Context, logName, field, pattern string,
+			from, to int64, offset, limit int) (int, zeus.LogList, error) {
+			return 1, zeus.LogList{Name: logName,
+				Logs: []zeus.Log{{"message": "hello"}}}, nil
+		},
+		PostLogsFunc: func(ctx context.Context, logs zeus.LogList) (
+			zeus.PostResult, error) {
+			return zeus.PostResult{Successful: len(logs.Logs)}, nil
+		},
+		GetMetricNamesFunc: func(ctx context.Context, metricName string, offset,
+			limit int) ([]string, error) {
+			return []string{"cpu"}, nil
+		},
+	}
+	ctx := context.Background()
+	logs, err := zeus.QueryLogs(ctx, mock, zeus.NewLogQuery("syslog"))
+	if err != nil || len(logs.Logs) != 1 {
+		t.Error("failed to query logs:", logs, err)
+	}
+	shipper := zeus.NewLogShipper(mock, zeus.LogShipperConfig{})
+	shipper.Send("syslog", zeus.Log{"message": "hello"})
+	if err := shipper.Close(ctx); err != nil {
+		t.Error("failed to ship logs:", err)
+	}
+	if len(mock.Calls("PostLogs")) != 1 {
+		t.Error("logs were not shipped:", mock.Calls())
+	}
+	alert := zeus.Alert{Alert_expression: "cpu > 20"}
+	if err := zeus.CheckAlert(ctx, mock, alert); err != nil {
+		t.Error("failed to check alert:", err)
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+// Package zeustest provides an in-memory Zeus server for tests.
+//
+//	server := zeustest.NewServer()
+//	defer server.Close()
+//	client, err := zeus.NewClient(server.URL, "token")
+//	bucket := client.Bucket("org1/bucket1")
+//
+// The server keeps the logs, metrics and alerts of every bucket, and
+// answers the requests of the client as Zeus does: it checks the token and
+// the Bucket-Name header, pages through results with offset and limit, and
+// evaluates aggregations, group intervals and filter conditions of metric
+// queries.
+//
+// Code which depends on zeus.API, or one of the narrower interfaces such as
+// zeus.LogsAPI, can instead be tested with a Mock, which records calls and
+// answers them with scripted functions.
+package zeustest
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CiscoZeus/go-zeusclient"
+)
+
+// DefaultLogLimit is the number of logs returned by a query without limit.
+const DefaultLogLimit = 10
+
+// Server is an in-memory Zeus server listening on a local address. Its
+// methods seed and inspect its content, and are safe to call while clients
+// send requests.
+type Server struct {
+	*httptest.Server
+
+	// Now returns the time of the server, used to timestamp logs, metrics
+	// and alerts sent without one, and for GetTrigalertLast24. It is
+	// time.Now by default, and must be set before the first request.
+	Now func() time.Time
+
+	mu       sync.Mutex
+	tokens   map[string]map[string]bool
+	buckets  map[string]*bucketData
+	lastID   int64
+	failures []int
+	requests int
+}
+
+// bucketData is the content of a bucket.
+type bucketData struct {
+	logs       map[string][]zeus.Log
+	metrics    map[string]*series
+	alerts     map[int64]zeus.Alert
+	trigalerts []Trigalert
+}
+
+// NewServer starts and returns a new Server, which the caller should Close
+// when finished. It accepts any token until AllowToken is called.
+func NewServer() *Server {
+	server := &Server{
+		Now:     time.Now,
+		tokens:  make(map[string]map[string]bool),
+		buckets: make(map[string]*bucketData),
+	}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serveHTTP))
+	return server
+}
+
+// AllowToken makes the server accept token for the given buckets, or every
+// bucket if none is given. Once a token is allowed, requests with other
+// tokens are rejected with 401, and requests for other buckets with 403.
+func (server *Server) AllowToken(token string, buckets ...string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	allowed := make(map[string]bool)
+	for _, bucket := range buckets {
+		allowed[bucket] = true
+	}
+	server.tokens[token] = allowed
+}
+
+// FailNext makes the next count requests fail with status, to test how
+// clients handle errors.
+func (server *Server) FailNext(count, status int) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	for i := 0; i < count; i++ {
+		server.failures = append(server.failures, status)
+	}
+}
+
+// Requests returns the number of requests received.
+func (server *Server) Requests() int {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return server.requests
+}
+
+// bucket returns the content of the bucket called name, creating it if
+// needed. The caller must hold server.mu.
+func (server *Server) bucket(name string) *bucketData {
+	data, ok := server.buckets[name]
+	if !ok {
+		data = &bucketData{
+			logs:    make(map[string][]zeus.Log),
+			metrics: make(map[string]*series),
+			alerts:  make(map[int64]zeus.Alert),
+		}
+		server.buckets[name] = data
+	}
+	return data
+}
+
+// now returns the time of the server as unix seconds.
+func (server *Server) now() float64 {
+	return float64(server.Now().UnixNano()) / 1e9
+}
+
+// request is a request to a bucket, once authorized.
+type request struct {
+	method string
+	// path holds the parts of the URL path after the token.
+	path   []string
+	form   url.Values
+	token  string
+	bucket *bucketData
+}
+
+// handler answers a request with a status and a value encoded as JSON.
+type handler func(server *Server, req *request) (int, interface{})
+
+var handlers = map[string]handler{
+	"logs":       serveLogs,
+	"metrics":    serveMetrics,
+	"alerts":     serveAlerts,
+	"trigalerts": serveTrigalerts,
+}
+
+func (server *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	status, value := server.handle(r)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if value != nil {
+		json.NewEncoder(w).Encode(value)
+	}
+}
+
+func (server *Server) handle(r *http.Request) (int, interface{}) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.requests++
+	if len(server.failures) > 0 {
+		status := server.failures[0]
+		server.failures = server.failures[1:]
+		return status, errorBody("injected failure")
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	handle, ok := handlers[parts[0]]
+	if !ok || len(parts) < 2 {
+		return http.StatusNotFound, errorBody("not found")
+	}
+	token := parts[1]
+	if r.Header.Get("Authorization") != "Bearer "+token {
+		return http.StatusUnauthorized, errorBody("token mismatch")
+	}
+	name := r.Header.Get("Bucket-Name")
+	if name == "" {
+		return http.StatusBadRequest, errorBody("Bucket-Name header is required")
+	}
+	if len(server.tokens) > 0 {
+		buckets, ok := server.tokens[token]
+		if !ok {
+			return http.StatusUnauthorized, errorBody("invalid token")
+		}
+		if len(buckets) > 0 && !buckets[name] {
+			return http.StatusForbidden, errorBody("no access to bucket " + name)
+		}
+	}
+
+	// The client sends forms without a Content-Type, so the body is parsed
+	// whatever it is.
+	form := r.URL.Query()
+	if r.Method != "GET" {
+		body, err := ioutil.ReadAll(r.Body)
+		if err == nil {
+			form, err = url.ParseQuery(string(body))
+		}
+		if err != nil {
+			return http.StatusBadRequest, errorBody(err.Error())
+		}
+	}
+	return handle(server, &request{
+		method: r.Method,
+		path:   parts[2:],
+		form:   form,
+		token:  token,
+		bucket: server.bucket(name),
+	})
+}
+
+// errorBody is the body of an error response.
+func errorBody(message string) map[string]string {
+	return map[string]string{"error": message}
+}
+
+// postResponse is the body of a response to a POST of logs or metrics.
+type postResponse struct {
+	Successful int    `json:"successful"`
+	Failed     int    `json:"failed"`
+	Error      string `json:"error,omitempty"`
+}
+
+// intParam returns the integer parameter key, or def if it is absent.
+func intParam(form url.Values, key string, def int) (int, error) {
+	raw := form.Get(key)
+	if raw == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		return 0, errors.New("invalid " + key)
+	}
+	return n, nil
+}
+
+// floatParam returns the number parameter key, or def if it is absent.
+func floatParam(form url.Values, key string, def float64) (float64, error) {
+	raw := form.Get(key)
+	if raw == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, errors.New("invalid " + key)
+	}
+	return f, nil
+}
+
+// window returns the entries of the page given by the offset and limit
+// parameters, limit 0 meaning all of them.
+func window(count, offset, limit int) (start, end int) {
+	start, end = offset, count
+	if start > count {
+		start = count
+	}
+	if limit > 0 && start+limit < end {
+		end = start + limit
+	}
+	return start, end
+}
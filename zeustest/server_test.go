@@ -0,0 +1,70 @@
+// Copyright 2015 Cisco Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// 	distributed under the License is distributed on an "AS IS" BASIS,
+// 	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// 	See the License for the specific language governing permissions and
+// 	limitations under the License.
+
+package zeustest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CiscoZeus/go-zeusclient"
+)
+
+// newBucket starts a server and returns a handle on org1/bucket1 of a
+// client connected to it.
+func newBucket(t *testing.T, opts ...zeus.Option) (*Server, *zeus.Bucket) {
+	server := NewServer()
+	t.Cleanup(server.Close)
+	client, err := zeus.NewClient(server.URL, "goZeus", opts...)
+	if err != nil {
+		t.Fatal("failed to create client:", err)
+	}
+	return server, client.Bucket("org1/bucket1")
+}
+
+func TestServerAuthorization(t *testing.T) {
+	server, bucket := newBucket(t)
+	if _, err := bucket.GetMetricNames("", 0, 0); err != nil {
+		t.Error("any token should be accepted by default:", err)
+	}
+
+	server.AllowToken("goZeus", "org1/bucket1")
+	if _, err := bucket.GetMetricNames("", 0, 0); err != nil {
+		t.Error("an allowed token should be accepted:", err)
+	}
+	client, _ := zeus.NewClient(server.URL, "goZeus")
+	if _, err := client.Bucket("org1/other").GetMetricNames("", 0, 0); !zeus.IsUnauthorized(err) {
+		t.Error("should reject another bucket:", err)
+	}
+	client, _ = zeus.NewClient(server.URL, "wrong")
+	if _, err := client.Bucket("org1/bucket1").GetMetricNames("", 0, 0); !zeus.IsUnauthorized(err) {
+		t.Error("should reject an unknown token:", err)
+	}
+}
+
+func TestServerFailNext(t *testing.T) {
+	server, bucket := newBucket(t, zeus.WithRetry(zeus.RetryPolicy{
+		MaxAttempts: 3, MinBackoff: time.Millisecond}))
+	server.FailNext(2, 503)
+	if _, err := bucket.GetMetricNames("", 0, 0); err != nil {
+		t.Error("should succeed after retries:", err)
+	}
+	if server.Requests() != 3 {
+		t.Error("unexpected number of requests", server.Requests())
+	}
+	server.FailNext(1, 400)
+	if _, err := bucket.GetMetricNames("", 0, 0); !zeus.IsBadRequest(err) {
+		t.Error("should fail with the injected status:", err)
+	}
+}